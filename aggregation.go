@@ -0,0 +1,537 @@
+package elasticsearch
+
+import (
+	"fmt"
+)
+
+// ================================ es 聚合构造器 ================================
+
+// Aggregation 所有聚合的公共接口，Map 返回可直接放进 aggs 中的结构
+type Aggregation interface {
+	Map() map[string]interface{}
+}
+
+// subAggregations 桶聚合下的子聚合
+type subAggregations map[string]Aggregation
+
+// wrap 生成 {type: params, aggs: {...}}
+func (s subAggregations) wrap(aggType string, params map[string]interface{}) map[string]interface{} {
+	agg := map[string]interface{}{
+		aggType: params,
+	}
+	if len(s) > 0 {
+		agg["aggs"] = aggregationMaps(s)
+	}
+	return agg
+}
+
+// validate 校验每个子聚合
+func (s subAggregations) validate() error {
+	return validateAggregations(s)
+}
+
+// validateAggregations 聚合不能为 nil，实现了 validator 的聚合会校验参数
+func validateAggregations(aggs map[string]Aggregation) error {
+	for _, name := range sortedKeys(aggs) {
+		agg := aggs[name]
+		if agg == nil {
+			return fmt.Errorf("aggregation %s can not be nil", name)
+		}
+		if v, ok := agg.(validator); ok {
+			if err := v.Validate(); err != nil {
+				return fmt.Errorf("aggregation %s: %s", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// aggregationMaps 将聚合转换成请求体中的 aggs，nil 聚合生成 null，由 Build 报错
+func aggregationMaps(aggs map[string]Aggregation) map[string]interface{} {
+	m := make(map[string]interface{}, len(aggs))
+	for name, agg := range aggs {
+		if agg == nil {
+			m[name] = nil
+			continue
+		}
+		m[name] = agg.Map()
+	}
+	return m
+}
+
+// TermsAggregation 按字段的值分桶，字段需要是 keyword 或者数值类型
+type TermsAggregation struct {
+	field  string
+	params map[string]interface{}
+	aggs   subAggregations
+}
+
+// TermsAgg 创建 terms 聚合
+func TermsAgg(field string) *TermsAggregation {
+	return &TermsAggregation{field: field, params: map[string]interface{}{}, aggs: subAggregations{}}
+}
+
+// Size 返回的桶数量，默认 10
+func (a *TermsAggregation) Size(size int) *TermsAggregation {
+	a.params["size"] = size
+	return a
+}
+
+// MinDocCount 文档数少于该值的桶不返回
+func (a *TermsAggregation) MinDocCount(count int64) *TermsAggregation {
+	a.params["min_doc_count"] = count
+	return a
+}
+
+// Order 桶的排序方式，key 为 _count、_key 或者子聚合名称，order 为 asc 或 desc
+func (a *TermsAggregation) Order(key, order string) *TermsAggregation {
+	orders, _ := a.params["order"].([]map[string]interface{})
+	a.params["order"] = append(orders, map[string]interface{}{key: order})
+	return a
+}
+
+// Missing 没有该字段的文档归入的值
+func (a *TermsAggregation) Missing(value interface{}) *TermsAggregation {
+	a.params["missing"] = value
+	return a
+}
+
+// SubAggregation 添加子聚合，对每个桶内的文档再做聚合
+func (a *TermsAggregation) SubAggregation(name string, agg Aggregation) *TermsAggregation {
+	a.aggs[name] = agg
+	return a
+}
+
+// Validate 校验子聚合
+func (a *TermsAggregation) Validate() error {
+	return a.aggs.validate()
+}
+
+// Map 实现 Aggregation 接口
+func (a *TermsAggregation) Map() map[string]interface{} {
+	params := map[string]interface{}{"field": a.field}
+	for k, v := range a.params {
+		params[k] = v
+	}
+	return a.aggs.wrap("terms", params)
+}
+
+// DateHistogramAggregation 按时间间隔分桶
+type DateHistogramAggregation struct {
+	field  string
+	params map[string]interface{}
+	aggs   subAggregations
+}
+
+// DateHistogramAgg 创建 date_histogram 聚合，需要再设置 CalendarInterval 或者 FixedInterval
+func DateHistogramAgg(field string) *DateHistogramAggregation {
+	return &DateHistogramAggregation{field: field, params: map[string]interface{}{}, aggs: subAggregations{}}
+}
+
+// CalendarInterval 按自然时间分桶，例如 1d、1w、1M
+func (a *DateHistogramAggregation) CalendarInterval(interval string) *DateHistogramAggregation {
+	a.params["calendar_interval"] = interval
+	return a
+}
+
+// FixedInterval 按固定时长分桶，例如 30m、12h
+func (a *DateHistogramAggregation) FixedInterval(interval string) *DateHistogramAggregation {
+	a.params["fixed_interval"] = interval
+	return a
+}
+
+// Format 桶 key_as_string 的日期格式，例如 yyyy-MM-dd
+func (a *DateHistogramAggregation) Format(format string) *DateHistogramAggregation {
+	a.params["format"] = format
+	return a
+}
+
+// TimeZone 分桶使用的时区，例如 +08:00
+func (a *DateHistogramAggregation) TimeZone(timeZone string) *DateHistogramAggregation {
+	a.params["time_zone"] = timeZone
+	return a
+}
+
+// MinDocCount 文档数少于该值的桶不返回，设置为 0 时返回空桶
+func (a *DateHistogramAggregation) MinDocCount(count int64) *DateHistogramAggregation {
+	a.params["min_doc_count"] = count
+	return a
+}
+
+// ExtendedBounds 配合 MinDocCount(0) 使用，保证返回 min 到 max 之间的所有桶
+func (a *DateHistogramAggregation) ExtendedBounds(min, max interface{}) *DateHistogramAggregation {
+	a.params["extended_bounds"] = map[string]interface{}{"min": min, "max": max}
+	return a
+}
+
+// SubAggregation 添加子聚合，对每个桶内的文档再做聚合
+func (a *DateHistogramAggregation) SubAggregation(name string, agg Aggregation) *DateHistogramAggregation {
+	a.aggs[name] = agg
+	return a
+}
+
+// Validate 校验子聚合
+func (a *DateHistogramAggregation) Validate() error {
+	return a.aggs.validate()
+}
+
+// Map 实现 Aggregation 接口
+func (a *DateHistogramAggregation) Map() map[string]interface{} {
+	params := map[string]interface{}{"field": a.field}
+	for k, v := range a.params {
+		params[k] = v
+	}
+	return a.aggs.wrap("date_histogram", params)
+}
+
+// HistogramAggregation 数值字段按固定间隔分桶
+type HistogramAggregation struct {
+	field       string
+	interval    float64
+	minDocCount *int64
+	aggs        subAggregations
+}
+
+// HistogramAgg 创建 histogram 聚合
+func HistogramAgg(field string, interval float64) *HistogramAggregation {
+	return &HistogramAggregation{field: field, interval: interval, aggs: subAggregations{}}
+}
+
+// MinDocCount 文档数少于该值的桶不返回，设置为 0 时返回空桶
+func (a *HistogramAggregation) MinDocCount(count int64) *HistogramAggregation {
+	a.minDocCount = &count
+	return a
+}
+
+// SubAggregation 添加子聚合，对每个桶内的文档再做聚合
+func (a *HistogramAggregation) SubAggregation(name string, agg Aggregation) *HistogramAggregation {
+	a.aggs[name] = agg
+	return a
+}
+
+// Validate 校验子聚合
+func (a *HistogramAggregation) Validate() error {
+	return a.aggs.validate()
+}
+
+// Map 实现 Aggregation 接口
+func (a *HistogramAggregation) Map() map[string]interface{} {
+	params := map[string]interface{}{
+		"field":    a.field,
+		"interval": a.interval,
+	}
+	if a.minDocCount != nil {
+		params["min_doc_count"] = *a.minDocCount
+	}
+	return a.aggs.wrap("histogram", params)
+}
+
+// RangeAggregation 按自定义的范围分桶，范围包含 from 不包含 to
+type RangeAggregation struct {
+	field  string
+	ranges []map[string]interface{}
+	aggs   subAggregations
+}
+
+// RangeAgg 创建 range 聚合
+func RangeAgg(field string) *RangeAggregation {
+	return &RangeAggregation{field: field, aggs: subAggregations{}}
+}
+
+// AddRange 添加一个范围，from 或 to 为 nil 时表示不限
+func (a *RangeAggregation) AddRange(from, to interface{}) *RangeAggregation {
+	return a.AddKeyedRange("", from, to)
+}
+
+// AddKeyedRange 添加一个带名称的范围，结果中桶的 key 为该名称
+func (a *RangeAggregation) AddKeyedRange(key string, from, to interface{}) *RangeAggregation {
+	r := map[string]interface{}{}
+	if key != "" {
+		r["key"] = key
+	}
+	if from != nil {
+		r["from"] = from
+	}
+	if to != nil {
+		r["to"] = to
+	}
+	a.ranges = append(a.ranges, r)
+	return a
+}
+
+// SubAggregation 添加子聚合，对每个桶内的文档再做聚合
+func (a *RangeAggregation) SubAggregation(name string, agg Aggregation) *RangeAggregation {
+	a.aggs[name] = agg
+	return a
+}
+
+// Validate 校验子聚合
+func (a *RangeAggregation) Validate() error {
+	return a.aggs.validate()
+}
+
+// Map 实现 Aggregation 接口
+func (a *RangeAggregation) Map() map[string]interface{} {
+	return a.aggs.wrap("range", map[string]interface{}{
+		"field":  a.field,
+		"ranges": a.ranges,
+	})
+}
+
+// FiltersAggregation 每个查询条件一个桶
+type FiltersAggregation struct {
+	filters map[string]Query
+	aggs    subAggregations
+}
+
+// FiltersAgg 创建 filters 聚合
+func FiltersAgg() *FiltersAggregation {
+	return &FiltersAggregation{filters: map[string]Query{}, aggs: subAggregations{}}
+}
+
+// Filter 添加一个桶，name 为结果中桶的 key，query 为 nil 时会被忽略
+func (a *FiltersAggregation) Filter(name string, query Query) *FiltersAggregation {
+	if query != nil {
+		a.filters[name] = query
+	}
+	return a
+}
+
+// SubAggregation 添加子聚合，对每个桶内的文档再做聚合
+func (a *FiltersAggregation) SubAggregation(name string, agg Aggregation) *FiltersAggregation {
+	a.aggs[name] = agg
+	return a
+}
+
+// Validate 发送前校验参数，包括每个桶的查询条件和子聚合
+func (a *FiltersAggregation) Validate() error {
+	if len(a.filters) == 0 {
+		return fmt.Errorf("filters aggregation requires at least one filter")
+	}
+	for _, name := range sortedKeys(a.filters) {
+		if err := validateQuery(a.filters[name]); err != nil {
+			return fmt.Errorf("filter %s: %s", name, err)
+		}
+	}
+	return a.aggs.validate()
+}
+
+// Map 实现 Aggregation 接口
+func (a *FiltersAggregation) Map() map[string]interface{} {
+	filters := make(map[string]interface{}, len(a.filters))
+	for name, q := range a.filters {
+		filters[name] = q.Map()
+	}
+	return a.aggs.wrap("filters", map[string]interface{}{
+		"filters": filters,
+	})
+}
+
+// MetricAggregation avg、sum、min、max、stats、cardinality 等基于单个字段的指标聚合
+type MetricAggregation struct {
+	aggType string
+	field   string
+	params  map[string]interface{}
+}
+
+func newMetricAggregation(aggType, field string) *MetricAggregation {
+	return &MetricAggregation{aggType: aggType, field: field, params: map[string]interface{}{}}
+}
+
+// AvgAgg 平均值
+func AvgAgg(field string) *MetricAggregation {
+	return newMetricAggregation("avg", field)
+}
+
+// SumAgg 求和
+func SumAgg(field string) *MetricAggregation {
+	return newMetricAggregation("sum", field)
+}
+
+// MinAgg 最小值
+func MinAgg(field string) *MetricAggregation {
+	return newMetricAggregation("min", field)
+}
+
+// MaxAgg 最大值
+func MaxAgg(field string) *MetricAggregation {
+	return newMetricAggregation("max", field)
+}
+
+// StatsAgg 一次返回 count、min、max、avg、sum
+func StatsAgg(field string) *MetricAggregation {
+	return newMetricAggregation("stats", field)
+}
+
+// CardinalityAgg 去重计数，结果是近似值
+func CardinalityAgg(field string) *MetricAggregation {
+	return newMetricAggregation("cardinality", field)
+}
+
+// PrecisionThreshold cardinality 在该值以下的计数接近精确，最大 40000
+func (a *MetricAggregation) PrecisionThreshold(threshold int) *MetricAggregation {
+	a.params["precision_threshold"] = threshold
+	return a
+}
+
+// Missing 没有该字段的文档使用的值，默认忽略这些文档
+func (a *MetricAggregation) Missing(value interface{}) *MetricAggregation {
+	a.params["missing"] = value
+	return a
+}
+
+// Map 实现 Aggregation 接口
+func (a *MetricAggregation) Map() map[string]interface{} {
+	params := map[string]interface{}{"field": a.field}
+	for k, v := range a.params {
+		params[k] = v
+	}
+	return map[string]interface{}{
+		a.aggType: params,
+	}
+}
+
+// PercentilesAggregation 百分位数，结果是近似值
+type PercentilesAggregation struct {
+	field    string
+	percents []float64
+}
+
+// PercentilesAgg 创建 percentiles 聚合，默认返回 1、5、25、50、75、95、99
+func PercentilesAgg(field string) *PercentilesAggregation {
+	return &PercentilesAggregation{field: field}
+}
+
+// Percents 指定需要的百分位，例如 50、95、99
+func (a *PercentilesAggregation) Percents(percents ...float64) *PercentilesAggregation {
+	a.percents = append(a.percents, percents...)
+	return a
+}
+
+// Map 实现 Aggregation 接口
+func (a *PercentilesAggregation) Map() map[string]interface{} {
+	params := map[string]interface{}{"field": a.field}
+	if len(a.percents) > 0 {
+		params["percents"] = a.percents
+	}
+	return map[string]interface{}{
+		"percentiles": params,
+	}
+}
+
+// TopHitsAggregation 返回每个桶中得分最高或者按排序最靠前的文档
+type TopHitsAggregation struct {
+	size   *int
+	sorts  []map[string]interface{}
+	source []string
+}
+
+// TopHitsAgg 创建 top_hits 聚合，一般作为其他桶聚合的子聚合
+func TopHitsAgg() *TopHitsAggregation {
+	return &TopHitsAggregation{}
+}
+
+// Size 每个桶返回的文档数，默认 3
+func (a *TopHitsAggregation) Size(size int) *TopHitsAggregation {
+	a.size = &size
+	return a
+}
+
+// Sort 追加一个排序字段，order 为 asc 或 desc
+func (a *TopHitsAggregation) Sort(field, order string) *TopHitsAggregation {
+	a.sorts = append(a.sorts, map[string]interface{}{
+		field: map[string]interface{}{
+			"order": order,
+		},
+	})
+	return a
+}
+
+// Source 只返回 _source 中的这些字段
+func (a *TopHitsAggregation) Source(fields ...string) *TopHitsAggregation {
+	a.source = append(a.source, fields...)
+	return a
+}
+
+// Map 实现 Aggregation 接口
+func (a *TopHitsAggregation) Map() map[string]interface{} {
+	params := map[string]interface{}{}
+	if a.size != nil {
+		params["size"] = *a.size
+	}
+	if len(a.sorts) > 0 {
+		params["sort"] = a.sorts
+	}
+	if len(a.source) > 0 {
+		params["_source"] = a.source
+	}
+	return map[string]interface{}{
+		"top_hits": params,
+	}
+}
+
+// NestedAggregation 对 nested 类型字段中的子文档做聚合，子聚合的字段需要带上 path 前缀
+type NestedAggregation struct {
+	path string
+	aggs subAggregations
+}
+
+// NestedAgg 创建 nested 聚合
+func NestedAgg(path string) *NestedAggregation {
+	return &NestedAggregation{path: path, aggs: subAggregations{}}
+}
+
+// SubAggregation 添加子聚合
+func (a *NestedAggregation) SubAggregation(name string, agg Aggregation) *NestedAggregation {
+	a.aggs[name] = agg
+	return a
+}
+
+// Validate 校验子聚合
+func (a *NestedAggregation) Validate() error {
+	return a.aggs.validate()
+}
+
+// Map 实现 Aggregation 接口
+func (a *NestedAggregation) Map() map[string]interface{} {
+	return a.aggs.wrap("nested", map[string]interface{}{
+		"path": a.path,
+	})
+}
+
+// ReverseNestedAggregation 在 nested 聚合中回到父文档做聚合
+type ReverseNestedAggregation struct {
+	path string
+	aggs subAggregations
+}
+
+// ReverseNestedAgg 创建 reverse_nested 聚合，只能作为 nested 聚合的子聚合
+func ReverseNestedAgg() *ReverseNestedAggregation {
+	return &ReverseNestedAggregation{aggs: subAggregations{}}
+}
+
+// Path 回到指定的上一级 nested 对象，默认回到根文档
+func (a *ReverseNestedAggregation) Path(path string) *ReverseNestedAggregation {
+	a.path = path
+	return a
+}
+
+// SubAggregation 添加子聚合
+func (a *ReverseNestedAggregation) SubAggregation(name string, agg Aggregation) *ReverseNestedAggregation {
+	a.aggs[name] = agg
+	return a
+}
+
+// Validate 校验子聚合
+func (a *ReverseNestedAggregation) Validate() error {
+	return a.aggs.validate()
+}
+
+// Map 实现 Aggregation 接口
+func (a *ReverseNestedAggregation) Map() map[string]interface{} {
+	params := map[string]interface{}{}
+	if a.path != "" {
+		params["path"] = a.path
+	}
+	return a.aggs.wrap("reverse_nested", params)
+}
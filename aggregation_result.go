@@ -0,0 +1,423 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ================================ es 聚合返回结构 ================================
+
+// Aggregations 聚合结果，key 为聚合名称
+type Aggregations map[string]*AggregationResult
+
+// Get 按名称取聚合结果，不存在时返回 nil；AggregationResult 的方法都可以在 nil 上调用，
+// 所以可以直接链式取子聚合：result.Aggregations.Get("entities").Get("types").Buckets()
+func (a Aggregations) Get(name string) *AggregationResult {
+	return a[name]
+}
+
+// AggregationResult 单个聚合的结果，不同类型的聚合用不同的方法读取
+type AggregationResult struct {
+	value         *float64
+	valueAsString string
+	docCount      int64
+	buckets       []Bucket
+	stats         *StatsResult
+	percentiles   map[string]*float64
+	hits          *SearchHits[json.RawMessage]
+	aggs          Aggregations
+	raw           json.RawMessage
+}
+
+// StatsResult stats 聚合的结果，没有文档时 Min、Max、Avg 为 nil
+type StatsResult struct {
+	Count int64    `json:"count"`
+	Min   *float64 `json:"min"`
+	Max   *float64 `json:"max"`
+	Avg   *float64 `json:"avg"`
+	Sum   float64  `json:"sum"`
+}
+
+// Bucket 桶聚合中的一个桶
+type Bucket struct {
+	// terms 为字段值，histogram 为数值，date_histogram 为毫秒时间戳，filters 和带名称的 range 为名称
+	Key         interface{}
+	KeyAsString string
+	DocCount    int64
+	// range 聚合的范围
+	From *float64
+	To   *float64
+	// 桶内的子聚合
+	Aggregations Aggregations
+}
+
+// Get 取桶内的子聚合
+func (b Bucket) Get(name string) *AggregationResult {
+	return b.Aggregations.Get(name)
+}
+
+// KeyString 桶的 key 转换成字符串，优先使用 key_as_string
+func (b Bucket) KeyString() string {
+	if b.KeyAsString != "" {
+		return b.KeyAsString
+	}
+	switch key := b.Key.(type) {
+	case string:
+		return key
+	case float64:
+		return strconv.FormatFloat(key, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(key)
+	}
+	return ""
+}
+
+// Value avg、sum、min、max、cardinality 的值，没有文档时 min、max、avg 返回 false
+func (r *AggregationResult) Value() (float64, bool) {
+	if r == nil || r.value == nil {
+		return 0, false
+	}
+	return *r.value, true
+}
+
+// ValueAsString 设置了 format 的指标聚合返回的格式化值，例如日期字段的 max
+func (r *AggregationResult) ValueAsString() string {
+	if r == nil {
+		return ""
+	}
+	return r.valueAsString
+}
+
+// DocCount nested、reverse_nested 等单桶聚合的文档数
+func (r *AggregationResult) DocCount() int64 {
+	if r == nil {
+		return 0
+	}
+	return r.docCount
+}
+
+// Buckets terms、histogram、date_histogram、range、filters 的桶，filters 的桶按名称排序
+func (r *AggregationResult) Buckets() []Bucket {
+	if r == nil {
+		return nil
+	}
+	return r.buckets
+}
+
+// Stats stats 聚合的结果
+func (r *AggregationResult) Stats() (*StatsResult, bool) {
+	if r == nil || r.stats == nil {
+		return nil, false
+	}
+	return r.stats, true
+}
+
+// Percentile 取指定百分位的值，percent 和请求中的一致，例如 95 或 99.9
+func (r *AggregationResult) Percentile(percent float64) (float64, bool) {
+	if r == nil {
+		return 0, false
+	}
+	v, ok := r.percentiles[percentileKey(percent)]
+	if !ok || v == nil {
+		return 0, false
+	}
+	return *v, true
+}
+
+// Hits top_hits 的结果，_source 需要再用 DecodeTopHits 解析
+func (r *AggregationResult) Hits() *SearchHits[json.RawMessage] {
+	if r == nil {
+		return nil
+	}
+	return r.hits
+}
+
+// Get 取子聚合，用于 nested、reverse_nested 这样只有一个桶的聚合
+func (r *AggregationResult) Get(name string) *AggregationResult {
+	if r == nil {
+		return nil
+	}
+	return r.aggs.Get(name)
+}
+
+// Raw 原始的聚合结果，没有提供方法的聚合类型可以自己解析
+func (r *AggregationResult) Raw() json.RawMessage {
+	if r == nil {
+		return nil
+	}
+	return r.raw
+}
+
+// DecodeTopHits 把 top_hits 的结果解析成 Hit[T]
+func DecodeTopHits[T any](r *AggregationResult) ([]Hit[T], error) {
+	rawHits := r.Hits()
+	if rawHits == nil {
+		return nil, nil
+	}
+	hits := make([]Hit[T], 0, len(rawHits.Hits))
+	for _, raw := range rawHits.Hits {
+		hit := Hit[T]{
+			Index:      raw.Index,
+			ID:         raw.ID,
+			Score:      raw.Score,
+			Sort:       raw.Sort,
+			Highlights: raw.Highlights,
+			InnerHits:  raw.InnerHits,
+		}
+		if len(raw.Source) > 0 {
+			if err := json.Unmarshal(raw.Source, &hit.Source); err != nil {
+				return nil, errors.Wrapf(err, "Error parsing the _source of %s", raw.ID)
+			}
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// 聚合结果中值为对象、但不是子聚合的字段。指标聚合的 value、count、sum、min、max、avg
+// 都是数字或 null，所以同名的子聚合（值为对象）不会和它们混淆
+var aggregationObjectFields = map[string]bool{"buckets": true, "hits": true, "meta": true}
+
+// 桶中值为对象、但不是子聚合的字段，composite 聚合的 key 是对象
+var bucketObjectFields = map[string]bool{"key": true}
+
+// isObject 值是否为 json 对象
+func isObject(v json.RawMessage) bool {
+	return len(v) > 0 && v[0] == '{'
+}
+
+// unmarshalScalar 字段存在并且不是对象时才解析，值为对象说明是同名的子聚合
+func unmarshalScalar(fields map[string]json.RawMessage, name string, target interface{}) (bool, error) {
+	v, ok := fields[name]
+	if !ok || isObject(v) {
+		return false, nil
+	}
+	if err := json.Unmarshal(v, target); err != nil {
+		return false, errors.Wrap(err, name)
+	}
+	return true, nil
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler 接口
+func (r *AggregationResult) UnmarshalJSON(data []byte) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	r.raw = append(json.RawMessage(nil), data...)
+
+	if _, err := unmarshalScalar(fields, "value", &r.value); err != nil {
+		return err
+	}
+	if _, err := unmarshalScalar(fields, "value_as_string", &r.valueAsString); err != nil {
+		return err
+	}
+	if _, err := unmarshalScalar(fields, "doc_count", &r.docCount); err != nil {
+		return err
+	}
+	if v, ok := fields["buckets"]; ok {
+		buckets, err := parseBuckets(v)
+		if err != nil {
+			return errors.Wrap(err, "buckets")
+		}
+		r.buckets = buckets
+	}
+	if err := r.parseStats(fields); err != nil {
+		return err
+	}
+	// percentiles 的 values 是以百分位为 key 的数字，不是时说明是名为 values 的子聚合
+	percentiles := false
+	if v, ok := fields["values"]; ok {
+		values, ok, err := parsePercentiles(v)
+		if err != nil {
+			return errors.Wrap(err, "values")
+		}
+		if ok {
+			r.percentiles = values
+			percentiles = true
+		}
+	}
+	if v, ok := fields["hits"]; ok {
+		r.hits = &SearchHits[json.RawMessage]{}
+		if err := json.Unmarshal(v, r.hits); err != nil {
+			return errors.Wrap(err, "hits")
+		}
+	}
+
+	delete(fields, "meta")
+	if percentiles {
+		delete(fields, "values")
+	}
+	aggs, err := parseSubAggregations(fields, aggregationObjectFields)
+	if err != nil {
+		return err
+	}
+	r.aggs = aggs
+	return nil
+}
+
+// parseStats stats 聚合同时有数字类型的 count 和 sum
+func (r *AggregationResult) parseStats(fields map[string]json.RawMessage) error {
+	stats := &StatsResult{}
+	hasCount, err := unmarshalScalar(fields, "count", &stats.Count)
+	if err != nil {
+		return err
+	}
+	hasSum, err := unmarshalScalar(fields, "sum", &stats.Sum)
+	if err != nil {
+		return err
+	}
+	if !hasCount || !hasSum {
+		return nil
+	}
+	if _, err := unmarshalScalar(fields, "min", &stats.Min); err != nil {
+		return err
+	}
+	if _, err := unmarshalScalar(fields, "max", &stats.Max); err != nil {
+		return err
+	}
+	if _, err := unmarshalScalar(fields, "avg", &stats.Avg); err != nil {
+		return err
+	}
+	r.stats = stats
+	return nil
+}
+
+// parsePercentiles 解析 percentiles 的 values，可能是 {"95.0": 12.5} 也可能是 keyed 为 false 时的
+// [{"key": 95.0, "value": 12.5}]；key 不是百分位时返回 false
+func parsePercentiles(data json.RawMessage) (map[string]*float64, bool, error) {
+	if len(data) > 0 && data[0] == '[' {
+		var list []struct {
+			Key   float64  `json:"key"`
+			Value *float64 `json:"value"`
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, false, err
+		}
+		values := make(map[string]*float64, len(list))
+		for _, item := range list {
+			values[percentileKey(item.Key)] = item.Value
+		}
+		return values, true, nil
+	}
+	if !isObject(data) {
+		return nil, false, nil
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, false, err
+	}
+	values := make(map[string]*float64, len(raw))
+	for key, v := range raw {
+		// 设置了 format 时还会有 95.0_as_string 这样的 key
+		if strings.HasSuffix(key, "_as_string") {
+			continue
+		}
+		if _, err := strconv.ParseFloat(key, 64); err != nil || isObject(v) {
+			return nil, false, nil
+		}
+		var value *float64
+		if err := json.Unmarshal(v, &value); err != nil {
+			return nil, false, nil
+		}
+		values[key] = value
+	}
+	return values, true, nil
+}
+
+// percentileKey 百分位转换成 es 返回的 key，至少带一位小数，例如 95.0、99.9
+func percentileKey(percent float64) string {
+	key := strconv.FormatFloat(percent, 'f', -1, 64)
+	if !strings.Contains(key, ".") {
+		key += ".0"
+	}
+	return key
+}
+
+// parseBuckets 桶可能是数组，也可能是以名称为 key 的对象（filters 和 keyed 的聚合）
+func parseBuckets(data json.RawMessage) ([]Bucket, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err == nil {
+		buckets := make([]Bucket, 0, len(list))
+		for _, item := range list {
+			bucket, err := parseBucket(item)
+			if err != nil {
+				return nil, err
+			}
+			buckets = append(buckets, bucket)
+		}
+		return buckets, nil
+	}
+
+	keyed := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &keyed); err != nil {
+		return nil, err
+	}
+	buckets := make([]Bucket, 0, len(keyed))
+	for _, name := range sortedKeys(keyed) {
+		bucket, err := parseBucket(keyed[name])
+		if err != nil {
+			return nil, err
+		}
+		if bucket.Key == nil {
+			bucket.Key = name
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// parseBucket 解析单个桶和桶内的子聚合
+func parseBucket(data json.RawMessage) (Bucket, error) {
+	var bucket Bucket
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return bucket, err
+	}
+	if v, ok := fields["key"]; ok {
+		if err := json.Unmarshal(v, &bucket.Key); err != nil {
+			return bucket, errors.Wrap(err, "key")
+		}
+	}
+	if _, err := unmarshalScalar(fields, "key_as_string", &bucket.KeyAsString); err != nil {
+		return bucket, err
+	}
+	if _, err := unmarshalScalar(fields, "doc_count", &bucket.DocCount); err != nil {
+		return bucket, err
+	}
+	if _, err := unmarshalScalar(fields, "from", &bucket.From); err != nil {
+		return bucket, err
+	}
+	if _, err := unmarshalScalar(fields, "to", &bucket.To); err != nil {
+		return bucket, err
+	}
+
+	aggs, err := parseSubAggregations(fields, bucketObjectFields)
+	if err != nil {
+		return bucket, err
+	}
+	bucket.Aggregations = aggs
+	return bucket, nil
+}
+
+// parseSubAggregations 值为对象的字段都是子聚合，reserved 中的字段除外
+func parseSubAggregations(fields map[string]json.RawMessage, reserved map[string]bool) (Aggregations, error) {
+	var aggs Aggregations
+	for name, v := range fields {
+		if reserved[name] || !isObject(v) {
+			continue
+		}
+		if aggs == nil {
+			aggs = Aggregations{}
+		}
+		agg := &AggregationResult{}
+		if err := json.Unmarshal(v, agg); err != nil {
+			return nil, errors.Wrapf(err, "aggregation %s", name)
+		}
+		aggs[name] = agg
+	}
+	return aggs, nil
+}
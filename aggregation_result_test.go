@@ -0,0 +1,219 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func decodeAggregations(t *testing.T, data string) Aggregations {
+	t.Helper()
+	var aggs Aggregations
+	if err := json.Unmarshal([]byte(data), &aggs); err != nil {
+		t.Fatalf("unmarshal aggregations: %v", err)
+	}
+	return aggs
+}
+
+func assertValue(t *testing.T, name string, r *AggregationResult, want float64) {
+	t.Helper()
+	got, ok := r.Value()
+	if !ok || got != want {
+		t.Fatalf("%s value = %v, %v; want %v", name, got, ok, want)
+	}
+}
+
+func TestAggregationSubAggregationsNamedLikeMetricFields(t *testing.T) {
+	aggs := decodeAggregations(t, `{
+		"types": {
+			"doc_count_error_upper_bound": 0,
+			"sum_other_doc_count": 0,
+			"buckets": [{
+				"key": "a",
+				"doc_count": 3,
+				"sum":    {"value": 10},
+				"max":    {"value": 7},
+				"min":    {"value": 1},
+				"avg":    {"value": 3.5},
+				"count":  {"value": 3},
+				"value":  {"value": 42},
+				"values": {"value": 5},
+				"from":   {"value": 8}
+			}]
+		}
+	}`)
+	buckets := aggs.Get("types").Buckets()
+	if len(buckets) != 1 {
+		t.Fatalf("buckets = %d, want 1", len(buckets))
+	}
+	b := buckets[0]
+	if b.KeyString() != "a" || b.DocCount != 3 || b.From != nil {
+		t.Fatalf("bucket = %+v", b)
+	}
+	for name, want := range map[string]float64{
+		"sum": 10, "max": 7, "min": 1, "avg": 3.5, "count": 3, "value": 42, "values": 5, "from": 8,
+	} {
+		assertValue(t, name, b.Get(name), want)
+	}
+}
+
+func TestAggregationStatsSubAggregationNamedSum(t *testing.T) {
+	aggs := decodeAggregations(t, `{
+		"types": {
+			"buckets": [{
+				"key": 1,
+				"doc_count": 2,
+				"sum": {"count": 2, "min": 1, "max": 3, "avg": 2, "sum": 4}
+			}]
+		}
+	}`)
+	stats, ok := aggs.Get("types").Buckets()[0].Get("sum").Stats()
+	if !ok {
+		t.Fatal("sum sub-aggregation has no stats")
+	}
+	if stats.Count != 2 || stats.Sum != 4 || *stats.Min != 1 || *stats.Max != 3 || *stats.Avg != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestAggregationSingleBucketWithCountAndSumSubAggregations(t *testing.T) {
+	aggs := decodeAggregations(t, `{
+		"relations": {
+			"doc_count": 12,
+			"count": {"value": 12},
+			"sum":   {"value": 30}
+		}
+	}`)
+	r := aggs.Get("relations")
+	if r.DocCount() != 12 {
+		t.Fatalf("doc_count = %d", r.DocCount())
+	}
+	if _, ok := r.Stats(); ok {
+		t.Fatal("count and sum sub-aggregations decoded as stats")
+	}
+	assertValue(t, "count", r.Get("count"), 12)
+	assertValue(t, "sum", r.Get("sum"), 30)
+}
+
+func TestAggregationMetrics(t *testing.T) {
+	aggs := decodeAggregations(t, `{
+		"avg_score":  {"value": 1.5},
+		"empty_max":  {"value": null},
+		"latest":     {"value": 1600000000000, "value_as_string": "2020-09-13T12:26:40.000Z"},
+		"score_stats": {"count": 0, "min": null, "max": null, "avg": null, "sum": 0.0},
+		"latency":    {"values": {"50.0": 12.5, "95.0": 40, "99.9": null, "95.0_as_string": "40"}},
+		"latency_list": {"values": [{"key": 50, "value": 12.5}, {"key": 99.9, "value": 80}]},
+		"top": {"hits": {"total": {"value": 1, "relation": "eq"}, "max_score": 1, "hits": [
+			{"_index": "zeus", "_id": "1", "_score": 1, "_source": {"entity_id": "e1", "entity_type": 2}}
+		]}},
+		"with_meta": {"meta": {"owner": "zeus"}, "value": 3}
+	}`)
+	assertValue(t, "avg_score", aggs.Get("avg_score"), 1.5)
+	if _, ok := aggs.Get("empty_max").Value(); ok {
+		t.Fatal("null value reported as present")
+	}
+	if got := aggs.Get("latest").ValueAsString(); got != "2020-09-13T12:26:40.000Z" {
+		t.Fatalf("value_as_string = %q", got)
+	}
+	stats, ok := aggs.Get("score_stats").Stats()
+	if !ok || stats.Count != 0 || stats.Min != nil || stats.Avg != nil {
+		t.Fatalf("stats = %+v, %v", stats, ok)
+	}
+	if v, ok := aggs.Get("latency").Percentile(95); !ok || v != 40 {
+		t.Fatalf("p95 = %v, %v", v, ok)
+	}
+	if _, ok := aggs.Get("latency").Percentile(99.9); ok {
+		t.Fatal("null percentile reported as present")
+	}
+	if aggs.Get("latency").Get("values") != nil {
+		t.Fatal("percentile values decoded as a sub-aggregation")
+	}
+	if v, ok := aggs.Get("latency_list").Percentile(99.9); !ok || v != 80 {
+		t.Fatalf("keyed=false p99.9 = %v, %v", v, ok)
+	}
+	hits, err := DecodeTopHits[Source](aggs.Get("top"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Source.EntityID != "e1" || hits[0].Source.EntityType != 2 {
+		t.Fatalf("top hits = %+v", hits)
+	}
+	if aggs.Get("with_meta").Get("meta") != nil {
+		t.Fatal("meta decoded as a sub-aggregation")
+	}
+	assertValue(t, "with_meta", aggs.Get("with_meta"), 3)
+}
+
+func TestAggregationBuckets(t *testing.T) {
+	aggs := decodeAggregations(t, `{
+		"per_day": {"buckets": [
+			{"key_as_string": "2020-01-01", "key": 1577836800000, "doc_count": 4,
+			 "types": {"buckets": [{"key": "x", "doc_count": 4}]}}
+		]},
+		"ranges": {"buckets": {
+			"low":  {"to": 10, "doc_count": 1},
+			"high": {"from": 10, "doc_count": 2}
+		}},
+		"filters": {"buckets": {"b": {"doc_count": 5}, "a": {"doc_count": 6}}},
+		"composite": {"after_key": {"type": 2}, "buckets": [{"key": {"type": 1}, "doc_count": 3}]}
+	}`)
+	day := aggs.Get("per_day").Buckets()[0]
+	if day.KeyString() != "2020-01-01" || day.DocCount != 4 {
+		t.Fatalf("date bucket = %+v", day)
+	}
+	if got := day.Get("types").Buckets()[0].KeyString(); got != "x" {
+		t.Fatalf("nested bucket key = %q", got)
+	}
+
+	ranges := aggs.Get("ranges").Buckets()
+	if len(ranges) != 2 || ranges[0].Key != "high" || *ranges[0].From != 10 || ranges[1].Key != "low" || *ranges[1].To != 10 {
+		t.Fatalf("range buckets = %+v", ranges)
+	}
+
+	filters := aggs.Get("filters").Buckets()
+	if len(filters) != 2 || filters[0].Key != "a" || filters[0].DocCount != 6 {
+		t.Fatalf("filters buckets = %+v", filters)
+	}
+
+	composite := aggs.Get("composite")
+	if key, ok := composite.Buckets()[0].Key.(map[string]interface{}); !ok || key["type"] != float64(1) {
+		t.Fatalf("composite key = %#v", composite.Buckets()[0].Key)
+	}
+	if composite.Buckets()[0].Aggregations != nil {
+		t.Fatal("composite key decoded as a sub-aggregation")
+	}
+	if composite.Get("after_key") == nil {
+		t.Fatal("after_key is not exposed")
+	}
+}
+
+func TestAggregationNilSafe(t *testing.T) {
+	var aggs Aggregations
+	r := aggs.Get("missing").Get("child")
+	if _, ok := r.Value(); ok || r.DocCount() != 0 || r.Buckets() != nil || r.Hits() != nil || r.Raw() != nil {
+		t.Fatal("nil aggregation result is not empty")
+	}
+	if hits, err := DecodeTopHits[Source](r); err != nil || hits != nil {
+		t.Fatalf("DecodeTopHits(nil) = %v, %v", hits, err)
+	}
+}
+
+func TestSearchWithSubAggregationNamedSum(t *testing.T) {
+	body := []byte(`{"took":1,"timed_out":false,"hits":{"total":{"value":2,"relation":"eq"},"max_score":null,"hits":[]},
+		"aggregations":{"types":{"buckets":[{"key":1,"doc_count":2,"sum":{"count":2,"min":1,"max":3,"avg":2,"sum":4},"value":{"value":9}}]}}}`)
+	client := newFixtureClient(t, http.StatusOK, body)
+	query, err := entityTypeAggQuery(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Search[Source](context.Background(), client, "zeus", query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket := result.Aggregations.Get("types").Buckets()[0]
+	if _, ok := bucket.Get("sum").Stats(); !ok {
+		t.Fatal("sum sub-aggregation has no stats")
+	}
+	assertValue(t, "value", bucket.Get("value"), 9)
+}
@@ -0,0 +1,72 @@
+package elasticsearch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFiltersAggregation(t *testing.T) {
+	agg := FiltersAgg().
+		Filter("people", Term("entity_type", 1)).
+		Filter("skipped", nil).
+		Filter("recent", Range("publish_time").Gte("now-7d")).
+		SubAggregation("avg_score", AvgAgg("signals.score"))
+	assertGoldenJSON(t, "filters", agg.Map(), nil, `{
+		"filters": {"filters": {
+			"people": {"term": {"entity_type": 1}},
+			"recent": {"range": {"publish_time": {"gte": "now-7d"}}}}},
+		"aggs": {"avg_score": {"avg": {"field": "signals.score"}}}}`)
+
+	body, err := NewSearchBody().Size(0).Aggregation("groups", agg).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body["aggs"].(map[string]interface{})["groups"]; !ok {
+		t.Fatalf("body = %v", body)
+	}
+}
+
+func TestAggregationValidate(t *testing.T) {
+	invalidQuery := FunctionScore(MatchAll())
+	tests := []struct {
+		name string
+		agg  Aggregation
+		want string
+	}{
+		{name: "nil aggregation", agg: nil, want: "aggregation groups can not be nil"},
+		{name: "filters without filter", agg: FiltersAgg().Filter("none", nil), want: "requires at least one filter"},
+		{name: "invalid filter", agg: FiltersAgg().Filter("bad", invalidQuery), want: "aggregation groups: filter bad: function_score requires at least one function"},
+		{
+			name: "nil filter in bool",
+			agg:  FiltersAgg().Filter("bad", Bool().Must(nil)),
+			want: "filter bad: bool query clause can not be nil",
+		},
+		{
+			name: "invalid filter in sub aggregation",
+			agg:  TermsAgg("entity_type").SubAggregation("inner", FiltersAgg().Filter("bad", invalidQuery)),
+			want: "aggregation groups: aggregation inner: filter bad",
+		},
+		{
+			name: "nil sub aggregation",
+			agg:  NestedAgg("related_entities").SubAggregation("inner", nil),
+			want: "aggregation inner can not be nil",
+		},
+		{
+			name: "deeply nested",
+			agg: DateHistogramAgg("publish_time").SubAggregation("a",
+				HistogramAgg("score", 1).SubAggregation("b",
+					RangeAgg("score").SubAggregation("c",
+						ReverseNestedAgg().SubAggregation("d", FiltersAgg())))),
+			want: "aggregation a: aggregation b: aggregation c: aggregation d: filters aggregation requires at least one filter",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewSearchBody().Aggregation("groups", tt.agg)
+			b.Map()
+			if _, err := b.Build(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+)
+
+// ================================ bulk 返回解析 ================================
+
+// BulkResponseItem bulk 请求中单条操作的结果
+type BulkResponseItem struct {
+	// index、create、update、delete
+	Action  string      `json:"-"`
+	Index   string      `json:"_index"`
+	ID      string      `json:"_id"`
+	Version int64       `json:"_version"`
+	Result  string      `json:"result"`
+	Status  int         `json:"status"`
+	Error   *ErrorCause `json:"error,omitempty"`
+}
+
+// Failed 该条操作是否失败
+func (i BulkResponseItem) Failed() bool {
+	return i.Status > 201 || i.Error != nil
+}
+
+// Err 失败时返回 *ESError，成功时返回 nil
+func (i BulkResponseItem) Err() error {
+	if !i.Failed() {
+		return nil
+	}
+	esErr := &ESError{Status: i.Status, Index: i.Index}
+	if i.Error != nil {
+		esErr.Type = i.Error.Type
+		esErr.Reason = i.Error.Reason
+	} else {
+		esErr.Reason = i.Result
+	}
+	return esErr
+}
+
+// BulkResult 一次或多次 bulk 请求的汇总结果
+type BulkResult struct {
+	NumRequests  int
+	NumSucceeded int
+	NumFailed    int
+	// 失败的操作，包括 action、_id、status 和错误原因
+	Failed []BulkResponseItem
+}
+
+// add 累加一条操作的结果
+func (r *BulkResult) add(item BulkResponseItem) {
+	if item.Failed() {
+		r.NumFailed++
+		r.Failed = append(r.Failed, item)
+		return
+	}
+	r.NumSucceeded++
+}
+
+// merge 合并另一次 bulk 请求的结果
+func (r *BulkResult) merge(other *BulkResult) {
+	if other == nil {
+		return
+	}
+	r.NumRequests += other.NumRequests
+	r.NumSucceeded += other.NumSucceeded
+	r.NumFailed += other.NumFailed
+	r.Failed = append(r.Failed, other.Failed...)
+}
+
+// bulkOptions performESInsert、performESUpsert、performESDelete 的可选参数
+type bulkOptions struct {
+	onSuccess   func(item BulkResponseItem)
+	onFailure   func(item BulkResponseItem, err error)
+	retryPolicy RetryPolicy
+	compress    bool
+}
+
+// BulkOption 批量操作的可选参数
+type BulkOption func(*bulkOptions)
+
+// WithOnSuccess 每条操作成功时回调
+func WithOnSuccess(fn func(item BulkResponseItem)) BulkOption {
+	return func(o *bulkOptions) {
+		o.onSuccess = fn
+	}
+}
+
+// WithOnFailure 每条操作失败时回调，err 为 *ESError
+func WithOnFailure(fn func(item BulkResponseItem, err error)) BulkOption {
+	return func(o *bulkOptions) {
+		o.onFailure = fn
+	}
+}
+
+// WithRetryPolicy 指定重试策略，只会重新发送失败的操作，默认使用 DefaultRetryPolicy
+func WithRetryPolicy(policy RetryPolicy) BulkOption {
+	return func(o *bulkOptions) {
+		o.retryPolicy = policy
+	}
+}
+
+// WithCompression 使用 gzip 压缩请求体，适合大批量写入并且带宽有限的场景
+func WithCompression(compress bool) BulkOption {
+	return func(o *bulkOptions) {
+		o.compress = compress
+	}
+}
+
+func newBulkOptions(opts []BulkOption) *bulkOptions {
+	o := &bulkOptions{retryPolicy: DefaultRetryPolicy}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// bulkResponse bulk 请求的返回，items 中每一项都是 {action: 结果}，顺序与请求一致
+type bulkResponse struct {
+	Took   int                           `json:"took"`
+	Errors bool                          `json:"errors"`
+	Items  []map[string]BulkResponseItem `json:"items"`
+}
+
+// parseBulkResponse 按请求顺序解析每条操作的结果
+func parseBulkResponse(body io.Reader) ([]BulkResponseItem, error) {
+	var blk bulkResponse
+	if err := decodeBody(body, &blk); err != nil {
+		return nil, err
+	}
+	items := make([]BulkResponseItem, 0, len(blk.Items))
+	for _, entry := range blk.Items {
+		for action, item := range entry {
+			item.Action = action
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// sendBulk 发送 bulk 请求，整个请求失败或者单条操作返回可重试的状态码时，只重新发送失败的操作。
+// 请求体流式输出，compress 为 true 时使用 gzip 压缩请求体。
+// 每条操作最终的结果都会回调 handle，成功时 err 为 nil；返回值为发送的请求次数和整个请求失败时的错误
+func sendBulk(ctx context.Context, transport esapi.Transport, index, refresh string, compress bool, items []*bulkItem, policy RetryPolicy, handle func(item *bulkItem, res BulkResponseItem, err error)) (int, error) {
+	failAll := func(pending []*bulkItem, err error) {
+		for _, item := range pending {
+			result := BulkResponseItem{
+				Action: item.item.Action,
+				Index:  item.item.Index,
+				ID:     item.item.DocumentID,
+				Error:  &ErrorCause{Reason: err.Error()},
+			}
+			var esErr *ESError
+			if errors.As(err, &esErr) {
+				result.Status = esErr.Status
+				result.Error.Type = esErr.Type
+			}
+			handle(item, result, err)
+		}
+	}
+
+	pending := items
+	requests := 0
+	for attempt := 1; ; attempt++ {
+		body := newBulkBody(pending, compress)
+		req := esapi.BulkRequest{
+			Index:   index,
+			Body:    body,
+			Refresh: refresh,
+		}
+		if compress {
+			req.Header = http.Header{"Content-Encoding": []string{"gzip"}}
+		}
+		requests++
+		res, err := req.Do(ctx, transport)
+		body.Close()
+		if err == nil && res.IsError() {
+			esErr := newESError(res)
+			res.Body.Close()
+			if policy.retryableStatus(esErr.Status) {
+				err = esErr
+			} else {
+				failAll(pending, esErr)
+				return requests, errors.WithStack(esErr)
+			}
+		}
+		if err != nil {
+			if !policy.canRetry(ctx, attempt) {
+				failAll(pending, err)
+				return requests, errors.WithStack(err)
+			}
+			if werr := policy.wait(ctx, attempt, err); werr != nil {
+				failAll(pending, werr)
+				return requests, werr
+			}
+			continue
+		}
+
+		results, err := parseBulkResponse(res.Body)
+		res.Body.Close()
+		if err == nil && len(results) != len(pending) {
+			err = fmt.Errorf("bulk response has %d items, expected %d", len(results), len(pending))
+		}
+		if err != nil {
+			failAll(pending, err)
+			return requests, err
+		}
+
+		retry := make([]*bulkItem, 0)
+		for i, result := range results {
+			if result.Failed() && policy.retryableStatus(result.Status) && policy.canRetry(ctx, attempt) {
+				retry = append(retry, pending[i])
+				continue
+			}
+			handle(pending[i], result, result.Err())
+		}
+		if len(retry) == 0 {
+			return requests, nil
+		}
+		if werr := policy.wait(ctx, attempt, fmt.Errorf("%d of %d bulk items failed with a retryable status", len(retry), len(pending))); werr != nil {
+			failAll(retry, werr)
+			return requests, werr
+		}
+		pending = retry
+	}
+}
@@ -0,0 +1,56 @@
+package elasticsearch
+
+import (
+	"compress/gzip"
+	"io"
+	"net"
+	"sync"
+)
+
+// ================================ 流式 bulk 请求体 ================================
+
+var newline = []byte{'\n'}
+
+// gzip.Writer 内部的缓冲区比较大，复用可以减少内存分配
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// newBulkBody 按 NDJSON 格式输出批量操作，直接引用每条操作已经编码好的内容，不会再复制出一份完整的请求体。
+// compress 为 true 时边读边 gzip 压缩，压缩后的请求体也不会完整保存在内存中。
+// 使用完需要 Close，否则压缩的 goroutine 会一直阻塞；客户端开启自带的重试时会把请求体读到内存中，需要关闭
+func newBulkBody(items []*bulkItem, compress bool) io.ReadCloser {
+	buffers := make(net.Buffers, 0, len(items)*4)
+	for _, item := range items {
+		buffers = append(buffers, item.meta, newline)
+		if item.body != nil {
+			buffers = append(buffers, item.body, newline)
+		}
+	}
+	if !compress {
+		return io.NopCloser(&buffers)
+	}
+
+	return gzipStream(io.NopCloser(&buffers))
+}
+
+// gzipStream 边读 src 边压缩，压缩后的内容不会完整保存在内存中；src 读完或者返回的 reader 被关闭后关闭 src。
+// 使用完需要 Close，否则压缩的 goroutine 会一直阻塞
+func gzipStream(src io.ReadCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		defer src.Close()
+		zw := gzipWriterPool.Get().(*gzip.Writer)
+		defer gzipWriterPool.Put(zw)
+		zw.Reset(pw)
+		_, err := io.Copy(zw, src)
+		if err == nil {
+			err = zw.Close()
+		}
+		// 读取方关闭后 err 为 io.ErrClosedPipe，直接结束
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
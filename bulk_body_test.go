@@ -0,0 +1,91 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// expectedNDJSON 测试数据对应的 ndjson 请求体
+const expectedNDJSON = `{"index":{"_id":"1","_index":"zeus"}}
+{"entity_id":"1","entity_type":0,"related_entities":null}
+{"create":{"_id":"2","_index":"zeus"}}
+{"entity_id":"2","entity_type":0,"related_entities":null}
+{"update":{"_id":"3","_index":"zeus"}}
+{"doc":{"entity_id":"3","entity_type":0,"related_entities":null}}
+{"delete":{"_id":"4","_index":"zeus"}}
+`
+
+func TestBulkBody(t *testing.T) {
+	body := newBulkBody(testBulkItems(t), false)
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expectedNDJSON {
+		t.Fatalf("body = %s\nwant %s", data, expectedNDJSON)
+	}
+}
+
+func TestBulkBodyGzipRoundTrip(t *testing.T) {
+	// 用同一个 pool 里的 gzip.Writer 连续压缩几次，确认复用后的 writer 输出依然正确
+	for i := 0; i < 3; i++ {
+		body := newBulkBody(testBulkItems(t), true)
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body.Close()
+		if string(data) != expectedNDJSON {
+			t.Fatalf("round %d: gunzipped body = %s\nwant %s", i, data, expectedNDJSON)
+		}
+	}
+}
+
+func TestGzipStreamLargeInput(t *testing.T) {
+	var src bytes.Buffer
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&src, `{"index":{"_id":"%d"}}`+"\n", i)
+	}
+	want := src.String()
+	zr, err := gzip.NewReader(gzipStream(io.NopCloser(&src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Fatalf("gunzipped %d bytes, want %d", len(data), len(want))
+	}
+}
+
+// closeRecorder 记录是否被关闭的 reader
+type closeRecorder struct {
+	io.Reader
+	closed chan struct{}
+}
+
+func (r *closeRecorder) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func TestGzipStreamCloseBeforeRead(t *testing.T) {
+	src := &closeRecorder{Reader: strings.NewReader(strings.Repeat("x", 1<<20)), closed: make(chan struct{})}
+	body := gzipStream(src)
+	if err := body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// 读取方关闭后压缩的 goroutine 结束并关闭 src
+	<-src.closed
+}
@@ -0,0 +1,359 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/pkg/errors"
+)
+
+// ================================ 常驻的并发批量写入 ================================
+
+// BulkIndexer 默认配置
+const (
+	defaultFlushActions  = 1000
+	defaultFlushBytes    = 5 * 1024 * 1024
+	defaultFlushInterval = 30 * time.Second
+)
+
+// BulkIndexerConfig 批量写入配置，满足条数、字节数、时间间隔任意一个条件就发送一次 bulk 请求
+type BulkIndexerConfig struct {
+	Client *elasticsearch.Client
+	// 默认索引，BulkIndexerItem 中没有指定索引时使用
+	Index string
+	// 并发发送 bulk 请求的 goroutine 数量，默认 CPU 核数
+	NumWorkers int
+	// 每个 worker 缓存多少条后发送，默认 1000
+	FlushActions int
+	// 每个 worker 缓存多少字节后发送，默认 5MB
+	FlushBytes int
+	// 距离上次发送超过多久强制发送，默认 30s；条数或字节数触发的发送也会重新计时
+	FlushInterval time.Duration
+	// bulk 请求的 refresh 参数，默认 false
+	Refresh string
+	// 重试策略，默认 DefaultRetryPolicy
+	RetryPolicy *RetryPolicy
+	// 使用 gzip 压缩请求体
+	CompressRequestBody bool
+}
+
+// BulkIndexerItem 一条批量操作
+type BulkIndexerItem struct {
+	// index、create、update、delete
+	Action     string
+	Index      string
+	DocumentID string
+	Routing    string
+	// 外部版本号，使用 version_type=external，update 操作不支持
+	Version *int64
+	// update 时版本冲突的重试次数
+	RetryOnConflict int
+	// 乐观锁，文档当前的 _seq_no 和 _primary_term 与之不同时操作失败（409），两个需要同时设置
+	IfSeqNo       *int64
+	IfPrimaryTerm *int64
+	// 文档内容，会被序列化成 json；update 时为 {"doc": ...} 或 {"script": *Script} 这样的更新体；delete 时不需要
+	Body interface{}
+
+	// 该条操作成功或失败时回调，在 worker goroutine 中执行
+	OnSuccess func(item BulkIndexerItem, res BulkResponseItem)
+	OnFailure func(item BulkIndexerItem, res BulkResponseItem, err error)
+}
+
+// BulkIndexerStats 批量写入统计，NumSucceeded + NumFailed 为已经有结果的条数，
+// Close 正常返回后等于 NumAdded
+type BulkIndexerStats struct {
+	// Add 成功排队的条数
+	NumAdded uint64
+	// 写入成功的条数，按 action 细分为 NumIndexed、NumCreated、NumUpdated、NumDeleted
+	NumSucceeded uint64
+	// 最终失败的条数（重试之后），每条都会回调 OnFailure
+	NumFailed  uint64
+	NumIndexed uint64
+	NumCreated uint64
+	NumUpdated uint64
+	NumDeleted uint64
+	// 发送的 bulk 请求次数，包括重试
+	NumRequests uint64
+}
+
+// BulkIndexer 常驻的批量写入器，Add 只负责排队，由后台 worker 按条件批量发送
+type BulkIndexer struct {
+	config BulkIndexerConfig
+	queue  chan *bulkItem
+	wg     sync.WaitGroup
+	// 发送 bulk 请求用的 ctx，Close 超时时取消，正在进行的请求和重试等待会立即结束
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+
+	stats struct {
+		numAdded     uint64
+		numSucceeded uint64
+		numFailed    uint64
+		numIndexed   uint64
+		numCreated   uint64
+		numUpdated   uint64
+		numDeleted   uint64
+		numRequests  uint64
+	}
+}
+
+// bulkItem 已经编码好的一条批量操作，meta 和 body 都不带换行
+type bulkItem struct {
+	item BulkIndexerItem
+	meta []byte
+	body []byte
+}
+
+// size 写入请求体后占用的字节数
+func (i *bulkItem) size() int {
+	n := len(i.meta) + 1
+	if i.body != nil {
+		n += len(i.body) + 1
+	}
+	return n
+}
+
+// newBulkItem 编码 action 元数据行和文档行
+func newBulkItem(item BulkIndexerItem, defaultIndex string) (*bulkItem, error) {
+	switch item.Action {
+	case "index", "create", "update", "delete":
+	default:
+		return nil, fmt.Errorf("unsupported bulk action %q", item.Action)
+	}
+	if item.Action != "index" && item.Action != "create" && item.DocumentID == "" {
+		return nil, fmt.Errorf("bulk action %q requires a document id", item.Action)
+	}
+
+	params := map[string]interface{}{}
+	index := item.Index
+	if index == "" {
+		index = defaultIndex
+	}
+	if index != "" {
+		params["_index"] = index
+	}
+	if item.DocumentID != "" {
+		params["_id"] = item.DocumentID
+	}
+	if item.Routing != "" {
+		params["routing"] = item.Routing
+	}
+	if item.Version != nil {
+		if item.Action == "update" {
+			return nil, fmt.Errorf("bulk action \"update\" does not support external version")
+		}
+		params["version"] = *item.Version
+		params["version_type"] = "external"
+	}
+	if (item.IfSeqNo == nil) != (item.IfPrimaryTerm == nil) {
+		return nil, fmt.Errorf("bulk action %q requires both if_seq_no and if_primary_term", item.Action)
+	}
+	if item.IfSeqNo != nil {
+		params["if_seq_no"] = *item.IfSeqNo
+		params["if_primary_term"] = *item.IfPrimaryTerm
+	}
+	if item.Action == "update" && item.RetryOnConflict > 0 {
+		params["retry_on_conflict"] = item.RetryOnConflict
+	}
+	meta, err := json.Marshal(map[string]interface{}{item.Action: params})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	encoded := &bulkItem{item: item, meta: meta}
+	if item.Action == "delete" {
+		return encoded, nil
+	}
+	switch body := item.Body.(type) {
+	case nil:
+		return nil, fmt.Errorf("bulk action %q requires a body", item.Action)
+	case json.RawMessage:
+		encoded.body = body
+	case []byte:
+		encoded.body = body
+	default:
+		if encoded.body, err = json.Marshal(body); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return encoded, nil
+}
+
+// NewBulkIndexer 创建并启动 BulkIndexer，用完必须调用 Close
+func NewBulkIndexer(config BulkIndexerConfig) (*BulkIndexer, error) {
+	if config.Client == nil {
+		return nil, fmt.Errorf("BulkIndexerConfig.Client can not be nil")
+	}
+	if config.NumWorkers <= 0 {
+		config.NumWorkers = runtime.NumCPU()
+	}
+	if config.FlushActions <= 0 {
+		config.FlushActions = defaultFlushActions
+	}
+	if config.FlushBytes <= 0 {
+		config.FlushBytes = defaultFlushBytes
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultFlushInterval
+	}
+	if config.Refresh == "" {
+		config.Refresh = "false"
+	}
+	if config.RetryPolicy == nil {
+		policy := DefaultRetryPolicy
+		config.RetryPolicy = &policy
+	}
+
+	bi := &BulkIndexer{
+		config: config,
+		queue:  make(chan *bulkItem, config.NumWorkers),
+	}
+	bi.ctx, bi.cancel = context.WithCancel(context.Background())
+	for i := 0; i < config.NumWorkers; i++ {
+		bi.wg.Add(1)
+		go bi.worker()
+	}
+	return bi, nil
+}
+
+// Add 添加一条批量操作，队列满时阻塞直到 ctx 结束
+func (bi *BulkIndexer) Add(ctx context.Context, item BulkIndexerItem) error {
+	encoded, err := newBulkItem(item, bi.config.Index)
+	if err != nil {
+		return err
+	}
+
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+	if bi.closed {
+		return fmt.Errorf("bulk indexer is closed")
+	}
+	select {
+	case bi.queue <- encoded:
+		atomic.AddUint64(&bi.stats.numAdded, 1)
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// Close 停止接收新的操作，发送完所有缓存的数据后返回统计。
+// ctx 结束时取消正在进行的请求和重试，剩下的操作都按失败回调 OnFailure，等所有 worker 退出后返回 ctx 的错误
+func (bi *BulkIndexer) Close(ctx context.Context) (BulkIndexerStats, error) {
+	bi.mu.Lock()
+	if !bi.closed {
+		bi.closed = true
+		close(bi.queue)
+	}
+	bi.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		bi.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		bi.cancel()
+		return bi.Stats(), nil
+	case <-ctx.Done():
+		bi.cancel()
+		<-done
+		return bi.Stats(), errors.WithStack(ctx.Err())
+	}
+}
+
+// Stats 当前的统计
+func (bi *BulkIndexer) Stats() BulkIndexerStats {
+	return BulkIndexerStats{
+		NumAdded:     atomic.LoadUint64(&bi.stats.numAdded),
+		NumSucceeded: atomic.LoadUint64(&bi.stats.numSucceeded),
+		NumFailed:    atomic.LoadUint64(&bi.stats.numFailed),
+		NumIndexed:   atomic.LoadUint64(&bi.stats.numIndexed),
+		NumCreated:   atomic.LoadUint64(&bi.stats.numCreated),
+		NumUpdated:   atomic.LoadUint64(&bi.stats.numUpdated),
+		NumDeleted:   atomic.LoadUint64(&bi.stats.numDeleted),
+		NumRequests:  atomic.LoadUint64(&bi.stats.numRequests),
+	}
+}
+
+// worker 从队列中取数据缓存，满足条件时发送
+func (bi *BulkIndexer) worker() {
+	defer bi.wg.Done()
+
+	ticker := time.NewTicker(bi.config.FlushInterval)
+	defer ticker.Stop()
+
+	items := make([]*bulkItem, 0, bi.config.FlushActions)
+	size := 0
+	flush := func() {
+		if len(items) == 0 {
+			return
+		}
+		bi.flush(items)
+		items = make([]*bulkItem, 0, bi.config.FlushActions)
+		size = 0
+		// FlushInterval 从上次发送开始计算
+		ticker.Reset(bi.config.FlushInterval)
+	}
+
+	for {
+		select {
+		case item, ok := <-bi.queue:
+			if !ok {
+				flush()
+				return
+			}
+			// 加上这条会超过字节上限时先把已缓存的发出去
+			if len(items) > 0 && size+item.size() > bi.config.FlushBytes {
+				flush()
+			}
+			items = append(items, item)
+			size += item.size()
+			if len(items) >= bi.config.FlushActions || size >= bi.config.FlushBytes {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// flush 发送一次 bulk 请求并更新统计
+func (bi *BulkIndexer) flush(items []*bulkItem) {
+	requests, _ := sendBulk(bi.ctx, bi.config.Client, bi.config.Index, bi.config.Refresh, bi.config.CompressRequestBody, items, *bi.config.RetryPolicy,
+		func(encoded *bulkItem, result BulkResponseItem, err error) {
+			item := encoded.item
+			if err != nil {
+				atomic.AddUint64(&bi.stats.numFailed, 1)
+				if item.OnFailure != nil {
+					item.OnFailure(item, result, err)
+				}
+				return
+			}
+			atomic.AddUint64(&bi.stats.numSucceeded, 1)
+			switch result.Action {
+			case "index":
+				atomic.AddUint64(&bi.stats.numIndexed, 1)
+			case "create":
+				atomic.AddUint64(&bi.stats.numCreated, 1)
+			case "update":
+				atomic.AddUint64(&bi.stats.numUpdated, 1)
+			case "delete":
+				atomic.AddUint64(&bi.stats.numDeleted, 1)
+			}
+			if item.OnSuccess != nil {
+				item.OnSuccess(item, result)
+			}
+		})
+	atomic.AddUint64(&bi.stats.numRequests, uint64(requests))
+}
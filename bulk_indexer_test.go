@@ -0,0 +1,340 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bulkRequest 假的 bulk 接口收到的一次请求
+type bulkRequest struct {
+	at  time.Time
+	ids []string
+}
+
+// bulkRecorder 记录 bulk 请求，status 返回每条操作的状态码，为 nil 时都成功
+type bulkRecorder struct {
+	mu       sync.Mutex
+	requests []bulkRequest
+	status   func(id string) int
+}
+
+// transport 解析 ndjson 请求体，按顺序返回每条操作的结果
+func (r *bulkRecorder) transport(t testing.TB) roundTripFunc {
+	return func(req *http.Request) (int, string) {
+		if !strings.HasSuffix(req.URL.Path, "/_bulk") {
+			return http.StatusNotFound, `{"error":"unexpected request","status":404}`
+		}
+		data, _ := io.ReadAll(req.Body)
+		ids, items := parseBulkRequest(t, data, r.status)
+		r.mu.Lock()
+		r.requests = append(r.requests, bulkRequest{at: time.Now(), ids: ids})
+		r.mu.Unlock()
+		return http.StatusOK, fmt.Sprintf(`{"took":1,"errors":false,"items":[%s]}`, strings.Join(items, ","))
+	}
+}
+
+// parseBulkRequest 取出请求中每条操作的 id，并生成对应的返回
+func parseBulkRequest(t testing.TB, data []byte, status func(id string) int) ([]string, []string) {
+	var ids, items []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var meta map[string]struct {
+			ID string `json:"_id"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &meta); err != nil {
+			t.Errorf("bulk meta line %q: %v", scanner.Text(), err)
+			return nil, nil
+		}
+		for action, params := range meta {
+			code := http.StatusCreated
+			if status != nil {
+				code = status(params.ID)
+			}
+			ids = append(ids, params.ID)
+			switch {
+			case code >= 300:
+				items = append(items, fmt.Sprintf(`{%q:{"_index":"zeus","_id":%q,"status":%d,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}`, action, params.ID, code))
+			default:
+				items = append(items, fmt.Sprintf(`{%q:{"_index":"zeus","_id":%q,"_version":1,"result":"created","status":%d}}`, action, params.ID, code))
+			}
+			if action != "delete" {
+				scanner.Scan()
+			}
+		}
+	}
+	return ids, items
+}
+
+// batches 每次请求的条数
+func (r *bulkRecorder) batches() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sizes := make([]int, 0, len(r.requests))
+	for _, req := range r.requests {
+		sizes = append(sizes, len(req.ids))
+	}
+	return sizes
+}
+
+func (r *bulkRecorder) numRequests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func newTestBulkIndexer(t *testing.T, recorder *bulkRecorder, config BulkIndexerConfig) *BulkIndexer {
+	t.Helper()
+	config.Client = newTransportClient(t, recorder.transport(t))
+	config.Index = "zeus"
+	bi, err := NewBulkIndexer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bi
+}
+
+func addDocuments(t *testing.T, bi *BulkIndexer, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		if err := bi.Add(context.Background(), BulkIndexerItem{Action: "index", DocumentID: id, Body: Source{EntityID: id}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// waitFor 等待条件满足，超时后测试失败
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBulkIndexerFlushActions(t *testing.T) {
+	recorder := &bulkRecorder{}
+	bi := newTestBulkIndexer(t, recorder, BulkIndexerConfig{NumWorkers: 1, FlushActions: 2, FlushInterval: time.Hour})
+	addDocuments(t, bi, "1", "2", "3", "4", "5")
+	// 前两批由条数触发，不需要等 Close
+	waitFor(t, 2*time.Second, func() bool { return recorder.numRequests() == 2 })
+
+	stats, err := bi.Close(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(recorder.batches()); got != "[2 2 1]" {
+		t.Fatalf("batches = %s, want [2 2 1]", got)
+	}
+	want := BulkIndexerStats{NumAdded: 5, NumSucceeded: 5, NumIndexed: 5, NumRequests: 3}
+	if stats != want {
+		t.Fatalf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestBulkIndexerFlushBytes(t *testing.T) {
+	recorder := &bulkRecorder{}
+	item, err := newBulkItem(BulkIndexerItem{Action: "index", DocumentID: "1", Body: Source{EntityID: "1"}}, "zeus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 两条放得下，第三条会超过上限
+	bi := newTestBulkIndexer(t, recorder, BulkIndexerConfig{NumWorkers: 1, FlushBytes: item.size()*2 + 1, FlushInterval: time.Hour})
+	addDocuments(t, bi, "1", "2", "3", "4", "5")
+	if _, err := bi.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(recorder.batches()); got != "[2 2 1]" {
+		t.Fatalf("batches = %s, want [2 2 1]", got)
+	}
+}
+
+func TestBulkIndexerFlushInterval(t *testing.T) {
+	recorder := &bulkRecorder{}
+	bi := newTestBulkIndexer(t, recorder, BulkIndexerConfig{NumWorkers: 1, FlushInterval: 20 * time.Millisecond})
+	defer bi.Close(context.Background())
+	addDocuments(t, bi, "1")
+	waitFor(t, 2*time.Second, func() bool { return recorder.numRequests() == 1 })
+}
+
+func TestBulkIndexerFlushIntervalSinceLastSend(t *testing.T) {
+	const interval = 400 * time.Millisecond
+	recorder := &bulkRecorder{}
+	bi := newTestBulkIndexer(t, recorder, BulkIndexerConfig{NumWorkers: 1, FlushActions: 2, FlushInterval: interval})
+	defer bi.Close(context.Background())
+
+	// 快到间隔时由条数触发一次发送，之后的一条要再等一个完整的间隔
+	time.Sleep(interval * 3 / 4)
+	addDocuments(t, bi, "1", "2")
+	waitFor(t, 2*time.Second, func() bool { return recorder.numRequests() == 1 })
+	addDocuments(t, bi, "3")
+	waitFor(t, 2*time.Second, func() bool { return recorder.numRequests() == 2 })
+
+	recorder.mu.Lock()
+	gap := recorder.requests[1].at.Sub(recorder.requests[0].at)
+	recorder.mu.Unlock()
+	if gap < interval*3/4 {
+		t.Fatalf("interval flush %v after the last send, want about %v", gap, interval)
+	}
+}
+
+func TestBulkIndexerCloseDrainsQueue(t *testing.T) {
+	recorder := &bulkRecorder{}
+	bi := newTestBulkIndexer(t, recorder, BulkIndexerConfig{NumWorkers: 1, FlushInterval: time.Hour})
+	ids := make([]string, 10)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i)
+	}
+	addDocuments(t, bi, ids...)
+	if n := recorder.numRequests(); n != 0 {
+		t.Fatalf("%d requests before Close", n)
+	}
+	stats, err := bi.Close(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(recorder.batches()); got != "[10]" {
+		t.Fatalf("batches = %s, want [10]", got)
+	}
+	if stats.NumSucceeded != 10 || stats.NumIndexed != 10 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if err := bi.Add(context.Background(), BulkIndexerItem{Action: "index", Body: Source{}}); err == nil {
+		t.Fatal("Add succeeded after Close")
+	}
+}
+
+func TestBulkIndexerConcurrentAdd(t *testing.T) {
+	recorder := &bulkRecorder{}
+	bi := newTestBulkIndexer(t, recorder, BulkIndexerConfig{NumWorkers: 4, FlushActions: 7, FlushInterval: time.Hour})
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded = map[string]bool{}
+	)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 125; i++ {
+				id := fmt.Sprintf("%d-%d", g, i)
+				err := bi.Add(context.Background(), BulkIndexerItem{
+					Action:     "index",
+					DocumentID: id,
+					Body:       Source{EntityID: id},
+					OnSuccess: func(item BulkIndexerItem, res BulkResponseItem) {
+						mu.Lock()
+						succeeded[res.ID] = true
+						mu.Unlock()
+					},
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	stats, err := bi.Close(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NumAdded != 1000 || stats.NumSucceeded != 1000 || stats.NumFailed != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if len(succeeded) != 1000 {
+		t.Fatalf("OnSuccess called for %d documents, want 1000", len(succeeded))
+	}
+	total := 0
+	for _, n := range recorder.batches() {
+		if n > 7 {
+			t.Fatalf("batch of %d exceeds FlushActions", n)
+		}
+		total += n
+	}
+	if total != 1000 || uint64(recorder.numRequests()) != stats.NumRequests {
+		t.Fatalf("sent %d documents in %d requests, stats = %+v", total, recorder.numRequests(), stats)
+	}
+}
+
+func TestBulkIndexerStatsWithFailures(t *testing.T) {
+	recorder := &bulkRecorder{status: func(id string) int {
+		if id == "bad" {
+			return http.StatusBadRequest
+		}
+		return http.StatusCreated
+	}}
+	bi := newTestBulkIndexer(t, recorder, BulkIndexerConfig{NumWorkers: 1, FlushInterval: time.Hour})
+	var failed []string
+	addDocuments(t, bi, "1")
+	err := bi.Add(context.Background(), BulkIndexerItem{
+		Action:     "index",
+		DocumentID: "bad",
+		Body:       Source{},
+		OnFailure: func(item BulkIndexerItem, res BulkResponseItem, err error) {
+			failed = append(failed, fmt.Sprintf("%s:%d", item.DocumentID, res.Status))
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := bi.Close(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := BulkIndexerStats{NumAdded: 2, NumSucceeded: 1, NumFailed: 1, NumIndexed: 1, NumRequests: 1}
+	if stats != want {
+		t.Fatalf("stats = %+v, want %+v", stats, want)
+	}
+	if fmt.Sprint(failed) != "[bad:400]" {
+		t.Fatalf("failed = %v", failed)
+	}
+}
+
+func TestBulkIndexerCloseCancelsRetries(t *testing.T) {
+	recorder := &bulkRecorder{status: func(id string) int { return http.StatusTooManyRequests }}
+	bi := newTestBulkIndexer(t, recorder, BulkIndexerConfig{
+		NumWorkers:    1,
+		FlushInterval: time.Hour,
+		RetryPolicy:   &RetryPolicy{MaxAttempts: 100, InitialBackoff: time.Hour, RetryOnStatus: []int{429}},
+	})
+	var failures int
+	err := bi.Add(context.Background(), BulkIndexerItem{
+		Action:     "index",
+		DocumentID: "1",
+		Body:       Source{},
+		OnFailure: func(item BulkIndexerItem, res BulkResponseItem, err error) {
+			failures++
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	stats, err := bi.Close(ctx)
+	if err == nil {
+		t.Fatal("Close returned no error after ctx timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Close took %v, the retry backoff was not cancelled", elapsed)
+	}
+	if failures != 1 || stats.NumFailed != 1 || stats.NumRequests != 1 {
+		t.Fatalf("failures = %d, stats = %+v", failures, stats)
+	}
+}
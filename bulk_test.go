@@ -0,0 +1,142 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// testBulkItems 一条 index、一条 create、一条 update 和一条 delete
+func testBulkItems(t *testing.T) []*bulkItem {
+	t.Helper()
+	var items []*bulkItem
+	for _, item := range []BulkIndexerItem{
+		{Action: "index", DocumentID: "1", Body: Source{EntityID: "1"}},
+		{Action: "create", DocumentID: "2", Body: Source{EntityID: "2"}},
+		{Action: "update", DocumentID: "3", Body: map[string]interface{}{"doc": Source{EntityID: "3"}}},
+		{Action: "delete", DocumentID: "4"},
+	} {
+		encoded, err := newBulkItem(item, "zeus")
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, encoded)
+	}
+	return items
+}
+
+func TestPerformESBulkResponses(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		// 期望的结果，按 "action:_id:status" 格式
+		succeeded []string
+		failed    []string
+		// 失败的操作的错误类型，按 OnFailure 回调的顺序
+		errorTypes []string
+		wantErr    bool
+	}{
+		{
+			name:   "all succeeded",
+			status: http.StatusOK,
+			body: `{"took":3,"errors":false,"items":[
+				{"index":{"_index":"zeus","_id":"1","_version":1,"result":"created","status":201}},
+				{"create":{"_index":"zeus","_id":"2","_version":1,"result":"created","status":201}},
+				{"update":{"_index":"zeus","_id":"3","_version":2,"result":"updated","status":200}},
+				{"delete":{"_index":"zeus","_id":"4","_version":3,"result":"deleted","status":200}}]}`,
+			succeeded: []string{"index:1:201", "create:2:201", "update:3:200", "delete:4:200"},
+		},
+		{
+			name:   "partial failure",
+			status: http.StatusOK,
+			body: `{"took":3,"errors":true,"items":[
+				{"index":{"_index":"zeus","_id":"1","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [entity_type]"}}},
+				{"create":{"_index":"zeus","_id":"2","status":409,"error":{"type":"version_conflict_engine_exception","reason":"[2]: version conflict, document already exists"}}},
+				{"update":{"_index":"zeus","_id":"3","_version":2,"result":"noop","status":200}},
+				{"delete":{"_index":"zeus","_id":"4","_version":1,"result":"not_found","status":404}}]}`,
+			succeeded:  []string{"update:3:200"},
+			failed:     []string{"index:1:400", "create:2:409", "delete:4:404"},
+			errorTypes: []string{"mapper_parsing_exception", "version_conflict_engine_exception", ""},
+		},
+		{
+			name:       "request rejected",
+			status:     http.StatusBadRequest,
+			body:       `{"error":{"root_cause":[{"type":"illegal_argument_exception","reason":"Malformed action/metadata line [1]"}],"type":"illegal_argument_exception","reason":"Malformed action/metadata line [1]"},"status":400}`,
+			failed:     []string{"index:1:400", "create:2:400", "update:3:400", "delete:4:400"},
+			errorTypes: []string{"illegal_argument_exception", "illegal_argument_exception", "illegal_argument_exception", "illegal_argument_exception"},
+			wantErr:    true,
+		},
+		{
+			name:       "missing items",
+			status:     http.StatusOK,
+			body:       `{"took":3,"errors":false,"items":[{"index":{"_index":"zeus","_id":"1","result":"created","status":201}}]}`,
+			failed:     []string{"index:1:0", "create:2:0", "update:3:0", "delete:4:0"},
+			errorTypes: []string{"", "", "", ""},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := WrapClient(newFixtureClient(t, tt.status, []byte(tt.body)), nil)
+			var succeeded, failed, errorTypes []string
+			result, err := performESBulk(client, "zeus", testBulkItems(t), newBulkOptions([]BulkOption{
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+				WithOnSuccess(func(item BulkResponseItem) {
+					succeeded = append(succeeded, fmt.Sprintf("%s:%s:%d", item.Action, item.ID, item.Status))
+				}),
+				WithOnFailure(func(item BulkResponseItem, err error) {
+					failed = append(failed, fmt.Sprintf("%s:%s:%d", item.Action, item.ID, item.Status))
+					var esErr *ESError
+					if errors.As(err, &esErr) {
+						errorTypes = append(errorTypes, esErr.Type)
+					} else {
+						errorTypes = append(errorTypes, "")
+					}
+				}),
+			}))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if fmt.Sprint(succeeded) != fmt.Sprint(tt.succeeded) {
+				t.Fatalf("OnSuccess = %v, want %v", succeeded, tt.succeeded)
+			}
+			if fmt.Sprint(failed) != fmt.Sprint(tt.failed) {
+				t.Fatalf("OnFailure = %v, want %v", failed, tt.failed)
+			}
+			if fmt.Sprint(errorTypes) != fmt.Sprint(tt.errorTypes) {
+				t.Fatalf("error types = %q, want %q", errorTypes, tt.errorTypes)
+			}
+			if result.NumRequests != 1 || result.NumSucceeded != len(tt.succeeded) || result.NumFailed != len(tt.failed) || len(result.Failed) != len(tt.failed) {
+				t.Fatalf("result = %+v", result)
+			}
+		})
+	}
+}
+
+func TestParseBulkResponseKeepsRequestOrder(t *testing.T) {
+	body := `{"took":1,"errors":true,"items":[
+		{"delete":{"_index":"zeus","_id":"b","status":404,"result":"not_found"}},
+		{"index":{"_index":"zeus","_id":"a","status":201,"result":"created"}},
+		{"update":{"_index":"zeus","_id":"c","status":429,"error":{"type":"es_rejected_execution_exception","reason":"rejected execution"}}}]}`
+	items, err := parseBulkResponse(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, fmt.Sprintf("%s:%s:%v", item.Action, item.ID, item.Failed()))
+	}
+	if want := "[delete:b:true index:a:false update:c:true]"; fmt.Sprint(got) != want {
+		t.Fatalf("items = %v, want %s", got, want)
+	}
+	if !IsTooManyRequests(items[2].Err()) {
+		t.Fatalf("429 item error = %v", items[2].Err())
+	}
+	if !IsNotFound(items[0].Err()) || items[1].Err() != nil {
+		t.Fatalf("errors = %v, %v", items[0].Err(), items[1].Err())
+	}
+}
@@ -0,0 +1,153 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+)
+
+// ================================ 按查询条件更新、删除 ================================
+
+// ByQueryConfig update_by_query 和 delete_by_query 的参数
+type ByQueryConfig struct {
+	// 多个索引用逗号分隔
+	Index string
+	// 匹配的文档会被更新或删除，不能为空，需要处理全部文档时显式传 MatchAll()
+	Query Query
+	// 只用于 update_by_query，对每条匹配的文档执行；为空时只是按当前 mapping 重新索引文档
+	Script *Script
+	// 并行的 slice 数量，小于等于 0 时由 es 自动决定
+	Slices int
+	// 遇到版本冲突时跳过该文档继续执行，冲突数量记录在 TaskStatus.VersionConflicts 中；
+	// 为 false 时第一个冲突就会让任务失败
+	ProceedOnConflicts bool
+	// 每秒处理的文档数，小于等于 0 时不限速，执行中可以用 TaskHandle.Rethrottle 调整
+	RequestsPerSecond int
+	// 结束后刷新涉及的索引
+	Refresh bool
+}
+
+// validate 检查公共参数
+func (c ByQueryConfig) validate() error {
+	if c.Index == "" {
+		return fmt.Errorf("index can not be empty")
+	}
+	if c.Query == nil {
+		return fmt.Errorf("query can not be empty, use MatchAll() to match all documents")
+	}
+	if err := validateQuery(c.Query); err != nil {
+		return err
+	}
+	if c.Script != nil {
+		if err := c.Script.Validate(); err != nil {
+			return errors.Wrap(err, "by query script")
+		}
+	}
+	return nil
+}
+
+// slices slices 参数，默认 auto
+func (c ByQueryConfig) slices() interface{} {
+	if c.Slices > 0 {
+		return c.Slices
+	}
+	return "auto"
+}
+
+// conflicts conflicts 参数
+func (c ByQueryConfig) conflicts() string {
+	if c.ProceedOnConflicts {
+		return "proceed"
+	}
+	return "abort"
+}
+
+// UpdateByQuery 以异步任务的方式更新所有匹配的文档（wait_for_completion=false），
+// 返回的 TaskHandle 可以查询进度、调整速度或者取消，Wait 结束后 Status.Updated 为更新的数量
+//
+//	task, err := UpdateByQuery(ctx, client, ByQueryConfig{
+//		Index:              "zeus",
+//		Query:              Bool().Must(Match("entity_type", 1)),
+//		Script:             NewScript("ctx._source.status = params.status").Param("status", 2),
+//		ProceedOnConflicts: true,
+//	})
+func UpdateByQuery(ctx context.Context, client *elasticsearch.Client, config ByQueryConfig) (*TaskHandle, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{"query": config.Query.Map()}
+	if config.Script != nil {
+		body["script"] = config.Script.Map()
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	opts := []func(*esapi.UpdateByQueryRequest){
+		client.UpdateByQuery.WithContext(ctx),
+		client.UpdateByQuery.WithBody(bytes.NewReader(data)),
+		client.UpdateByQuery.WithWaitForCompletion(false),
+		client.UpdateByQuery.WithSlices(config.slices()),
+		client.UpdateByQuery.WithConflicts(config.conflicts()),
+		client.UpdateByQuery.WithRefresh(config.Refresh),
+	}
+	if config.RequestsPerSecond > 0 {
+		opts = append(opts, client.UpdateByQuery.WithRequestsPerSecond(config.RequestsPerSecond))
+	}
+	res, err := client.UpdateByQuery([]string{config.Index}, opts...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return newTaskHandle(client, "update_by_query", res)
+}
+
+// DeleteByQuery 以异步任务的方式删除所有匹配的文档（wait_for_completion=false），
+// 返回的 TaskHandle 可以查询进度、调整速度或者取消，Wait 结束后 Status.Deleted 为删除的数量
+func DeleteByQuery(ctx context.Context, client *elasticsearch.Client, config ByQueryConfig) (*TaskHandle, error) {
+	if config.Script != nil {
+		return nil, fmt.Errorf("delete_by_query does not support script")
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(map[string]interface{}{"query": config.Query.Map()})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	opts := []func(*esapi.DeleteByQueryRequest){
+		client.DeleteByQuery.WithContext(ctx),
+		client.DeleteByQuery.WithWaitForCompletion(false),
+		client.DeleteByQuery.WithSlices(config.slices()),
+		client.DeleteByQuery.WithConflicts(config.conflicts()),
+		client.DeleteByQuery.WithRefresh(config.Refresh),
+	}
+	if config.RequestsPerSecond > 0 {
+		opts = append(opts, client.DeleteByQuery.WithRequestsPerSecond(config.RequestsPerSecond))
+	}
+	res, err := client.DeleteByQuery([]string{config.Index}, bytes.NewReader(data), opts...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return newTaskHandle(client, "delete_by_query", res)
+}
+
+// newTaskHandle 从 wait_for_completion=false 的返回中取出任务 id
+func newTaskHandle(client *elasticsearch.Client, action string, res *esapi.Response) (*TaskHandle, error) {
+	var r struct {
+		Task string `json:"task"`
+	}
+	if err := decodeResponse(res, &r); err != nil {
+		return nil, err
+	}
+	if r.Task == "" {
+		return nil, fmt.Errorf("no task id returned by %s", action)
+	}
+	return &TaskHandle{ID: r.Task, Action: action, client: client}, nil
+}
@@ -0,0 +1,350 @@
+package elasticsearch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ================================ 客户端配置 ================================
+
+// 配置文件中各环境配置所在的字段
+const profilesKey = "profiles"
+
+// Config 客户端配置，可以从 yaml/json 配置文件和 ES_* 环境变量中读取，环境变量优先
+//
+//	addresses: ["https://es-dev:9200"]
+//	username: elastic
+//	profiles:
+//	  prod:
+//	    addresses: ["https://es-prod-1:9200", "https://es-prod-2:9200"]
+//	    ca_cert: /etc/es/ca.pem
+type Config struct {
+	Addresses []string `json:"addresses" yaml:"addresses"`
+	Username  string   `json:"username" yaml:"username"`
+	Password  string   `json:"password" yaml:"password"`
+	// API Key 认证，不能和用户名密码同时设置
+	APIKey  string `json:"api_key" yaml:"api_key"`
+	CloudID string `json:"cloud_id" yaml:"cloud_id"`
+
+	// CA 证书、客户端证书和私钥的路径
+	CACert     string `json:"ca_cert" yaml:"ca_cert"`
+	ClientCert string `json:"client_cert" yaml:"client_cert"`
+	ClientKey  string `json:"client_key" yaml:"client_key"`
+	// 只允许在本地开发时打开
+	InsecureSkipVerify bool `json:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+
+	DialTimeout           Duration `json:"dial_timeout" yaml:"dial_timeout"`
+	ResponseHeaderTimeout Duration `json:"response_header_timeout" yaml:"response_header_timeout"`
+	MaxIdleConnsPerHost   int      `json:"max_idle_conns_per_host" yaml:"max_idle_conns_per_host"`
+	// 用 gzip 压缩请求体，适合 bulk 等大请求；返回内容的 gzip 解压由 http.Transport 自动处理，和该配置无关
+	Compression bool `json:"compression" yaml:"compression"`
+
+	// 配置文件或者 ES_ADDRESSES 中显式设置了 addresses，为 false 时 Addresses 是默认地址
+	addressesSet bool
+}
+
+// Duration 配置文件中的时间，支持 "30s" 这样的字符串或者毫秒数
+type Duration time.Duration
+
+// UnmarshalJSON 实现 json.Unmarshaler 接口
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = Duration(v)
+		return nil
+	}
+	var ms int64
+	if err := json.Unmarshal(data, &ms); err != nil {
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	*d = Duration(time.Duration(ms) * time.Millisecond)
+	return nil
+}
+
+// DefaultConfig 默认配置
+func DefaultConfig() *Config {
+	return &Config{
+		Addresses:             []string{"http://127.0.0.1:9200"},
+		DialTimeout:           Duration(time.Second),
+		ResponseHeaderTimeout: Duration(30 * time.Second),
+		MaxIdleConnsPerHost:   10,
+	}
+}
+
+// LoadConfig 读取配置：默认配置 < 配置文件 < 配置文件中 profile 对应的环境配置 < ES_* 环境变量。
+// path 为空时只读取环境变量；profile 为空时不使用环境配置。
+// 设置了 cloud_id（配置文件或 ES_CLOUD_ID）时只会去掉默认地址，配置文件或 ES_ADDRESSES 中显式设置的
+// addresses 不会被清空，两者同时存在时 Validate 返回错误，需要去掉其中一个
+func LoadConfig(path, profile string) (*Config, error) {
+	cfg := DefaultConfig()
+	if path != "" {
+		if err := cfg.loadFile(path, profile); err != nil {
+			return nil, err
+		}
+	} else if profile != "" {
+		return nil, fmt.Errorf("profile %q requires a config file", profile)
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadConfigFromEnv 根据 ES_CONFIG_FILE 和 ES_PROFILE 环境变量读取配置
+func LoadConfigFromEnv() (*Config, error) {
+	return LoadConfig(os.Getenv("ES_CONFIG_FILE"), os.Getenv("ES_PROFILE"))
+}
+
+// loadFile 读取配置文件，profile 中的字段覆盖顶层字段
+func (c *Config) loadFile(path, profile string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "read config file %s", path)
+	}
+
+	values := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".json":
+		err = json.Unmarshal(data, &values)
+	default:
+		return fmt.Errorf("unsupported config file %s, must be .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "parse config file %s", path)
+	}
+
+	profiles, _ := values[profilesKey].(map[string]interface{})
+	delete(values, profilesKey)
+	if profile != "" {
+		overrides, ok := profiles[profile].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("profile %q not found in config file %s", profile, path)
+		}
+		for k, v := range overrides {
+			values[k] = v
+		}
+	}
+
+	// 统一转成 json 再解析，yaml 和 json 共用一套字段名
+	merged, err := json.Marshal(values)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := json.Unmarshal(merged, c); err != nil {
+		return errors.Wrapf(err, "parse config file %s", path)
+	}
+	if _, ok := values["addresses"]; ok {
+		c.addressesSet = true
+	}
+	c.clearDefaultAddresses()
+	return nil
+}
+
+// clearDefaultAddresses 设置了 cloud_id 并且没有显式设置 addresses 时，不再使用默认地址
+func (c *Config) clearDefaultAddresses() {
+	if c.CloudID != "" && !c.addressesSet {
+		c.Addresses = nil
+	}
+}
+
+// loadEnv 读取 ES_* 环境变量
+func (c *Config) loadEnv() error {
+	if v, ok := os.LookupEnv("ES_ADDRESSES"); ok {
+		c.addressesSet = true
+		c.Addresses = nil
+		for _, addr := range strings.Split(v, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				c.Addresses = append(c.Addresses, addr)
+			}
+		}
+	}
+	stringEnvs := map[string]*string{
+		"ES_USERNAME":    &c.Username,
+		"ES_PASSWORD":    &c.Password,
+		"ES_API_KEY":     &c.APIKey,
+		"ES_CLOUD_ID":    &c.CloudID,
+		"ES_CA_CERT":     &c.CACert,
+		"ES_CLIENT_CERT": &c.ClientCert,
+		"ES_CLIENT_KEY":  &c.ClientKey,
+	}
+	for key, field := range stringEnvs {
+		if v, ok := os.LookupEnv(key); ok {
+			*field = v
+		}
+	}
+	c.clearDefaultAddresses()
+
+	boolEnvs := map[string]*bool{
+		"ES_INSECURE_SKIP_VERIFY": &c.InsecureSkipVerify,
+		"ES_COMPRESSION":          &c.Compression,
+	}
+	for key, field := range boolEnvs {
+		if v, ok := os.LookupEnv(key); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %s", key, err)
+			}
+			*field = b
+		}
+	}
+
+	durationEnvs := map[string]*Duration{
+		"ES_DIAL_TIMEOUT":            &c.DialTimeout,
+		"ES_RESPONSE_HEADER_TIMEOUT": &c.ResponseHeaderTimeout,
+	}
+	for key, field := range durationEnvs {
+		if v, ok := os.LookupEnv(key); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %s", key, err)
+			}
+			*field = Duration(d)
+		}
+	}
+
+	if v, ok := os.LookupEnv("ES_MAX_IDLE_CONNS_PER_HOST"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid ES_MAX_IDLE_CONNS_PER_HOST: %s", err)
+		}
+		c.MaxIdleConnsPerHost = n
+	}
+	return nil
+}
+
+// Validate 校验配置
+func (c *Config) Validate() error {
+	if len(c.Addresses) == 0 && c.CloudID == "" {
+		return fmt.Errorf("either addresses or cloud_id must be set")
+	}
+	if len(c.Addresses) > 0 && c.CloudID != "" {
+		return fmt.Errorf("addresses and cloud_id can not be set at the same time, remove one of them from the config file or ES_* environment variables")
+	}
+	for _, addr := range c.Addresses {
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid address %q, must be like https://host:9200", addr)
+		}
+	}
+	if (c.Username == "") != (c.Password == "") {
+		return fmt.Errorf("username and password must be set together")
+	}
+	if c.APIKey != "" && c.Username != "" {
+		return fmt.Errorf("api_key and username/password can not be set at the same time")
+	}
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return fmt.Errorf("client_cert and client_key must be set together")
+	}
+	if c.DialTimeout < 0 || c.ResponseHeaderTimeout < 0 {
+		return fmt.Errorf("timeouts can not be negative")
+	}
+	if c.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("max_idle_conns_per_host can not be negative")
+	}
+	return nil
+}
+
+// tlsConfig 根据证书配置生成 TLS 配置，最低 TLS 1.2
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CACert != "" {
+		pem, err := os.ReadFile(c.CACert)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read ca_cert %s", c.CACert)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in ca_cert %s", c.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "load client_cert and client_key")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// NewClient 根据配置创建 ESClient
+func (c *Config) NewClient() (*elasticsearch.Client, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: c.Addresses,
+		Username:  c.Username,
+		Password:  c.Password,
+		APIKey:    c.APIKey,
+		CloudID:   c.CloudID,
+		// 重试由 RetryPolicy 统一控制，避免和客户端自带的重试叠加
+		DisableRetry: true,
+		Transport:    c.transport(tlsConfig),
+	})
+}
+
+// transport 根据配置创建 http.RoundTripper
+func (c *Config) transport(tlsConfig *tls.Config) http.RoundTripper {
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		ResponseHeaderTimeout: time.Duration(c.ResponseHeaderTimeout),
+		DialContext:           (&net.Dialer{Timeout: time.Duration(c.DialTimeout)}).DialContext,
+		TLSClientConfig:       tlsConfig,
+	}
+	if c.Compression {
+		transport = &gzipRequestTransport{next: transport}
+	}
+	return transport
+}
+
+// gzipRequestTransport 用 gzip 压缩请求体，已经设置了 Content-Encoding 的请求（例如压缩过的 bulk）原样发送
+type gzipRequestTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip 实现 http.RoundTripper 接口
+func (t *gzipRequestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+		return t.next.RoundTrip(req)
+	}
+	compressed := req.Clone(req.Context())
+	compressed.Body = gzipStream(req.Body)
+	compressed.GetBody = nil
+	compressed.ContentLength = -1
+	compressed.Header.Del("Content-Length")
+	compressed.Header.Set("Content-Encoding", "gzip")
+	return t.next.RoundTrip(compressed)
+}
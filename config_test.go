@@ -0,0 +1,406 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// esEnvs loadEnv 读取的全部环境变量
+var esEnvs = []string{
+	"ES_ADDRESSES", "ES_USERNAME", "ES_PASSWORD", "ES_API_KEY", "ES_CLOUD_ID", "ES_CA_CERT", "ES_CLIENT_CERT",
+	"ES_CLIENT_KEY", "ES_INSECURE_SKIP_VERIFY", "ES_COMPRESSION", "ES_DIAL_TIMEOUT", "ES_RESPONSE_HEADER_TIMEOUT",
+	"ES_MAX_IDLE_CONNS_PER_HOST",
+}
+
+// unsetESEnv 去掉运行测试的环境中的 ES_* 环境变量，测试结束后恢复
+func unsetESEnv(t *testing.T) {
+	for _, key := range esEnvs {
+		if v, ok := os.LookupEnv(key); ok {
+			os.Unsetenv(key)
+			t.Cleanup(func() { os.Setenv(key, v) })
+		}
+	}
+}
+
+// writeConfigFile 在临时目录中写入配置文件
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const yamlConfig = `
+addresses: ["https://es-dev:9200"]
+username: elastic
+password: changeme
+dial_timeout: 2s
+response_header_timeout: 5000
+profiles:
+  prod:
+    addresses: ["https://es-prod-1:9200", "https://es-prod-2:9200"]
+    compression: true
+  cloud:
+    cloud_id: "zeus:dXMtZWFzdC0xLmF3cy5mb3VuZC5pbyQxMjMkNDU2"
+`
+
+func TestLoadConfigFile(t *testing.T) {
+	jsonConfig := `{"addresses":["https://es-dev:9200"],"username":"elastic","password":"changeme","dial_timeout":"2s","response_header_timeout":5000,
+		"profiles":{"prod":{"addresses":["https://es-prod-1:9200","https://es-prod-2:9200"],"compression":true}}}`
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		profile string
+		want    Config
+	}{
+		{
+			name: "yaml", file: "es.yaml", content: yamlConfig,
+			want: Config{Addresses: []string{"https://es-dev:9200"}, Username: "elastic", Password: "changeme",
+				DialTimeout: Duration(2 * time.Second), ResponseHeaderTimeout: Duration(5 * time.Second), MaxIdleConnsPerHost: 10},
+		},
+		{
+			name: "yaml profile", file: "es.yml", content: yamlConfig, profile: "prod",
+			want: Config{Addresses: []string{"https://es-prod-1:9200", "https://es-prod-2:9200"}, Username: "elastic", Password: "changeme",
+				DialTimeout: Duration(2 * time.Second), ResponseHeaderTimeout: Duration(5 * time.Second), MaxIdleConnsPerHost: 10, Compression: true},
+		},
+		{
+			name: "json", file: "es.json", content: jsonConfig,
+			want: Config{Addresses: []string{"https://es-dev:9200"}, Username: "elastic", Password: "changeme",
+				DialTimeout: Duration(2 * time.Second), ResponseHeaderTimeout: Duration(5 * time.Second), MaxIdleConnsPerHost: 10},
+		},
+		{
+			name: "json profile", file: "es.json", content: jsonConfig, profile: "prod",
+			want: Config{Addresses: []string{"https://es-prod-1:9200", "https://es-prod-2:9200"}, Username: "elastic", Password: "changeme",
+				DialTimeout: Duration(2 * time.Second), ResponseHeaderTimeout: Duration(5 * time.Second), MaxIdleConnsPerHost: 10, Compression: true},
+		},
+		{
+			name: "only defaults", file: "es.yaml", content: "username: elastic\npassword: changeme\n",
+			want: Config{Addresses: []string{"http://127.0.0.1:9200"}, Username: "elastic", Password: "changeme",
+				DialTimeout: Duration(time.Second), ResponseHeaderTimeout: Duration(30 * time.Second), MaxIdleConnsPerHost: 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetESEnv(t)
+			cfg, err := LoadConfig(writeConfigFile(t, tt.file, tt.content), tt.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// addressesSet 不参与比较
+			cfg.addressesSet = false
+			if !reflect.DeepEqual(*cfg, tt.want) {
+				t.Fatalf("config = %+v\nwant   %+v", *cfg, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		profile string
+		want    string
+	}{
+		{name: "unknown profile", file: "es.yaml", content: yamlConfig, profile: "staging", want: `profile "staging" not found`},
+		{name: "unsupported extension", file: "es.toml", content: `addresses = []`, want: "unsupported config file"},
+		{name: "invalid yaml", file: "es.yaml", content: "addresses: [", want: "parse config file"},
+		{name: "invalid duration", file: "es.json", content: `{"dial_timeout":"2 seconds"}`, want: "parse config file"},
+		{name: "invalid address", file: "es.yaml", content: `addresses: ["es-dev:9200"]`, want: `invalid address "es-dev:9200"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetESEnv(t)
+			_, err := LoadConfig(writeConfigFile(t, tt.file, tt.content), tt.profile)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+
+	unsetESEnv(t)
+	if _, err := LoadConfig("", "prod"); err == nil {
+		t.Fatal("profile without config file accepted")
+	}
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"), ""); err == nil {
+		t.Fatal("missing config file accepted")
+	}
+}
+
+func TestLoadConfigEnvOverrides(t *testing.T) {
+	unsetESEnv(t)
+	path := writeConfigFile(t, "es.yaml", yamlConfig)
+	t.Setenv("ES_ADDRESSES", " https://es-env-1:9200, ,https://es-env-2:9200")
+	t.Setenv("ES_USERNAME", "env-user")
+	t.Setenv("ES_PASSWORD", "env-password")
+	t.Setenv("ES_COMPRESSION", "false")
+	t.Setenv("ES_DIAL_TIMEOUT", "500ms")
+	t.Setenv("ES_MAX_IDLE_CONNS_PER_HOST", "32")
+
+	cfg, err := LoadConfig(path, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Config{Addresses: []string{"https://es-env-1:9200", "https://es-env-2:9200"}, Username: "env-user", Password: "env-password",
+		DialTimeout: Duration(500 * time.Millisecond), ResponseHeaderTimeout: Duration(5 * time.Second), MaxIdleConnsPerHost: 32}
+	cfg.addressesSet = false
+	if !reflect.DeepEqual(*cfg, want) {
+		t.Fatalf("config = %+v\nwant   %+v", *cfg, want)
+	}
+}
+
+func TestLoadConfigInvalidEnv(t *testing.T) {
+	for key, value := range map[string]string{
+		"ES_COMPRESSION":             "maybe",
+		"ES_INSECURE_SKIP_VERIFY":    "yes please",
+		"ES_DIAL_TIMEOUT":            "1",
+		"ES_RESPONSE_HEADER_TIMEOUT": "soon",
+		"ES_MAX_IDLE_CONNS_PER_HOST": "ten",
+	} {
+		t.Run(key, func(t *testing.T) {
+			unsetESEnv(t)
+			t.Setenv(key, value)
+			if _, err := LoadConfig("", ""); err == nil || !strings.Contains(err.Error(), key) {
+				t.Fatalf("err = %v, want it to mention %s", err, key)
+			}
+		})
+	}
+}
+
+func TestLoadConfigCloudID(t *testing.T) {
+	const cloudID = "zeus:dXMtZWFzdC0xLmF3cy5mb3VuZC5pbyQxMjMkNDU2"
+	withAddresses := writeConfigFile(t, "es.yaml", yamlConfig)
+	withoutAddresses := writeConfigFile(t, "es.json", `{"username":"elastic","password":"changeme"}`)
+
+	t.Run("cloud profile replaces default addresses", func(t *testing.T) {
+		unsetESEnv(t)
+		path := writeConfigFile(t, "cloud.yaml", "profiles:\n  cloud:\n    cloud_id: "+cloudID+"\n")
+		cfg, err := LoadConfig(path, "cloud")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.CloudID != cloudID || cfg.Addresses != nil {
+			t.Fatalf("cloud_id = %q, addresses = %v", cfg.CloudID, cfg.Addresses)
+		}
+	})
+	t.Run("env cloud id replaces default addresses", func(t *testing.T) {
+		unsetESEnv(t)
+		t.Setenv("ES_CLOUD_ID", cloudID)
+		cfg, err := LoadConfig(withoutAddresses, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.CloudID != cloudID || cfg.Addresses != nil {
+			t.Fatalf("cloud_id = %q, addresses = %v", cfg.CloudID, cfg.Addresses)
+		}
+	})
+	t.Run("env cloud id conflicts with file addresses", func(t *testing.T) {
+		unsetESEnv(t)
+		t.Setenv("ES_CLOUD_ID", cloudID)
+		// 配置文件中的 addresses 不会被悄悄清空
+		if _, err := LoadConfig(withAddresses, ""); err == nil || !strings.Contains(err.Error(), "can not be set at the same time") {
+			t.Fatalf("err = %v", err)
+		}
+	})
+	t.Run("env cloud id conflicts with env addresses", func(t *testing.T) {
+		unsetESEnv(t)
+		t.Setenv("ES_CLOUD_ID", cloudID)
+		t.Setenv("ES_ADDRESSES", "https://es-env:9200")
+		if _, err := LoadConfig("", ""); err == nil || !strings.Contains(err.Error(), "can not be set at the same time") {
+			t.Fatalf("err = %v", err)
+		}
+	})
+	t.Run("env addresses replace cloud id from file", func(t *testing.T) {
+		unsetESEnv(t)
+		t.Setenv("ES_ADDRESSES", "https://es-env:9200")
+		t.Setenv("ES_CLOUD_ID", "")
+		cfg, err := LoadConfig(writeConfigFile(t, "cloud.yaml", "cloud_id: "+cloudID+"\n"), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.CloudID != "" || !reflect.DeepEqual(cfg.Addresses, []string{"https://es-env:9200"}) {
+			t.Fatalf("cloud_id = %q, addresses = %v", cfg.CloudID, cfg.Addresses)
+		}
+	})
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string
+	}{
+		{name: "default", modify: func(c *Config) {}},
+		{name: "cloud id", modify: func(c *Config) { c.Addresses, c.CloudID = nil, "zeus:abc" }},
+		{name: "api key", modify: func(c *Config) { c.APIKey = "key" }},
+		{name: "no address", modify: func(c *Config) { c.Addresses = nil }, want: "either addresses or cloud_id must be set"},
+		{name: "addresses and cloud id", modify: func(c *Config) { c.CloudID = "zeus:abc" }, want: "can not be set at the same time"},
+		{name: "address without scheme", modify: func(c *Config) { c.Addresses = []string{"127.0.0.1:9200"} }, want: "invalid address"},
+		{name: "address with other scheme", modify: func(c *Config) { c.Addresses = []string{"ftp://127.0.0.1:9200"} }, want: "invalid address"},
+		{name: "address without host", modify: func(c *Config) { c.Addresses = []string{"http://"} }, want: "invalid address"},
+		{name: "username without password", modify: func(c *Config) { c.Username = "elastic" }, want: "username and password must be set together"},
+		{name: "password without username", modify: func(c *Config) { c.Password = "changeme" }, want: "username and password must be set together"},
+		{name: "api key and username", modify: func(c *Config) { c.APIKey, c.Username, c.Password = "key", "elastic", "changeme" }, want: "api_key and username/password"},
+		{name: "client cert without key", modify: func(c *Config) { c.ClientCert = "client.pem" }, want: "client_cert and client_key"},
+		{name: "client key without cert", modify: func(c *Config) { c.ClientKey = "client.key" }, want: "client_cert and client_key"},
+		{name: "negative dial timeout", modify: func(c *Config) { c.DialTimeout = -1 }, want: "timeouts can not be negative"},
+		{name: "negative header timeout", modify: func(c *Config) { c.ResponseHeaderTimeout = -1 }, want: "timeouts can not be negative"},
+		{name: "negative idle conns", modify: func(c *Config) { c.MaxIdleConnsPerHost = -1 }, want: "max_idle_conns_per_host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDurationUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data string
+		want time.Duration
+		err  bool
+	}{
+		{data: `"1m30s"`, want: 90 * time.Second},
+		{data: `"250ms"`, want: 250 * time.Millisecond},
+		{data: `1500`, want: 1500 * time.Millisecond},
+		{data: `0`, want: 0},
+		{data: `"1 minute"`, err: true},
+		{data: `true`, err: true},
+	}
+	for _, tt := range tests {
+		var d Duration
+		err := json.Unmarshal([]byte(tt.data), &d)
+		if (err != nil) != tt.err || (!tt.err && time.Duration(d) != tt.want) {
+			t.Fatalf("unmarshal %s = %v, %v", tt.data, time.Duration(d), err)
+		}
+	}
+}
+
+func TestConfigTLS(t *testing.T) {
+	tlsConfig, err := DefaultConfig().tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS12 || tlsConfig.InsecureSkipVerify {
+		t.Fatalf("MinVersion = %x, InsecureSkipVerify = %v", tlsConfig.MinVersion, tlsConfig.InsecureSkipVerify)
+	}
+	transport := DefaultConfig().transport(tlsConfig).(*http.Transport)
+	if transport.TLSClientConfig.MinVersion != tls.VersionTLS12 {
+		t.Fatal("transport does not use the TLS config")
+	}
+
+	cfg := DefaultConfig()
+	cfg.CACert = writeConfigFile(t, "ca.pem", "not a certificate")
+	if _, err := cfg.tlsConfig(); err == nil || !strings.Contains(err.Error(), "no certificate found") {
+		t.Fatalf("err = %v", err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	cfg = DefaultConfig()
+	cfg.CACert = missing
+	if _, err := cfg.tlsConfig(); err == nil {
+		t.Fatal("missing ca_cert accepted")
+	}
+	cfg = DefaultConfig()
+	cfg.ClientCert, cfg.ClientKey = missing, missing
+	if _, err := cfg.tlsConfig(); err == nil || !strings.Contains(err.Error(), "client_cert") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestConfigTransportCompression(t *testing.T) {
+	plain, ok := (&Config{}).transport(nil).(*http.Transport)
+	if !ok {
+		t.Fatalf("transport without compression is %T", (&Config{}).transport(nil))
+	}
+	if plain.DisableCompression {
+		t.Fatal("gzip responses disabled when Compression is false")
+	}
+
+	wrapped, ok := (&Config{Compression: true}).transport(nil).(*gzipRequestTransport)
+	if !ok {
+		t.Fatal("request bodies are not compressed when Compression is true")
+	}
+	if wrapped.next.(*http.Transport).DisableCompression {
+		t.Fatal("gzip responses disabled when Compression is true")
+	}
+}
+
+func TestGzipRequestTransport(t *testing.T) {
+	var (
+		encoding string
+		body     []byte
+	)
+	next := roundTripFunc(func(req *http.Request) (int, string) {
+		encoding = req.Header.Get("Content-Encoding")
+		body = nil
+		if req.Body != nil {
+			body, _ = io.ReadAll(req.Body)
+			req.Body.Close()
+		}
+		return http.StatusOK, `{}`
+	})
+	transport := &gzipRequestTransport{next: next}
+
+	payload := strings.Repeat(`{"query":{"match_all":{}}}`, 100)
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost:9200/_search", strings.NewReader(payload))
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if encoding != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", encoding)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil || string(decoded) != payload {
+		t.Fatalf("decoded body = %q, %v", decoded, err)
+	}
+	if req.Header.Get("Content-Encoding") != "" {
+		t.Fatal("original request was modified")
+	}
+
+	// 已经压缩过的请求原样发送
+	req, _ = http.NewRequest(http.MethodPost, "http://localhost:9200/_bulk", strings.NewReader("already"))
+	req.Header.Set("Content-Encoding", "gzip")
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "already" {
+		t.Fatalf("pre-encoded body = %q", body)
+	}
+
+	// 没有请求体的请求不压缩
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost:9200/", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if encoding != "" {
+		t.Fatalf("Content-Encoding = %q for a request without body", encoding)
+	}
+}
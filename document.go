@@ -0,0 +1,250 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ================================ 文档元数据 ================================
+
+// 文档元数据使用的 struct tag，例如 `es:"id"`、`es:"routing"`
+const documentTagName = "es"
+
+// DocumentMeta 批量操作需要的文档元数据
+type DocumentMeta struct {
+	ID      string
+	Index   string
+	Routing string
+	Parent  string
+	Version *int64
+}
+
+// Documenter 没有使用 es tag 的类型可以实现该接口提供元数据
+type Documenter interface {
+	DocumentMeta() DocumentMeta
+}
+
+// ExtractDocumentMeta 从 `es:"id"`、`es:"routing"`、`es:"version"`、`es:"parent"`、`es:"index"` 标记的字段中
+// 读取元数据，tag 中没有的字段再从 Documenter 中取；都没有 ID 时兼容使用名为 ID 的字段
+func ExtractDocumentMeta(document interface{}) (DocumentMeta, error) {
+	var meta DocumentMeta
+	if document == nil {
+		return meta, fmt.Errorf("document can not be nil")
+	}
+
+	v := reflect.ValueOf(document)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return meta, fmt.Errorf("document of type %T is a nil pointer", document)
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct {
+		if err := extractTaggedMeta(v, &meta); err != nil {
+			return meta, fmt.Errorf("document of type %T: %s", document, err)
+		}
+	}
+
+	if d, ok := document.(Documenter); ok {
+		fallback := d.DocumentMeta()
+		if meta.ID == "" {
+			meta.ID = fallback.ID
+		}
+		if meta.Index == "" {
+			meta.Index = fallback.Index
+		}
+		if meta.Routing == "" {
+			meta.Routing = fallback.Routing
+		}
+		if meta.Parent == "" {
+			meta.Parent = fallback.Parent
+		}
+		if meta.Version == nil {
+			meta.Version = fallback.Version
+		}
+	}
+
+	if meta.ID == "" && v.Kind() == reflect.Struct {
+		if field := v.FieldByName("ID"); field.IsValid() {
+			id, err := metaString(field)
+			if err != nil {
+				return meta, fmt.Errorf("document of type %T: field ID: %s", document, err)
+			}
+			meta.ID = id
+		}
+	}
+	return meta, nil
+}
+
+// extractTaggedMeta 遍历字段（包括匿名嵌入的结构体）读取 es tag
+func extractTaggedMeta(v reflect.Value, meta *DocumentMeta) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		tag := field.Tag.Get(documentTagName)
+		if tag == "" && field.Anonymous {
+			for value.Kind() == reflect.Ptr {
+				if value.IsNil() {
+					break
+				}
+				value = value.Elem()
+			}
+			if value.Kind() == reflect.Struct {
+				if err := extractTaggedMeta(value, meta); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// 一个 tag 中可以同时包含元数据和 mapping 选项，例如 `es:"id,type=keyword"`
+		for _, option := range strings.Split(tag, ",") {
+			if err := setMetaField(field, value, strings.TrimSpace(option), meta); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setMetaField 根据 tag 中的元数据选项设置对应的值，mapping 选项直接忽略
+func setMetaField(field reflect.StructField, value reflect.Value, option string, meta *DocumentMeta) error {
+	var target *string
+	switch option {
+	case "id":
+		target = &meta.ID
+	case "index":
+		target = &meta.Index
+	case "routing":
+		target = &meta.Routing
+	case "parent":
+		target = &meta.Parent
+	case "version":
+	default:
+		return nil
+	}
+	if !field.IsExported() {
+		return fmt.Errorf("field %s with tag %s:%q must be exported", field.Name, documentTagName, option)
+	}
+
+	if target == nil {
+		version, err := metaInt(value)
+		if err != nil {
+			return fmt.Errorf("field %s: %s", field.Name, err)
+		}
+		meta.Version = version
+		return nil
+	}
+	s, err := metaString(value)
+	if err != nil {
+		return fmt.Errorf("field %s: %s", field.Name, err)
+	}
+	*target = s
+	return nil
+}
+
+// metaString 把字段值转换成字符串，只支持字符串、整数和 fmt.Stringer
+func metaString(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if v.CanInterface() {
+		if s, ok := v.Interface().(fmt.Stringer); ok {
+			return s.String(), nil
+		}
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("unsupported type %s, must be string, integer or fmt.Stringer", v.Type())
+}
+
+// metaInt 把版本号字段转换成 int64
+func metaInt(v reflect.Value) (*int64, error) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	var n int64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = int64(v.Uint())
+	default:
+		return nil, fmt.Errorf("unsupported version type %s, must be integer", v.Type())
+	}
+	return &n, nil
+}
+
+// NewDocumentItem 根据文档的元数据生成一条批量操作，action 为 index、create、update、delete；
+// update 时 document 会作为 {"doc": document, "doc_as_upsert": true} 发送。
+// es 的 update 不支持外部版本号，update 时忽略 `es:"version"`，需要乐观锁时设置 IfSeqNo 和 IfPrimaryTerm
+func NewDocumentItem(action string, document interface{}) (BulkIndexerItem, error) {
+	meta, err := ExtractDocumentMeta(document)
+	if err != nil {
+		return BulkIndexerItem{}, err
+	}
+	if meta.ID == "" && action != "index" {
+		return BulkIndexerItem{}, fmt.Errorf("no document id found in %T, tag a field with `es:\"id\"` or implement Documenter", document)
+	}
+
+	item := BulkIndexerItem{
+		Action:     action,
+		Index:      meta.Index,
+		DocumentID: meta.ID,
+		Routing:    meta.Routing,
+		Body:       document,
+	}
+	if action != "update" {
+		item.Version = meta.Version
+	}
+	// join 类型的子文档必须和父文档路由到同一个分片
+	if item.Routing == "" {
+		item.Routing = meta.Parent
+	}
+	switch action {
+	case "update":
+		item.Body = map[string]interface{}{
+			"doc":           document,
+			"doc_as_upsert": true,
+		}
+	case "delete":
+		item.Body = nil
+	}
+	return item, nil
+}
+
+// NewScriptedUpdateItem 生成用脚本更新文档的 update 操作，文档已存在时执行 script，
+// 不存在时把 document 作为新文档写入（脚本不执行）
+func NewScriptedUpdateItem(document interface{}, script *Script) (BulkIndexerItem, error) {
+	if script == nil {
+		return BulkIndexerItem{}, fmt.Errorf("scripted update requires a script")
+	}
+	if err := script.Validate(); err != nil {
+		return BulkIndexerItem{}, err
+	}
+	item, err := NewDocumentItem("update", document)
+	if err != nil {
+		return BulkIndexerItem{}, err
+	}
+	item.Body = map[string]interface{}{
+		"script": script,
+		"upsert": document,
+	}
+	return item, nil
+}
@@ -0,0 +1,246 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// versionedDocument 带外部版本号的文档
+type versionedDocument struct {
+	ID      string `json:"id" es:"id"`
+	Version int64  `json:"version" es:"version"`
+	Name    string `json:"name"`
+}
+
+func TestNewDocumentItemIgnoresVersionForUpdate(t *testing.T) {
+	doc := versionedDocument{ID: "1", Version: 7, Name: "a"}
+
+	update, err := NewDocumentItem("update", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.Version != nil {
+		t.Fatalf("update item version = %d, want nil", *update.Version)
+	}
+	if _, err := newBulkItem(update, "zeus"); err != nil {
+		t.Fatalf("newBulkItem(update) = %v", err)
+	}
+
+	index, err := NewDocumentItem("index", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.Version == nil || *index.Version != 7 {
+		t.Fatalf("index item version = %v, want 7", index.Version)
+	}
+}
+
+func TestBulkItemOptimisticConcurrency(t *testing.T) {
+	seqNo, primaryTerm := int64(3), int64(1)
+	item, err := newBulkItem(BulkIndexerItem{Action: "update", DocumentID: "1", IfSeqNo: &seqNo, IfPrimaryTerm: &primaryTerm, Body: map[string]interface{}{"doc": map[string]interface{}{"a": 1}}}, "zeus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"update":{"_id":"1","_index":"zeus","if_primary_term":1,"if_seq_no":3}}`
+	if string(item.meta) != want {
+		t.Fatalf("meta = %s, want %s", item.meta, want)
+	}
+	if _, err := newBulkItem(BulkIndexerItem{Action: "delete", DocumentID: "1", IfSeqNo: &seqNo}, "zeus"); err == nil {
+		t.Fatal("if_seq_no without if_primary_term was accepted")
+	}
+}
+
+func TestUpsertVersionedDocument(t *testing.T) {
+	var lines [][]byte
+	transport := &fixtureTransport{
+		status: http.StatusOK,
+		body:   []byte(`{"took":1,"errors":false,"items":[{"update":{"_index":"zeus","_id":"1","_version":2,"result":"updated","status":200}}]}`),
+		onRequest: func(req *http.Request, body []byte) {
+			lines = bytes.Split(bytes.TrimSpace(body), []byte("\n"))
+		},
+	}
+	client := WrapClient(newTransportClient(t, transport), nil)
+
+	result, err := performESUpsert(client, "zeus", []interface{}{versionedDocument{ID: "1", Version: 7, Name: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.NumSucceeded != 1 || result.NumFailed != 0 {
+		t.Fatalf("result = %+v", result)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("bulk body has %d lines, want 2", len(lines))
+	}
+	if want := `{"update":{"_id":"1","_index":"zeus","retry_on_conflict":3}}`; string(lines[0]) != want {
+		t.Fatalf("meta = %s, want %s", lines[0], want)
+	}
+	var body struct {
+		Doc         versionedDocument `json:"doc"`
+		DocAsUpsert bool              `json:"doc_as_upsert"`
+	}
+	if err := json.Unmarshal(lines[1], &body); err != nil {
+		t.Fatal(err)
+	}
+	if !body.DocAsUpsert || body.Doc != (versionedDocument{ID: "1", Version: 7, Name: "a"}) {
+		t.Fatalf("body = %s", lines[1])
+	}
+}
+
+// entityKey 实现 fmt.Stringer 的 ID
+type entityKey struct {
+	kind string
+	id   int
+}
+
+func (k entityKey) String() string {
+	return k.kind + "-" + strconv.Itoa(k.id)
+}
+
+// documenterDocument 没有 es tag，通过 Documenter 提供元数据
+type documenterDocument struct {
+	Key  string `json:"key"`
+	Shop string `json:"shop"`
+}
+
+func (d documenterDocument) DocumentMeta() DocumentMeta {
+	version := int64(5)
+	return DocumentMeta{ID: "doc-" + d.Key, Index: "zeus_v2", Routing: d.Shop, Version: &version}
+}
+
+// partialDocumenter tag 中有的字段优先，其余的从 Documenter 中取
+type partialDocumenter struct {
+	ID   int64  `json:"id" es:"id"`
+	Shop string `json:"shop"`
+}
+
+func (d *partialDocumenter) DocumentMeta() DocumentMeta {
+	return DocumentMeta{ID: "ignored", Routing: d.Shop}
+}
+
+type embeddedMeta struct {
+	Routing string `json:"routing" es:"routing"`
+}
+
+func TestExtractDocumentMeta(t *testing.T) {
+	version := int64(9)
+	uintVersion := uint32(4)
+	id := 42
+	tests := []struct {
+		name     string
+		document interface{}
+		want     DocumentMeta
+	}{
+		{name: "int id", document: struct {
+			ID int `es:"id"`
+		}{ID: 42}, want: DocumentMeta{ID: "42"}},
+		{name: "uint64 id", document: struct {
+			ID uint64 `es:"id"`
+		}{ID: 18446744073709551615}, want: DocumentMeta{ID: "18446744073709551615"}},
+		{name: "pointer to int id", document: &struct {
+			ID *int `es:"id"`
+		}{ID: &id}, want: DocumentMeta{ID: "42"}},
+		{name: "nil pointer id", document: struct {
+			ID *int `es:"id"`
+		}{}, want: DocumentMeta{}},
+		{name: "stringer id", document: struct {
+			Key entityKey `es:"id"`
+		}{Key: entityKey{kind: "user", id: 7}}, want: DocumentMeta{ID: "user-7"}},
+		{name: "non-pointer struct", document: versionedDocument{ID: "1", Version: 9}, want: DocumentMeta{ID: "1", Version: &version}},
+		{name: "pointer struct", document: &versionedDocument{ID: "1", Version: 9}, want: DocumentMeta{ID: "1", Version: &version}},
+		{name: "all tags", document: struct {
+			embeddedMeta
+			ID      string  `es:"id,type=keyword"`
+			Index   string  `es:"index"`
+			Parent  string  `es:"parent"`
+			Version *uint32 `es:"version"`
+		}{embeddedMeta: embeddedMeta{Routing: "r1"}, ID: "1", Index: "zeus_v1", Parent: "p1", Version: &uintVersion},
+			want: DocumentMeta{ID: "1", Index: "zeus_v1", Routing: "r1", Parent: "p1", Version: int64Ptr(4)}},
+		{name: "fallback to ID field", document: struct {
+			ID   int64
+			Name string
+		}{ID: 3}, want: DocumentMeta{ID: "3"}},
+		{name: "documenter", document: documenterDocument{Key: "a", Shop: "s1"},
+			want: DocumentMeta{ID: "doc-a", Index: "zeus_v2", Routing: "s1", Version: int64Ptr(5)}},
+		{name: "tags before documenter", document: &partialDocumenter{ID: 8, Shop: "s2"}, want: DocumentMeta{ID: "8", Routing: "s2"}},
+		{name: "not a struct", document: map[string]interface{}{"id": "1"}, want: DocumentMeta{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, err := ExtractDocumentMeta(tt.document)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(meta, tt.want) {
+				t.Fatalf("meta = %+v, want %+v", meta, tt.want)
+			}
+		})
+	}
+}
+
+func int64Ptr(n int64) *int64 {
+	return &n
+}
+
+func TestExtractDocumentMetaErrors(t *testing.T) {
+	var nilDocument *versionedDocument
+	tests := []struct {
+		name     string
+		document interface{}
+		want     string
+	}{
+		{name: "nil", document: nil, want: "document can not be nil"},
+		{name: "nil pointer", document: nilDocument, want: "is a nil pointer"},
+		{name: "unsupported id type", document: struct {
+			ID float64 `es:"id"`
+		}{ID: 1.5}, want: "field ID: unsupported type float64"},
+		{name: "unsupported version type", document: struct {
+			Version string `es:"version"`
+		}{Version: "1"}, want: "unsupported version type string"},
+		{name: "unexported tagged field", document: struct {
+			id string `es:"id"`
+		}{id: "1"}, want: "field id with tag es:\"id\" must be exported"},
+		{name: "unsupported ID field", document: struct {
+			ID []string
+		}{ID: []string{"1"}}, want: "field ID: unsupported type []string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ExtractDocumentMeta(tt.document); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewDocumentItemWithoutID(t *testing.T) {
+	noID := struct {
+		Name string `json:"name"`
+	}{Name: "a"}
+	for _, action := range []string{"create", "update", "delete"} {
+		_, err := NewDocumentItem(action, noID)
+		if err == nil || !strings.Contains(err.Error(), "no document id found") {
+			t.Fatalf("%s without id: err = %v", action, err)
+		}
+	}
+	// index 没有 ID 时由 es 生成
+	item, err := NewDocumentItem("index", noID)
+	if err != nil || item.DocumentID != "" {
+		t.Fatalf("index without id: item = %+v, err = %v", item, err)
+	}
+}
+
+func TestNewDocumentItemFromDocumenter(t *testing.T) {
+	doc := documenterDocument{Key: "a", Shop: "s1"}
+	item, err := NewDocumentItem("delete", doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.DocumentID != "doc-a" || item.Index != "zeus_v2" || item.Routing != "s1" || item.Body != nil || *item.Version != 5 {
+		t.Fatalf("item = %+v", item)
+	}
+}
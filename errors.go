@@ -0,0 +1,187 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+)
+
+// 非 json 的错误返回（例如代理返回的 502 页面）最多保留的长度
+const maxErrorBodySize = 4096
+
+// ESError es 返回的错误，可以用 errors.As 取出
+type ESError struct {
+	Status       int
+	Type         string
+	Reason       string
+	Index        string
+	RootCause    []ErrorCause
+	FailedShards []ShardFailure
+	// 脚本错误的具体原因，例如编译错误时的语法错误
+	CausedBy *ErrorCause
+	// 脚本错误时出错位置附近的代码，最后一行用 ^ 指向出错的位置
+	ScriptStack []string
+	// 返回内容不是 es 的错误结构时保存原始内容
+	Body string
+}
+
+// ErrorCause 错误原因
+type ErrorCause struct {
+	Type      string `json:"type"`
+	Reason    string `json:"reason"`
+	Index     string `json:"index,omitempty"`
+	IndexUUID string `json:"index_uuid,omitempty"`
+}
+
+// ShardFailure 分片级别的错误
+type ShardFailure struct {
+	Shard  int        `json:"shard"`
+	Index  string     `json:"index"`
+	Node   string     `json:"node"`
+	Reason ErrorCause `json:"reason"`
+}
+
+// Error 实现 error 接口
+func (e *ESError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%d %s]", e.Status, http.StatusText(e.Status))
+	if e.Type != "" {
+		fmt.Fprintf(&sb, " %s:", e.Type)
+	}
+	if e.Reason != "" {
+		fmt.Fprintf(&sb, " %s", e.Reason)
+	} else if e.Body != "" {
+		fmt.Fprintf(&sb, " %s", e.Body)
+	}
+	if e.CausedBy != nil {
+		fmt.Fprintf(&sb, "; caused by: %s: %s", e.CausedBy.Type, e.CausedBy.Reason)
+	}
+	if len(e.ScriptStack) > 0 {
+		fmt.Fprintf(&sb, " (script: %s)", strings.Join(e.ScriptStack, " "))
+	}
+	if e.Index != "" {
+		fmt.Fprintf(&sb, " (index: %s)", e.Index)
+	}
+	for _, cause := range e.RootCause {
+		if cause.Type == e.Type && cause.Reason == e.Reason {
+			continue
+		}
+		fmt.Fprintf(&sb, "; root cause: %s: %s", cause.Type, cause.Reason)
+	}
+	return sb.String()
+}
+
+// newESError 解析 es 的错误返回，返回内容不是预期结构时也不会 panic
+func newESError(res *esapi.Response) *ESError {
+	esErr := &ESError{Status: res.StatusCode}
+	if res.Body == nil {
+		return esErr
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		esErr.Reason = fmt.Sprintf("Error reading the response body: %s", err)
+		return esErr
+	}
+	return parseESError(res.StatusCode, body)
+}
+
+// parseESError 解析 {"error": ..., "status": ...} 结构的错误，msearch 等接口中单个查询的错误也是这个结构
+func parseESError(status int, body []byte) *ESError {
+	esErr := &ESError{Status: status}
+	var e struct {
+		Error  json.RawMessage `json:"error"`
+		Status int             `json:"status"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil || len(e.Error) == 0 {
+		esErr.Body = truncateErrorBody(body)
+		return esErr
+	}
+
+	// error 字段可能是对象，也可能是字符串
+	var reason string
+	if err := json.Unmarshal(e.Error, &reason); err == nil {
+		esErr.Reason = reason
+		return esErr
+	}
+	var detail struct {
+		ErrorCause
+		RootCause    []ErrorCause   `json:"root_cause"`
+		FailedShards []ShardFailure `json:"failed_shards"`
+		CausedBy     *ErrorCause    `json:"caused_by"`
+		ScriptStack  []string       `json:"script_stack"`
+	}
+	if err := json.Unmarshal(e.Error, &detail); err != nil {
+		esErr.Body = truncateErrorBody(body)
+		return esErr
+	}
+	esErr.Type = detail.Type
+	esErr.Reason = detail.Reason
+	esErr.Index = detail.Index
+	esErr.RootCause = detail.RootCause
+	esErr.FailedShards = detail.FailedShards
+	esErr.CausedBy = detail.CausedBy
+	esErr.ScriptStack = detail.ScriptStack
+	return esErr
+}
+
+func truncateErrorBody(body []byte) string {
+	s := strings.TrimSpace(string(body))
+	if len(s) > maxErrorBodySize {
+		s = s[:maxErrorBodySize] + "..."
+	}
+	return s
+}
+
+// hasType 判断错误本身或者 root_cause 中是否包含指定类型
+func (e *ESError) hasType(types ...string) bool {
+	for _, t := range types {
+		if e.Type == t {
+			return true
+		}
+		for _, cause := range e.RootCause {
+			if cause.Type == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsNotFound 索引或文档不存在
+func IsNotFound(err error) bool {
+	var esErr *ESError
+	return errors.As(err, &esErr) &&
+		(esErr.Status == http.StatusNotFound || esErr.hasType("index_not_found_exception", "resource_not_found_exception"))
+}
+
+// IsConflict 版本冲突
+func IsConflict(err error) bool {
+	var esErr *ESError
+	return errors.As(err, &esErr) &&
+		(esErr.Status == http.StatusConflict || esErr.hasType("version_conflict_engine_exception"))
+}
+
+// IsTooManyRequests 集群线程池已满，请求被拒绝
+func IsTooManyRequests(err error) bool {
+	var esErr *ESError
+	return errors.As(err, &esErr) &&
+		(esErr.Status == http.StatusTooManyRequests || esErr.hasType("es_rejected_execution_exception"))
+}
+
+// IsIndexAlreadyExists 创建索引时索引已存在
+func IsIndexAlreadyExists(err error) bool {
+	var esErr *ESError
+	return errors.As(err, &esErr) &&
+		esErr.hasType("resource_already_exists_exception", "index_already_exists_exception")
+}
+
+// IsScriptError 脚本编译或执行失败
+func IsScriptError(err error) bool {
+	var esErr *ESError
+	return errors.As(err, &esErr) && esErr.hasType("script_exception")
+}
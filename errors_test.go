@@ -0,0 +1,168 @@
+package elasticsearch
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+)
+
+func TestParseESError(t *testing.T) {
+	longPage := "<html>" + strings.Repeat("x", 2*maxErrorBodySize) + "</html>"
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   ESError
+		// 需要满足的判断，其余的判断都应该为 false
+		predicates []string
+		// Error() 中需要包含的内容
+		contains []string
+	}{
+		{
+			name:     "html 502 from proxy",
+			status:   http.StatusBadGateway,
+			body:     "<html>\r\n<head><title>502 Bad Gateway</title></head>\r\n<body><center><h1>502 Bad Gateway</h1></center></body>\r\n</html>\r\n",
+			want:     ESError{Status: 502, Body: "<html>\r\n<head><title>502 Bad Gateway</title></head>\r\n<body><center><h1>502 Bad Gateway</h1></center></body>\r\n</html>"},
+			contains: []string{"[502 Bad Gateway]", "<h1>502 Bad Gateway</h1>"},
+		},
+		{
+			name:     "long html body is truncated",
+			status:   http.StatusServiceUnavailable,
+			body:     longPage,
+			want:     ESError{Status: 503, Body: longPage[:maxErrorBodySize] + "..."},
+			contains: []string{"[503 Service Unavailable]"},
+		},
+		{
+			name:     "empty body",
+			status:   http.StatusInternalServerError,
+			body:     "",
+			want:     ESError{Status: 500},
+			contains: []string{"[500 Internal Server Error]"},
+		},
+		{
+			name:       "error is a string",
+			status:     http.StatusNotFound,
+			body:       `{"error":"alias [zeus] missing","status":404}`,
+			want:       ESError{Status: 404, Reason: "alias [zeus] missing"},
+			predicates: []string{"IsNotFound"},
+			contains:   []string{"[404 Not Found] alias [zeus] missing"},
+		},
+		{
+			name:     "error is not an object or a string",
+			status:   http.StatusBadRequest,
+			body:     `{"error":42,"status":400}`,
+			want:     ESError{Status: 400, Body: `{"error":42,"status":400}`},
+			contains: []string{`{"error":42,"status":400}`},
+		},
+		{
+			name:   "index not found",
+			status: http.StatusNotFound,
+			body: `{"error":{"root_cause":[{"type":"index_not_found_exception","reason":"no such index [zeus]","index":"zeus","index_uuid":"_na_"}],
+				"type":"index_not_found_exception","reason":"no such index [zeus]","index":"zeus","index_uuid":"_na_"},"status":404}`,
+			want: ESError{Status: 404, Type: "index_not_found_exception", Reason: "no such index [zeus]", Index: "zeus",
+				RootCause: []ErrorCause{{Type: "index_not_found_exception", Reason: "no such index [zeus]", Index: "zeus", IndexUUID: "_na_"}}},
+			predicates: []string{"IsNotFound"},
+			contains:   []string{"index_not_found_exception: no such index [zeus] (index: zeus)"},
+		},
+		{
+			name:   "version conflict",
+			status: http.StatusConflict,
+			body: `{"error":{"root_cause":[{"type":"version_conflict_engine_exception","reason":"[1]: version conflict, current version [3] is higher or equal to the one provided [2]","index":"zeus"}],
+				"type":"version_conflict_engine_exception","reason":"[1]: version conflict, current version [3] is higher or equal to the one provided [2]","index":"zeus"},"status":409}`,
+			want: ESError{Status: 409, Type: "version_conflict_engine_exception", Reason: "[1]: version conflict, current version [3] is higher or equal to the one provided [2]", Index: "zeus",
+				RootCause: []ErrorCause{{Type: "version_conflict_engine_exception", Reason: "[1]: version conflict, current version [3] is higher or equal to the one provided [2]", Index: "zeus"}}},
+			predicates: []string{"IsConflict"},
+		},
+		{
+			name:   "rejected execution in root cause",
+			status: http.StatusServiceUnavailable,
+			body: `{"error":{"root_cause":[{"type":"es_rejected_execution_exception","reason":"rejected execution of coordinating operation"}],
+				"type":"search_phase_execution_exception","reason":"all shards failed","failed_shards":[{"shard":0,"index":"zeus","node":"n1","reason":{"type":"es_rejected_execution_exception","reason":"rejected execution of coordinating operation"}}]},"status":503}`,
+			want: ESError{Status: 503, Type: "search_phase_execution_exception", Reason: "all shards failed",
+				RootCause:    []ErrorCause{{Type: "es_rejected_execution_exception", Reason: "rejected execution of coordinating operation"}},
+				FailedShards: []ShardFailure{{Shard: 0, Index: "zeus", Node: "n1", Reason: ErrorCause{Type: "es_rejected_execution_exception", Reason: "rejected execution of coordinating operation"}}}},
+			predicates: []string{"IsTooManyRequests"},
+			contains:   []string{"all shards failed; root cause: es_rejected_execution_exception: rejected execution of coordinating operation"},
+		},
+		{
+			name:       "too many requests status",
+			status:     http.StatusTooManyRequests,
+			body:       `{"error":{"type":"circuit_breaking_exception","reason":"[parent] Data too large"},"status":429}`,
+			want:       ESError{Status: 429, Type: "circuit_breaking_exception", Reason: "[parent] Data too large"},
+			predicates: []string{"IsTooManyRequests"},
+		},
+		{
+			name:   "index already exists",
+			status: http.StatusBadRequest,
+			body: `{"error":{"root_cause":[{"type":"resource_already_exists_exception","reason":"index [zeus_v1/abc] already exists","index":"zeus_v1"}],
+				"type":"resource_already_exists_exception","reason":"index [zeus_v1/abc] already exists","index":"zeus_v1"},"status":400}`,
+			want: ESError{Status: 400, Type: "resource_already_exists_exception", Reason: "index [zeus_v1/abc] already exists", Index: "zeus_v1",
+				RootCause: []ErrorCause{{Type: "resource_already_exists_exception", Reason: "index [zeus_v1/abc] already exists", Index: "zeus_v1"}}},
+			predicates: []string{"IsIndexAlreadyExists"},
+		},
+		{
+			name:   "script compile error",
+			status: http.StatusBadRequest,
+			body: `{"error":{"root_cause":[{"type":"script_exception","reason":"compile error"}],
+				"type":"script_exception","reason":"compile error","script_stack":["doc['a'].value +", "                 ^---- HERE"],
+				"script":"doc['a'].value +","lang":"painless",
+				"caused_by":{"type":"illegal_argument_exception","reason":"unexpected end of script."}},"status":400}`,
+			want: ESError{Status: 400, Type: "script_exception", Reason: "compile error",
+				RootCause:   []ErrorCause{{Type: "script_exception", Reason: "compile error"}},
+				CausedBy:    &ErrorCause{Type: "illegal_argument_exception", Reason: "unexpected end of script."},
+				ScriptStack: []string{"doc['a'].value +", "                 ^---- HERE"}},
+			predicates: []string{"IsScriptError"},
+			contains:   []string{"caused by: illegal_argument_exception: unexpected end of script.", "^---- HERE"},
+		},
+	}
+
+	predicates := map[string]func(error) bool{
+		"IsNotFound":           IsNotFound,
+		"IsConflict":           IsConflict,
+		"IsTooManyRequests":    IsTooManyRequests,
+		"IsIndexAlreadyExists": IsIndexAlreadyExists,
+		"IsScriptError":        IsScriptError,
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &esapi.Response{StatusCode: tt.status, Body: io.NopCloser(strings.NewReader(tt.body))}
+			esErr := newESError(res)
+			if esErr.Error() == "" {
+				t.Fatal("empty error message")
+			}
+			if got, want := *esErr, tt.want; !reflect.DeepEqual(got, want) {
+				t.Fatalf("parsed = %#v\nwant   %#v", got, want)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(esErr.Error(), s) {
+					t.Fatalf("Error() = %q, want it to contain %q", esErr.Error(), s)
+				}
+			}
+
+			// 包装之后判断依然有效
+			err := errors.Wrap(errors.WithStack(esErr), "search zeus")
+			want := map[string]bool{}
+			for _, name := range tt.predicates {
+				want[name] = true
+			}
+			for name, is := range predicates {
+				if got := is(err); got != want[name] {
+					t.Fatalf("%s = %v, want %v", name, got, want[name])
+				}
+			}
+		})
+	}
+}
+
+func TestPredicatesOnOtherErrors(t *testing.T) {
+	for _, err := range []error{nil, errors.New("connection refused"), io.EOF} {
+		if IsNotFound(err) || IsConflict(err) || IsTooManyRequests(err) || IsIndexAlreadyExists(err) || IsScriptError(err) {
+			t.Fatalf("predicate true for %v", err)
+		}
+	}
+}
@@ -0,0 +1,498 @@
+package elasticsearch
+
+import (
+	"fmt"
+)
+
+// ================================ function_score 查询 ================================
+
+// 合法的 score_mode、boost_mode 和 field_value_factor 的 modifier
+var (
+	validScoreModes = map[string]bool{"multiply": true, "sum": true, "avg": true, "first": true, "max": true, "min": true}
+	validBoostModes = map[string]bool{"multiply": true, "replace": true, "sum": true, "avg": true, "max": true, "min": true}
+	validModifiers  = map[string]bool{
+		"none": true, "log": true, "log1p": true, "log2p": true, "ln": true, "ln1p": true, "ln2p": true,
+		"square": true, "sqrt": true, "reciprocal": true,
+	}
+)
+
+// validator 发送前可以校验参数的查询
+type validator interface {
+	Validate() error
+}
+
+// validateQuery 查询实现了 validator 时校验参数
+func validateQuery(q Query) error {
+	if v, ok := q.(validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// ScoreFunction function_score 中的一个打分函数
+type ScoreFunction interface {
+	Map() map[string]interface{}
+	Validate() error
+}
+
+// scoreFunction 打分函数公共的 filter 和 weight
+type scoreFunction struct {
+	filter Query
+	weight *float64
+}
+
+// wrap 加上 filter 和 weight
+func (f *scoreFunction) wrap(function map[string]interface{}) map[string]interface{} {
+	if f.filter != nil {
+		function["filter"] = f.filter.Map()
+	}
+	if f.weight != nil {
+		function["weight"] = *f.weight
+	}
+	return function
+}
+
+// validate 校验 filter 和 weight
+func (f *scoreFunction) validate() error {
+	if f.weight != nil && *f.weight < 0 {
+		return fmt.Errorf("weight can not be negative, got %v", *f.weight)
+	}
+	if f.filter != nil {
+		return validateQuery(f.filter)
+	}
+	return nil
+}
+
+// WeightFunction 只有权重的打分函数，一般配合 filter 给满足条件的文档加权
+type WeightFunction struct {
+	scoreFunction
+}
+
+// Weight 创建只有权重的打分函数
+func Weight(weight float64) *WeightFunction {
+	f := &WeightFunction{}
+	f.weight = &weight
+	return f
+}
+
+// Filter 只对满足条件的文档生效
+func (f *WeightFunction) Filter(filter Query) *WeightFunction {
+	f.filter = filter
+	return f
+}
+
+// Map 实现 ScoreFunction 接口
+func (f *WeightFunction) Map() map[string]interface{} {
+	return f.wrap(map[string]interface{}{})
+}
+
+// Validate 实现 ScoreFunction 接口
+func (f *WeightFunction) Validate() error {
+	return f.validate()
+}
+
+// FieldValueFactorFunction 用文档中某个数值字段的值打分
+type FieldValueFactorFunction struct {
+	scoreFunction
+	field    string
+	factor   *float64
+	modifier string
+	missing  *float64
+}
+
+// FieldValueFactor 创建 field_value_factor 打分函数，得分为 modifier(factor * doc[field])
+func FieldValueFactor(field string) *FieldValueFactorFunction {
+	return &FieldValueFactorFunction{field: field}
+}
+
+// Factor 字段值乘以的系数，默认 1
+func (f *FieldValueFactorFunction) Factor(factor float64) *FieldValueFactorFunction {
+	f.factor = &factor
+	return f
+}
+
+// Modifier 对字段值的处理，none、log1p、sqrt 等，log 和 ln 在值为 0 时会出错，一般用 log1p
+func (f *FieldValueFactorFunction) Modifier(modifier string) *FieldValueFactorFunction {
+	f.modifier = modifier
+	return f
+}
+
+// Missing 文档没有该字段时使用的值，不设置时没有该字段的文档会报错
+func (f *FieldValueFactorFunction) Missing(missing float64) *FieldValueFactorFunction {
+	f.missing = &missing
+	return f
+}
+
+// Filter 只对满足条件的文档生效
+func (f *FieldValueFactorFunction) Filter(filter Query) *FieldValueFactorFunction {
+	f.filter = filter
+	return f
+}
+
+// Weight 得分乘以的权重
+func (f *FieldValueFactorFunction) Weight(weight float64) *FieldValueFactorFunction {
+	f.weight = &weight
+	return f
+}
+
+// Map 实现 ScoreFunction 接口
+func (f *FieldValueFactorFunction) Map() map[string]interface{} {
+	params := map[string]interface{}{"field": f.field}
+	if f.factor != nil {
+		params["factor"] = *f.factor
+	}
+	if f.modifier != "" {
+		params["modifier"] = f.modifier
+	}
+	if f.missing != nil {
+		params["missing"] = *f.missing
+	}
+	return f.wrap(map[string]interface{}{
+		"field_value_factor": params,
+	})
+}
+
+// Validate 实现 ScoreFunction 接口
+func (f *FieldValueFactorFunction) Validate() error {
+	if f.field == "" {
+		return fmt.Errorf("field_value_factor requires a field")
+	}
+	if f.modifier != "" && !validModifiers[f.modifier] {
+		return fmt.Errorf("invalid field_value_factor modifier %q", f.modifier)
+	}
+	return f.validate()
+}
+
+// DecayFunction 离 origin 越远得分越低，可以用于日期、数值和 geo_point 字段
+type DecayFunction struct {
+	scoreFunction
+	decayType      string
+	field          string
+	origin         interface{}
+	scale          interface{}
+	offset         interface{}
+	decay          *float64
+	multiValueMode string
+}
+
+// GaussDecay 高斯衰减，origin 附近下降慢，远处下降快。
+// 日期字段：GaussDecay("publish_time", "now", "10d")；geo 字段：GaussDecay("location", "31.23,121.47", "2km")
+func GaussDecay(field string, origin, scale interface{}) *DecayFunction {
+	return &DecayFunction{decayType: "gauss", field: field, origin: origin, scale: scale}
+}
+
+// ExpDecay 指数衰减，离开 origin 后迅速下降
+func ExpDecay(field string, origin, scale interface{}) *DecayFunction {
+	return &DecayFunction{decayType: "exp", field: field, origin: origin, scale: scale}
+}
+
+// LinearDecay 线性衰减，超出范围后得分为 0
+func LinearDecay(field string, origin, scale interface{}) *DecayFunction {
+	return &DecayFunction{decayType: "linear", field: field, origin: origin, scale: scale}
+}
+
+// Offset 距离 origin 在 offset 以内的文档不衰减
+func (f *DecayFunction) Offset(offset interface{}) *DecayFunction {
+	f.offset = offset
+	return f
+}
+
+// Decay 距离为 scale 时的得分，默认 0.5，需要在 0 和 1 之间
+func (f *DecayFunction) Decay(decay float64) *DecayFunction {
+	f.decay = &decay
+	return f
+}
+
+// MultiValueMode 字段有多个值时使用哪个值计算距离，min（默认）、max、avg、sum
+func (f *DecayFunction) MultiValueMode(mode string) *DecayFunction {
+	f.multiValueMode = mode
+	return f
+}
+
+// Filter 只对满足条件的文档生效
+func (f *DecayFunction) Filter(filter Query) *DecayFunction {
+	f.filter = filter
+	return f
+}
+
+// Weight 得分乘以的权重
+func (f *DecayFunction) Weight(weight float64) *DecayFunction {
+	f.weight = &weight
+	return f
+}
+
+// Map 实现 ScoreFunction 接口
+func (f *DecayFunction) Map() map[string]interface{} {
+	params := map[string]interface{}{"scale": f.scale}
+	if f.origin != nil {
+		params["origin"] = f.origin
+	}
+	if f.offset != nil {
+		params["offset"] = f.offset
+	}
+	if f.decay != nil {
+		params["decay"] = *f.decay
+	}
+	function := map[string]interface{}{
+		f.field: params,
+	}
+	if f.multiValueMode != "" {
+		function["multi_value_mode"] = f.multiValueMode
+	}
+	return f.wrap(map[string]interface{}{
+		f.decayType: function,
+	})
+}
+
+// Validate 实现 ScoreFunction 接口
+func (f *DecayFunction) Validate() error {
+	if f.field == "" {
+		return fmt.Errorf("%s decay requires a field", f.decayType)
+	}
+	if f.scale == nil || f.scale == "" {
+		return fmt.Errorf("%s decay on %s requires a scale", f.decayType, f.field)
+	}
+	if f.decay != nil && (*f.decay <= 0 || *f.decay >= 1) {
+		return fmt.Errorf("%s decay on %s: decay must be between 0 and 1, got %v", f.decayType, f.field, *f.decay)
+	}
+	switch f.multiValueMode {
+	case "", "min", "max", "avg", "sum":
+	default:
+		return fmt.Errorf("%s decay on %s: invalid multi_value_mode %q", f.decayType, f.field, f.multiValueMode)
+	}
+	return f.validate()
+}
+
+// RandomScoreFunction 随机打分，设置 seed 后同一个 seed 的顺序不变，可以用于给每个用户固定的随机排序
+type RandomScoreFunction struct {
+	scoreFunction
+	seed  interface{}
+	field string
+}
+
+// RandomScore 创建 random_score 打分函数
+func RandomScore() *RandomScoreFunction {
+	return &RandomScoreFunction{}
+}
+
+// Seed 随机种子，例如用户 id；设置 seed 时需要同时设置 Field
+func (f *RandomScoreFunction) Seed(seed interface{}) *RandomScoreFunction {
+	f.seed = seed
+	return f
+}
+
+// Field 和 seed 一起计算随机值的字段，一般用 _seq_no
+func (f *RandomScoreFunction) Field(field string) *RandomScoreFunction {
+	f.field = field
+	return f
+}
+
+// Filter 只对满足条件的文档生效
+func (f *RandomScoreFunction) Filter(filter Query) *RandomScoreFunction {
+	f.filter = filter
+	return f
+}
+
+// Weight 得分乘以的权重
+func (f *RandomScoreFunction) Weight(weight float64) *RandomScoreFunction {
+	f.weight = &weight
+	return f
+}
+
+// Map 实现 ScoreFunction 接口
+func (f *RandomScoreFunction) Map() map[string]interface{} {
+	params := map[string]interface{}{}
+	if f.seed != nil {
+		params["seed"] = f.seed
+	}
+	if f.field != "" {
+		params["field"] = f.field
+	}
+	return f.wrap(map[string]interface{}{
+		"random_score": params,
+	})
+}
+
+// Validate 实现 ScoreFunction 接口
+func (f *RandomScoreFunction) Validate() error {
+	if f.seed != nil && f.field == "" {
+		return fmt.Errorf("random_score with a seed requires a field, e.g. _seq_no")
+	}
+	return f.validate()
+}
+
+// ScriptScoreFunction 用 painless 脚本打分，脚本中可以用 _score 取查询得分，用 params 取参数
+type ScriptScoreFunction struct {
+	scoreFunction
+	script *Script
+}
+
+// ScriptScore 创建 script_score 打分函数，字段名等变化的值放在 params 中，不要拼接到脚本里
+func ScriptScore(source string, params map[string]interface{}) *ScriptScoreFunction {
+	return ScriptScoreWith(NewScript(source).Params(params))
+}
+
+// ScriptScoreWith 用 Script 创建 script_score 打分函数，可以引用存储脚本
+func ScriptScoreWith(script *Script) *ScriptScoreFunction {
+	return &ScriptScoreFunction{script: script}
+}
+
+// Filter 只对满足条件的文档生效
+func (f *ScriptScoreFunction) Filter(filter Query) *ScriptScoreFunction {
+	f.filter = filter
+	return f
+}
+
+// Weight 得分乘以的权重
+func (f *ScriptScoreFunction) Weight(weight float64) *ScriptScoreFunction {
+	f.weight = &weight
+	return f
+}
+
+// Map 实现 ScoreFunction 接口，script 为 nil 时不生成 script，由 Validate 报错
+func (f *ScriptScoreFunction) Map() map[string]interface{} {
+	scriptScore := map[string]interface{}{}
+	if f.script != nil {
+		scriptScore["script"] = f.script.Map()
+	}
+	return f.wrap(map[string]interface{}{
+		"script_score": scriptScore,
+	})
+}
+
+// Validate 实现 ScoreFunction 接口
+func (f *ScriptScoreFunction) Validate() error {
+	if f.script == nil {
+		return fmt.Errorf("script_score requires a script")
+	}
+	if err := f.script.Validate(); err != nil {
+		return fmt.Errorf("script_score: %s", err)
+	}
+	return f.validate()
+}
+
+// FunctionScoreQuery 用一个或多个打分函数调整查询得分
+//
+//	FunctionScore(Match("ik.title", "关键词")).
+//		Add(FieldValueFactor("signals.score").Modifier("log1p").Missing(0)).
+//		Add(GaussDecay("publish_time", "now", "7d").Weight(2)).
+//		Add(Weight(3).Filter(Term("entity_type", 1))).
+//		ScoreMode("sum").
+//		BoostMode("multiply")
+type FunctionScoreQuery struct {
+	query     Query
+	functions []ScoreFunction
+	scoreMode string
+	boostMode string
+	maxBoost  *float64
+	minScore  *float64
+	boost     *float64
+}
+
+// FunctionScore 创建 function_score 查询，query 为 nil 时匹配所有文档
+func FunctionScore(query Query) *FunctionScoreQuery {
+	return &FunctionScoreQuery{query: query}
+}
+
+// Add 添加打分函数，nil 会被忽略
+func (q *FunctionScoreQuery) Add(functions ...ScoreFunction) *FunctionScoreQuery {
+	for _, f := range functions {
+		if f != nil {
+			q.functions = append(q.functions, f)
+		}
+	}
+	return q
+}
+
+// ScriptScore 添加一个脚本打分函数，params 会作为脚本参数传入
+func (q *FunctionScoreQuery) ScriptScore(source string, params map[string]interface{}) *FunctionScoreQuery {
+	return q.Add(ScriptScore(source, params))
+}
+
+// ScoreMode 多个打分函数得分的合并方式，multiply（默认）、sum、avg、first、max、min
+func (q *FunctionScoreQuery) ScoreMode(scoreMode string) *FunctionScoreQuery {
+	q.scoreMode = scoreMode
+	return q
+}
+
+// BoostMode 函数得分与查询得分的合并方式，multiply（默认）、replace、sum、avg、max、min
+func (q *FunctionScoreQuery) BoostMode(boostMode string) *FunctionScoreQuery {
+	q.boostMode = boostMode
+	return q
+}
+
+// MaxBoost 函数得分的上限
+func (q *FunctionScoreQuery) MaxBoost(maxBoost float64) *FunctionScoreQuery {
+	q.maxBoost = &maxBoost
+	return q
+}
+
+// MinScore 最终得分低于该值的文档不返回
+func (q *FunctionScoreQuery) MinScore(minScore float64) *FunctionScoreQuery {
+	q.minScore = &minScore
+	return q
+}
+
+// Boost 调节该条件的得分权重
+func (q *FunctionScoreQuery) Boost(boost float64) *FunctionScoreQuery {
+	q.boost = &boost
+	return q
+}
+
+// Validate 发送前校验参数，包括每个打分函数和子查询
+func (q *FunctionScoreQuery) Validate() error {
+	if len(q.functions) == 0 {
+		return fmt.Errorf("function_score requires at least one function")
+	}
+	if q.scoreMode != "" && !validScoreModes[q.scoreMode] {
+		return fmt.Errorf("invalid function_score score_mode %q", q.scoreMode)
+	}
+	if q.boostMode != "" && !validBoostModes[q.boostMode] {
+		return fmt.Errorf("invalid function_score boost_mode %q", q.boostMode)
+	}
+	if q.maxBoost != nil && *q.maxBoost <= 0 {
+		return fmt.Errorf("function_score max_boost must be positive, got %v", *q.maxBoost)
+	}
+	for i, f := range q.functions {
+		if err := f.Validate(); err != nil {
+			return fmt.Errorf("function_score function %d: %s", i, err)
+		}
+	}
+	if q.query != nil {
+		return validateQuery(q.query)
+	}
+	return nil
+}
+
+// Map 实现 Query 接口
+func (q *FunctionScoreQuery) Map() map[string]interface{} {
+	params := map[string]interface{}{}
+	if q.query != nil {
+		params["query"] = q.query.Map()
+	}
+	if len(q.functions) > 0 {
+		functions := make([]map[string]interface{}, 0, len(q.functions))
+		for _, f := range q.functions {
+			functions = append(functions, f.Map())
+		}
+		params["functions"] = functions
+	}
+	if q.scoreMode != "" {
+		params["score_mode"] = q.scoreMode
+	}
+	if q.boostMode != "" {
+		params["boost_mode"] = q.boostMode
+	}
+	if q.maxBoost != nil {
+		params["max_boost"] = *q.maxBoost
+	}
+	if q.minScore != nil {
+		params["min_score"] = *q.minScore
+	}
+	if q.boost != nil {
+		params["boost"] = *q.boost
+	}
+	return map[string]interface{}{
+		"function_score": params,
+	}
+}
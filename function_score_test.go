@@ -0,0 +1,74 @@
+package elasticsearch
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// failTransport 收到请求时让测试失败，用来确认参数错误在发送前就被拦截
+type failTransport struct {
+	t *testing.T
+}
+
+func (f failTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.t.Fatalf("unexpected request %s %s", req.Method, req.URL.Path)
+	return nil, nil
+}
+
+func TestScriptScoreWithNilScript(t *testing.T) {
+	q := FunctionScore(MatchAll()).Add(ScriptScoreWith(nil))
+	q.Map()
+	if _, err := NewSearchBody().Query(q).Build(); err == nil {
+		t.Fatal("Build accepted script_score without a script")
+	}
+}
+
+func TestFunctionScoreIgnoresNilFunction(t *testing.T) {
+	q := FunctionScore(MatchAll()).Add(nil, Weight(2))
+	functions := q.Map()["function_score"].(map[string]interface{})["functions"].([]map[string]interface{})
+	if len(functions) != 1 {
+		t.Fatalf("functions = %v", functions)
+	}
+	if err := FunctionScore(MatchAll()).Add(nil).Validate(); err == nil {
+		t.Fatal("function_score with only nil functions passed validation")
+	}
+}
+
+func TestScriptScoreQueryBuild(t *testing.T) {
+	body, err := scriptScoreQuery(Match("entity_id", "e1"), "signals.score", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := body["query"].(map[string]interface{})["function_score"].(map[string]interface{})
+	if params["boost_mode"] != "replace" || len(params["functions"].([]map[string]interface{})) != 1 {
+		t.Fatalf("function_score = %v", params)
+	}
+	if _, err := scriptScoreQuery(FunctionScore(nil), "signals.score", 2); err == nil {
+		t.Fatal("invalid inner function_score passed Build")
+	}
+}
+
+func TestInvalidQueryRejectedBeforeRequest(t *testing.T) {
+	ctx := context.Background()
+	client := newTransportClient(t, failTransport{t})
+	invalid := Bool().Must(FunctionScore(MatchAll()))
+
+	if _, err := countDocuments(ctx, client, "zeus", invalid); err == nil {
+		t.Fatal("countDocuments accepted an invalid query")
+	}
+	if _, err := ReindexWithAlias(ctx, client, ReindexConfig{Alias: "zeus", Query: invalid}); err == nil {
+		t.Fatal("ReindexWithAlias accepted an invalid query")
+	}
+	if _, err := DeleteByQuery(ctx, client, ByQueryConfig{Index: "zeus", Query: invalid}); err == nil {
+		t.Fatal("DeleteByQuery accepted an invalid query")
+	}
+	if _, err := ExecutePainless(ctx, client, PainlessExecuteRequest{
+		Script:  NewScript("_score"),
+		Context: "score",
+		Index:   "zeus",
+		Query:   invalid,
+	}); err == nil {
+		t.Fatal("ExecutePainless accepted an invalid query")
+	}
+}
@@ -1,5 +1,9 @@
 module pengjj/elasticsearch
 
-go 1.15
+go 1.18
 
-require github.com/elastic/go-elasticsearch/v7 v7.10.0 // indirect
+require (
+	github.com/elastic/go-elasticsearch/v7 v7.10.0
+	github.com/pkg/errors v0.9.1
+	gopkg.in/yaml.v3 v3.0.1
+)
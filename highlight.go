@@ -0,0 +1,128 @@
+package elasticsearch
+
+// ================================ 高亮 ================================
+
+// Highlight 高亮配置，结果在每条命中的 Hit.Highlights 中，key 为字段名
+//
+//	NewSearchBody().Query(Match("ik.title", "关键词")).
+//		Highlight(NewHighlight().Fields("ik.*").PreTags("<em>").PostTags("</em>"))
+type Highlight struct {
+	fields []*HighlightField
+	params map[string]interface{}
+}
+
+// NewHighlight 创建高亮配置
+func NewHighlight() *Highlight {
+	return &Highlight{params: map[string]interface{}{}}
+}
+
+// Fields 需要高亮的字段，支持 ik.* 这样的通配符，使用全局的高亮参数
+func (h *Highlight) Fields(names ...string) *Highlight {
+	for _, name := range names {
+		h.fields = append(h.fields, NewHighlightField(name))
+	}
+	return h
+}
+
+// Field 添加一个单独设置参数的高亮字段
+func (h *Highlight) Field(field *HighlightField) *Highlight {
+	h.fields = append(h.fields, field)
+	return h
+}
+
+// PreTags 高亮片段前面的标签，默认 <em>
+func (h *Highlight) PreTags(tags ...string) *Highlight {
+	h.params["pre_tags"] = tags
+	return h
+}
+
+// PostTags 高亮片段后面的标签，默认 </em>
+func (h *Highlight) PostTags(tags ...string) *Highlight {
+	h.params["post_tags"] = tags
+	return h
+}
+
+// FragmentSize 每个高亮片段的字符数，默认 100
+func (h *Highlight) FragmentSize(size int) *Highlight {
+	h.params["fragment_size"] = size
+	return h
+}
+
+// NumberOfFragments 每个字段最多返回的片段数，默认 5；为 0 时返回整个字段内容
+func (h *Highlight) NumberOfFragments(n int) *Highlight {
+	h.params["number_of_fragments"] = n
+	return h
+}
+
+// Type 高亮器类型，unified（默认）、plain 或 fvh
+func (h *Highlight) Type(highlighterType string) *Highlight {
+	h.params["type"] = highlighterType
+	return h
+}
+
+// RequireFieldMatch 为 false 时查询其他字段命中的词也会在这些字段中高亮，默认 true
+func (h *Highlight) RequireFieldMatch(require bool) *Highlight {
+	h.params["require_field_match"] = require
+	return h
+}
+
+// Map 生成请求体中的 highlight
+func (h *Highlight) Map() map[string]interface{} {
+	highlight := make(map[string]interface{}, len(h.params)+1)
+	for k, v := range h.params {
+		highlight[k] = v
+	}
+	fields := make(map[string]interface{}, len(h.fields))
+	for _, field := range h.fields {
+		fields[field.name] = field.params
+	}
+	highlight["fields"] = fields
+	return highlight
+}
+
+// HighlightField 单个高亮字段的参数，没有设置的参数使用 Highlight 中的全局参数
+type HighlightField struct {
+	name   string
+	params map[string]interface{}
+}
+
+// NewHighlightField 创建高亮字段
+func NewHighlightField(name string) *HighlightField {
+	return &HighlightField{name: name, params: map[string]interface{}{}}
+}
+
+// FragmentSize 每个高亮片段的字符数
+func (f *HighlightField) FragmentSize(size int) *HighlightField {
+	f.params["fragment_size"] = size
+	return f
+}
+
+// NumberOfFragments 最多返回的片段数，为 0 时返回整个字段内容
+func (f *HighlightField) NumberOfFragments(n int) *HighlightField {
+	f.params["number_of_fragments"] = n
+	return f
+}
+
+// Type 高亮器类型，unified、plain 或 fvh
+func (f *HighlightField) Type(highlighterType string) *HighlightField {
+	f.params["type"] = highlighterType
+	return f
+}
+
+// PreTags 该字段高亮片段前面的标签
+func (f *HighlightField) PreTags(tags ...string) *HighlightField {
+	f.params["pre_tags"] = tags
+	return f
+}
+
+// PostTags 该字段高亮片段后面的标签
+func (f *HighlightField) PostTags(tags ...string) *HighlightField {
+	f.params["post_tags"] = tags
+	return f
+}
+
+// RequireFieldMatch 是否只高亮该字段自己命中的词
+func (f *HighlightField) RequireFieldMatch(require bool) *HighlightField {
+	f.params["require_field_match"] = require
+	return f
+}
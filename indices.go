@@ -0,0 +1,275 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+)
+
+// ================================ 索引管理 ================================
+
+// DeleteIndexOptions 删除索引的选项
+type DeleteIndexOptions struct {
+	// 允许使用通配符、_all 和别名，默认拒绝，避免误删多个索引
+	AllowWildcard bool
+	// 只列出会被删除的索引和文档数，不真正删除
+	DryRun bool
+	// 非空时删除前先在该快照仓库中创建快照，快照失败则不删除
+	SnapshotRepository string
+	// 快照名称，为空时使用 delete-<时间>
+	SnapshotName string
+}
+
+// IndexInfo 索引名和文档数
+type IndexInfo struct {
+	Index     string
+	DocsCount int64
+}
+
+// DeleteIndexResult 删除索引的结果，DryRun 时 Indices 为将要删除的索引
+type DeleteIndexResult struct {
+	Indices  []IndexInfo
+	Snapshot string
+	DryRun   bool
+}
+
+// UnsafeIndexPatternError 索引名包含通配符或者 _all，或者是别名，并且没有设置 AllowWildcard
+type UnsafeIndexPatternError struct {
+	Pattern string
+	// 别名解析出来的具体索引
+	Indices []string
+}
+
+// Error 实现 error 接口
+func (e *UnsafeIndexPatternError) Error() string {
+	if len(e.Indices) > 0 {
+		return fmt.Sprintf("refuse to delete %q which resolves to indices %v, set AllowWildcard to delete aliases or multiple indices", e.Pattern, e.Indices)
+	}
+	return fmt.Sprintf("refuse to delete index pattern %q, set AllowWildcard to delete multiple indices", e.Pattern)
+}
+
+// DeleteIndex 删除索引，index 可以是逗号分隔的多个索引名。
+// 先把索引名解析成具体的索引再删除，没有设置 AllowWildcard 时每个名称都必须是具体的索引，
+// 是别名时拒绝删除（es 本身也不允许 DELETE 别名）；索引不存在时返回的错误满足 IsNotFound
+func DeleteIndex(ctx context.Context, client *elasticsearch.Client, index string, options DeleteIndexOptions) (*DeleteIndexResult, error) {
+	names := splitIndexNames(index)
+	if len(names) == 0 {
+		return nil, &UnsafeIndexPatternError{Pattern: index}
+	}
+	if !options.AllowWildcard {
+		for _, name := range names {
+			if isIndexPattern(name) {
+				return nil, &UnsafeIndexPatternError{Pattern: index}
+			}
+		}
+	}
+
+	indices, err := catIndices(ctx, client, names)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolve index %s", index)
+	}
+	if !options.AllowWildcard {
+		if err := checkConcreteIndices(index, names, indices); err != nil {
+			return nil, err
+		}
+	}
+	result := &DeleteIndexResult{Indices: indices, DryRun: options.DryRun}
+	if options.DryRun || len(indices) == 0 {
+		return result, nil
+	}
+
+	concrete := make([]string, 0, len(indices))
+	for _, info := range indices {
+		concrete = append(concrete, info.Index)
+	}
+	if options.SnapshotRepository != "" {
+		result.Snapshot = options.SnapshotName
+		if result.Snapshot == "" {
+			result.Snapshot = "delete-" + time.Now().Format("20060102-150405")
+		}
+		if err := createSnapshot(ctx, client, options.SnapshotRepository, result.Snapshot, concrete); err != nil {
+			return result, errors.Wrapf(err, "snapshot %s/%s before delete", options.SnapshotRepository, result.Snapshot)
+		}
+	}
+	if err := deleteIndex(ctx, client, concrete...); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// splitIndexNames 拆分逗号分隔的索引名
+func splitIndexNames(index string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(index, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// isIndexPattern 是否会匹配多个索引，-name 这样的排除写法只能和通配符一起使用
+func isIndexPattern(name string) bool {
+	return name == "_all" || strings.ContainsAny(name, "*?") || strings.HasPrefix(name, "-")
+}
+
+// checkConcreteIndices 解析出来的索引必须和 names 完全一致，多出来的索引说明有名称是别名
+func checkConcreteIndices(index string, names []string, indices []IndexInfo) error {
+	requested := make(map[string]bool, len(names))
+	for _, name := range names {
+		requested[name] = true
+	}
+	resolved := make(map[string]bool, len(indices))
+	concrete := make([]string, 0, len(indices))
+	unsafe := false
+	for _, info := range indices {
+		resolved[info.Index] = true
+		concrete = append(concrete, info.Index)
+		if !requested[info.Index] {
+			unsafe = true
+		}
+	}
+	for _, name := range names {
+		if !resolved[name] {
+			unsafe = true
+		}
+	}
+	if unsafe {
+		return &UnsafeIndexPatternError{Pattern: index, Indices: concrete}
+	}
+	return nil
+}
+
+// catIndices 把索引名、别名和通配符解析成具体的索引，并返回文档数
+func catIndices(ctx context.Context, client *elasticsearch.Client, names []string) ([]IndexInfo, error) {
+	res, err := client.Cat.Indices(
+		client.Cat.Indices.WithContext(ctx),
+		client.Cat.Indices.WithIndex(names...),
+		client.Cat.Indices.WithFormat("json"),
+		client.Cat.Indices.WithH("index", "docs.count"),
+	)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var rows []struct {
+		Index string `json:"index"`
+		// cat 接口返回的数字是字符串，关闭的索引没有文档数
+		DocsCount string `json:"docs.count"`
+	}
+	if err := decodeResponse(res, &rows); err != nil {
+		return nil, err
+	}
+	indices := make([]IndexInfo, 0, len(rows))
+	for _, row := range rows {
+		count, _ := strconv.ParseInt(row.DocsCount, 10, 64)
+		indices = append(indices, IndexInfo{Index: row.Index, DocsCount: count})
+	}
+	return indices, nil
+}
+
+// createSnapshot 创建只包含指定索引的快照并等待完成
+func createSnapshot(ctx context.Context, client *elasticsearch.Client, repository, snapshot string, indices []string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"indices":              strings.Join(indices, ","),
+		"include_global_state": false,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	res, err := client.Snapshot.Create(repository, snapshot,
+		client.Snapshot.Create.WithContext(ctx),
+		client.Snapshot.Create.WithBody(bytes.NewReader(body)),
+		client.Snapshot.Create.WithWaitForCompletion(true),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var r struct {
+		Snapshot struct {
+			State    string            `json:"state"`
+			Failures []json.RawMessage `json:"failures"`
+		} `json:"snapshot"`
+	}
+	if err := decodeResponse(res, &r); err != nil {
+		return err
+	}
+	if r.Snapshot.State != "SUCCESS" {
+		return fmt.Errorf("snapshot %s finished with state %s, %d shards failed", snapshot, r.Snapshot.State, len(r.Snapshot.Failures))
+	}
+	return nil
+}
+
+// createIndex 创建索引，body 为 nil 时使用默认配置
+func createIndex(ctx context.Context, client *elasticsearch.Client, index string, body map[string]interface{}) error {
+	opts := []func(*esapi.IndicesCreateRequest){client.Indices.Create.WithContext(ctx)}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		opts = append(opts, client.Indices.Create.WithBody(bytes.NewReader(data)))
+	}
+	res, err := client.Indices.Create(index, opts...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeResponse(res, nil)
+}
+
+// deleteIndex 删除具体的索引
+func deleteIndex(ctx context.Context, client *elasticsearch.Client, indices ...string) error {
+	res, err := client.Indices.Delete(indices, client.Indices.Delete.WithContext(ctx))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeResponse(res, nil)
+}
+
+// refreshIndex 刷新索引，使刚写入的文档可以被查询和计数
+func refreshIndex(ctx context.Context, client *elasticsearch.Client, index string) error {
+	res, err := client.Indices.Refresh(
+		client.Indices.Refresh.WithContext(ctx),
+		client.Indices.Refresh.WithIndex(index),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeResponse(res, nil)
+}
+
+// countDocuments 统计文档数，query 为 nil 时统计全部
+func countDocuments(ctx context.Context, client *elasticsearch.Client, index string, query Query) (int64, error) {
+	opts := []func(*esapi.CountRequest){
+		client.Count.WithContext(ctx),
+		client.Count.WithIndex(index),
+	}
+	if query != nil {
+		if err := validateQuery(query); err != nil {
+			return 0, err
+		}
+		data, err := json.Marshal(map[string]interface{}{"query": query.Map()})
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		opts = append(opts, client.Count.WithBody(bytes.NewReader(data)))
+	}
+	res, err := client.Count(opts...)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	var r struct {
+		Count int64 `json:"count"`
+	}
+	if err := decodeResponse(res, &r); err != nil {
+		return 0, err
+	}
+	return r.Count, nil
+}
@@ -0,0 +1,104 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// indicesTransport 模拟别名 zeus 指向 zeus_v1、zeus_v2，记录删除的索引
+func indicesTransport(deleted *[]string) roundTripFunc {
+	return func(req *http.Request) (int, string) {
+		switch {
+		case req.Method == http.MethodGet && strings.HasPrefix(req.URL.Path, "/_cat/indices/"):
+			// 和 es 一样，同一个索引只返回一次
+			resolved := map[string]bool{}
+			for _, name := range strings.Split(strings.TrimPrefix(req.URL.Path, "/_cat/indices/"), ",") {
+				switch name {
+				case "zeus":
+					resolved["zeus_v1"], resolved["zeus_v2"] = true, true
+				case "zeus_v1", "zeus_v2":
+					resolved[name] = true
+				default:
+					return http.StatusNotFound, `{"error":{"type":"index_not_found_exception","reason":"no such index"},"status":404}`
+				}
+			}
+			var rows []string
+			for _, index := range sortedKeys(resolved) {
+				rows = append(rows, `{"index":"`+index+`","docs.count":"`+map[string]string{"zeus_v1": "10", "zeus_v2": "12"}[index]+`"}`)
+			}
+			return http.StatusOK, "[" + strings.Join(rows, ",") + "]"
+		case req.Method == http.MethodDelete:
+			*deleted = append(*deleted, strings.Split(strings.TrimPrefix(req.URL.Path, "/"), ",")...)
+			return http.StatusOK, `{"acknowledged":true}`
+		}
+		return http.StatusBadRequest, `{"error":"unexpected request","status":400}`
+	}
+}
+
+func TestDeleteIndexRefusesAlias(t *testing.T) {
+	var deleted []string
+	client := newTransportClient(t, indicesTransport(&deleted))
+
+	for _, index := range []string{"zeus", "zeus_v1,zeus"} {
+		_, err := DeleteIndex(context.Background(), client, index, DeleteIndexOptions{})
+		var unsafe *UnsafeIndexPatternError
+		if !errors.As(err, &unsafe) {
+			t.Fatalf("DeleteIndex(%q) = %v, want UnsafeIndexPatternError", index, err)
+		}
+		if len(unsafe.Indices) != 2 {
+			t.Fatalf("resolved indices = %v", unsafe.Indices)
+		}
+	}
+	if _, err := DeleteIndex(context.Background(), client, "zeus", DeleteIndexOptions{DryRun: true}); err == nil {
+		t.Fatal("dry run of an alias was accepted")
+	}
+	if len(deleted) != 0 {
+		t.Fatalf("deleted %v", deleted)
+	}
+}
+
+func TestDeleteIndexConcrete(t *testing.T) {
+	var deleted []string
+	client := newTransportClient(t, indicesTransport(&deleted))
+
+	result, err := DeleteIndex(context.Background(), client, "zeus_v1", DeleteIndexOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Indices) != 1 || result.Indices[0].DocsCount != 10 {
+		t.Fatalf("result = %+v", result)
+	}
+	if len(deleted) != 1 || deleted[0] != "zeus_v1" {
+		t.Fatalf("deleted %v", deleted)
+	}
+}
+
+func TestDeleteIndexAliasWithAllowWildcard(t *testing.T) {
+	var deleted []string
+	client := newTransportClient(t, indicesTransport(&deleted))
+
+	if _, err := DeleteIndex(context.Background(), client, "zeus", DeleteIndexOptions{AllowWildcard: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 2 {
+		t.Fatalf("deleted %v, want zeus_v1 and zeus_v2", deleted)
+	}
+}
+
+func TestDeleteIndexRefusesPatterns(t *testing.T) {
+	var deleted []string
+	client := newTransportClient(t, indicesTransport(&deleted))
+	for _, index := range []string{"_all", "zeus*", "-zeus_v1", " , "} {
+		_, err := DeleteIndex(context.Background(), client, index, DeleteIndexOptions{})
+		var unsafe *UnsafeIndexPatternError
+		if !errors.As(err, &unsafe) {
+			t.Fatalf("DeleteIndex(%q) = %v, want UnsafeIndexPatternError", index, err)
+		}
+	}
+	if len(deleted) != 0 {
+		t.Fatalf("deleted %v", deleted)
+	}
+}
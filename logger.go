@@ -0,0 +1,142 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7"
+)
+
+// ================================ 日志 ================================
+
+// Logger 日志接口，keysAndValues 为交替出现的 key、value，和 slog.Logger 的方法签名一致，
+// *slog.Logger 可以直接使用；zap 可以用 SugaredLogger 的 Debugw 等方法包装一层
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// Level 日志级别
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String 实现 fmt.Stringer 接口
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// nopLogger 不输出任何日志，没有设置 Logger 时使用
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// stdLogger 使用标准库 log 输出 key=value 格式的日志
+type stdLogger struct {
+	logger *log.Logger
+	level  Level
+}
+
+// NewStdLogger 使用标准库 log 输出日志，低于 level 的日志不输出；logger 为 nil 时使用 log.Default()
+func NewStdLogger(logger *log.Logger, level Level) Logger {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &stdLogger{logger: logger, level: level}
+}
+
+func (l *stdLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.log(LevelDebug, msg, keysAndValues)
+}
+
+func (l *stdLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.log(LevelInfo, msg, keysAndValues)
+}
+
+func (l *stdLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.log(LevelWarn, msg, keysAndValues)
+}
+
+func (l *stdLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.log(LevelError, msg, keysAndValues)
+}
+
+func (l *stdLogger) log(level Level, msg string, keysAndValues []interface{}) {
+	if level < l.level {
+		return
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "level=%s msg=%q", level, msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		// 落单的 value 和 slog 一样使用 !BADKEY
+		if i+1 == len(keysAndValues) {
+			fmt.Fprintf(&sb, " !BADKEY=%v", keysAndValues[i])
+			break
+		}
+		fmt.Fprintf(&sb, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+	}
+	l.logger.Print(sb.String())
+}
+
+// Client 在 elasticsearch.Client 的基础上加上日志，可以直接调用 elasticsearch.Client 的方法
+type Client struct {
+	*elasticsearch.Client
+	logger Logger
+}
+
+// WrapClient 包装 elasticsearch.Client，logger 为 nil 时不输出日志
+func WrapClient(client *elasticsearch.Client, logger Logger) *Client {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+	return &Client{Client: client, logger: logger}
+}
+
+// Logger 客户端使用的日志
+func (c *Client) Logger() Logger {
+	return c.logger
+}
+
+// retryPolicy 策略中没有设置 OnRetry 时，用客户端的日志记录每次重试，keysAndValues 会加在每条日志中
+func (c *Client) retryPolicy(policy RetryPolicy, keysAndValues ...interface{}) RetryPolicy {
+	if policy.OnRetry != nil {
+		return policy
+	}
+	policy.OnRetry = func(attempt int, backoff time.Duration, err error) {
+		fields := make([]interface{}, 0, len(keysAndValues)+6)
+		fields = append(fields, keysAndValues...)
+		fields = append(fields, "attempt", attempt, "backoff", backoff, "error", err)
+		c.logger.Warn("retry", fields...)
+	}
+	return policy
+}
+
+// scrollIDPrefix 日志中只输出 scroll id 的前缀，完整的 scroll id 很长
+func scrollIDPrefix(scrollID string) string {
+	if len(scrollID) > 16 {
+		return scrollID[:16] + "..."
+	}
+	return scrollID
+}
@@ -0,0 +1,207 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logEntry 一条记录下来的日志
+type logEntry struct {
+	level  Level
+	msg    string
+	fields map[string]interface{}
+}
+
+// recordingLogger 记录所有日志，用于检查日志内容
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) Debug(msg string, kv ...interface{}) { l.record(LevelDebug, msg, kv) }
+func (l *recordingLogger) Info(msg string, kv ...interface{})  { l.record(LevelInfo, msg, kv) }
+func (l *recordingLogger) Warn(msg string, kv ...interface{})  { l.record(LevelWarn, msg, kv) }
+func (l *recordingLogger) Error(msg string, kv ...interface{}) { l.record(LevelError, msg, kv) }
+
+func (l *recordingLogger) record(level Level, msg string, kv []interface{}) {
+	fields := map[string]interface{}{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		fields[fmt.Sprint(kv[i])] = kv[i+1]
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, fields: fields})
+}
+
+// find 按级别和内容查找日志
+func (l *recordingLogger) find(level Level, msg string) []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var found []logEntry
+	for _, e := range l.entries {
+		if e.level == level && e.msg == msg {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+func TestBulkLogsRequestAndRetry(t *testing.T) {
+	attempts := map[string]int{}
+	recorder := &bulkRecorder{status: func(id string) int {
+		attempts[id]++
+		if id == "2" && attempts[id] == 1 {
+			return http.StatusTooManyRequests
+		}
+		return http.StatusCreated
+	}}
+	logger := &recordingLogger{}
+	client := WrapClient(newTransportClient(t, recorder.transport(t)), logger)
+
+	documents := []interface{}{versionedDocument{ID: "1"}, versionedDocument{ID: "2"}}
+	if _, err := performESInsert(client, "zeus", documents, WithRetryPolicy(fastRetryPolicy)); err != nil {
+		t.Fatal(err)
+	}
+
+	retries := logger.find(LevelWarn, "retry")
+	if len(retries) != 1 {
+		t.Fatalf("retry logs = %+v, want 1", retries)
+	}
+	retry := retries[0].fields
+	if retry["action"] != "bulk" || retry["index"] != "zeus" || retry["attempt"] != 1 || retry["error"] == nil {
+		t.Fatalf("retry fields = %v", retry)
+	}
+	if _, ok := retry["backoff"].(time.Duration); !ok {
+		t.Fatalf("backoff = %v", retry["backoff"])
+	}
+
+	requests := logger.find(LevelDebug, "bulk")
+	if len(requests) != 1 {
+		t.Fatalf("bulk logs = %+v, want 1", requests)
+	}
+	request := requests[0].fields
+	if request["index"] != "zeus" || request["actions"] != 2 || request["requests"] != 2 || request["succeeded"] != 2 || request["failed"] != 0 {
+		t.Fatalf("bulk fields = %v", request)
+	}
+	if len(logger.find(LevelError, "bulk failed")) != 0 {
+		t.Fatal("successful bulk logged an error")
+	}
+}
+
+func TestBulkLogsError(t *testing.T) {
+	logger := &recordingLogger{}
+	client := WrapClient(newFixtureClient(t, http.StatusBadRequest, []byte(`{"error":{"type":"illegal_argument_exception","reason":"bad bulk"},"status":400}`)), logger)
+	if _, err := performESInsert(client, "zeus", []interface{}{versionedDocument{ID: "1"}}); err == nil {
+		t.Fatal("bulk error not returned")
+	}
+	errs := logger.find(LevelError, "bulk failed")
+	if len(errs) != 1 || errs[0].fields["index"] != "zeus" || !strings.Contains(fmt.Sprint(errs[0].fields["error"]), "bad bulk") {
+		t.Fatalf("error logs = %+v", errs)
+	}
+	// 400 不重试
+	if len(logger.find(LevelWarn, "retry")) != 0 {
+		t.Fatal("non-retryable status was retried")
+	}
+}
+
+func TestRetryPolicyKeepsCustomOnRetry(t *testing.T) {
+	logger := &recordingLogger{}
+	client := WrapClient(nil, logger)
+	called := 0
+	policy := fastRetryPolicy
+	policy.OnRetry = func(int, time.Duration, error) { called++ }
+	client.retryPolicy(policy).OnRetry(1, time.Millisecond, nil)
+	if called != 1 || len(logger.entries) != 0 {
+		t.Fatalf("custom OnRetry called %d times, logs = %+v", called, logger.entries)
+	}
+}
+
+func TestScrollLogsTruncatedScrollID(t *testing.T) {
+	longID := "FGluY2x1ZGVfY29udGV4dF91dWlkDXF1ZXJ5QW5kRmV0Y2gBFjVlQVNVbVZkUU5pRm9qaWJ6WFJHQXcAAAAAAAAAAxZtY3JQS0FpY1RkeVR3eXlxVUVhR1Vn"
+	scrolls := 0
+	transport := roundTripFunc(func(req *http.Request) (int, string) {
+		switch {
+		case req.URL.Path == "/zeus/_search":
+			return http.StatusOK, fmt.Sprintf(`{"took":3,"_scroll_id":%q,"hits":{"total":{"value":4,"relation":"eq"},"hits":[{"_id":"1","_source":{}},{"_id":"2","_source":{}}]}}`, longID)
+		case req.URL.Path == "/_search/scroll":
+			scrolls++
+			if scrolls == 1 {
+				return http.StatusOK, fmt.Sprintf(`{"took":2,"_scroll_id":%q,"hits":{"total":{"value":4,"relation":"eq"},"hits":[{"_id":"3","_source":{}}]}}`, longID)
+			}
+			return http.StatusNotFound, `{"error":{"type":"search_context_missing_exception","reason":"No search context found"},"status":404}`
+		}
+		return http.StatusNotFound, `{"error":"unexpected request","status":404}`
+	})
+	logger := &recordingLogger{}
+	client := WrapClient(newTransportClient(t, transport), logger)
+
+	_, scrollID, err := PerformESQueryAndBuildScroll[Source](NewSearchBody().Size(2).Map(), "zeus", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := PerformESQueryWithScroll[Source](scrollID, client); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := PerformESQueryWithScroll[Source](scrollID, client); err == nil {
+		t.Fatal("expired scroll did not return an error")
+	}
+
+	prefix := longID[:16] + "..."
+	build := logger.find(LevelDebug, "build scroll")
+	if len(build) != 1 {
+		t.Fatalf("build scroll logs = %+v", build)
+	}
+	if f := build[0].fields; f["index"] != "zeus" || f["took"] != 3 || f["hits"] != 2 || f["total"] != int64(4) || f["scroll_id"] != prefix {
+		t.Fatalf("build scroll fields = %v", f)
+	}
+	cont := logger.find(LevelDebug, "continue scroll")
+	if len(cont) != 1 || cont[0].fields["hits"] != 1 || cont[0].fields["scroll_id"] != prefix {
+		t.Fatalf("continue scroll logs = %+v", cont)
+	}
+	failed := logger.find(LevelError, "continue scroll failed")
+	if len(failed) != 1 || failed[0].fields["scroll_id"] != prefix || failed[0].fields["error"] == nil {
+		t.Fatalf("continue scroll failed logs = %+v", failed)
+	}
+
+	// 完整的 scroll id 不会出现在任何日志中
+	for _, e := range logger.entries {
+		for k, v := range e.fields {
+			if strings.Contains(fmt.Sprint(v), longID) {
+				t.Fatalf("%s logged the full scroll id in %s", e.msg, k)
+			}
+		}
+	}
+}
+
+func TestScrollIDPrefix(t *testing.T) {
+	for id, want := range map[string]string{
+		"":                        "",
+		"short":                   "short",
+		"0123456789abcdef":        "0123456789abcdef",
+		"0123456789abcdefg":       "0123456789abcdef...",
+		strings.Repeat("x", 1000): strings.Repeat("x", 16) + "...",
+	} {
+		if got := scrollIDPrefix(id); got != want {
+			t.Fatalf("scrollIDPrefix(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStdLogger(log.New(&buf, "", 0), LevelInfo)
+	logger.Debug("hidden", "index", "zeus")
+	logger.Info("index created", "index", "zeus", "docs", 3)
+	logger.Error("odd", "index")
+
+	want := "level=INFO msg=\"index created\" index=zeus docs=3\nlevel=ERROR msg=\"odd\" !BADKEY=index\n"
+	if buf.String() != want {
+		t.Fatalf("output = %q, want %q", buf.String(), want)
+	}
+}
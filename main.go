@@ -3,15 +3,8 @@ package elasticsearch
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
-	"net"
-	"net/http"
-	"reflect"
-	"strings"
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v7"
@@ -19,26 +12,15 @@ import (
 	"github.com/pkg/errors"
 )
 
-// es查询返回结构体构造
-type ESDocument struct {
-	OuterHits struct {
-		Total struct {
-			Value int32 `json:"value"`
-		} `json:"total"`
-		InnerHits []struct {
-			Score  float32 `json:"_score"`
-			ID     string  `json:"_id"`
-			Source Source  `json:"_source"`
-		} `json:"hits"`
-	} `json:"hits"`
-}
+// es查询返回结构体构造，其他索引直接使用 SearchResult[T]
+type ESDocument = SearchResult[Source]
 
 // 真正存数据的地方
 type Source struct {
-	EntityID   string `json:"entity_id"`
+	EntityID   string `json:"entity_id" es:"id"`
 	EntityType int    `json:"entity_type"`
-	// 假设文档中存有对象数组
-	RelationEntities []Entity `json:"related_entities"`
+	// 假设文档中存有对象数组，映射为 nested 才能使用 nestedQuery
+	RelationEntities []Entity `json:"related_entities" es:"nested"`
 }
 
 type Entity struct {
@@ -48,790 +30,613 @@ type Entity struct {
 
 func main() {
 	client, _ := connectToElasticsearch()
-	query := sizeFromQuery()
-	response, _ := performESQuery(client, "indexName", query)
-	results := ESDocument{}
-	json.Unmarshal([]byte(response), &results)
-	for _, v := range results.OuterHits.InnerHits {
+	query, err := sizeFromQuery(20, 10)
+	if err != nil {
+		return
+	}
+	results, err := Search[Source](context.Background(), client.Client, "indexName", query)
+	if err != nil {
+		return
+	}
+	for _, v := range results.Hits.Hits {
 		fmt.Println(v.Source.EntityID)
 		fmt.Println(v.Source.EntityType)
 		fmt.Println(v.Source.RelationEntities)
 	}
 
 	// 滚动查询用法（一次过查询大数据量）
-	// es的size最多只能支持10000条
-	// esDocuments := []*ESDocument{}
-	esDocuments := make([]*ESDocument, 0)
-	var scrollID string
-	// 查询数据量：5 * 50000
-	for i := 0; i <= 5 && (i == 0 || scrollID != ""); i += 5000 {
-		from := int(i)
-		size := 5000
-		esPaginateResponse, tempScollID, err := scrollSearch(from, size, scrollID, "IndexName", client)
-		if err != nil {
-			return
-		}
-		scrollID = tempScollID
-		esDocuments = append(esDocuments, esPaginateResponse)
+	// es的size最多只能支持10000条，每页 5000 条直到查完
+	scrollQuery, err := sizeFromQuery(0, 5000)
+	if err != nil {
+		return
+	}
+	it := NewScrollIterator[Source](client.Client, "IndexName", scrollQuery, time.Minute)
+	defer it.Close()
+	esDocuments := make([]Hit[Source], 0)
+	for it.Next(context.Background()) {
+		esDocuments = append(esDocuments, it.Hits()...)
+	}
+	if err := it.Err(); err != nil {
+		return
 	}
 	fmt.Println("esDocuments: ", esDocuments)
 }
 
-// 创建 ESClient
-func connectToElasticsearch() (*elasticsearch.Client, error) {
-	// Save config as global variable
-	var cfg = elasticsearch.Config{
-		Addresses: []string{
-			"127.0.0.1",
-		},
-		Username: "root",
-		Password: "123456",
-		Transport: &http.Transport{
-			MaxIdleConnsPerHost:   10,
-			ResponseHeaderTimeout: time.Duration(30) * time.Second,
-			DialContext:           (&net.Dialer{Timeout: time.Second}).DialContext,
-			TLSClientConfig: &tls.Config{
-				MinVersion:         tls.VersionTLS11,
-				InsecureSkipVerify: true,
-			},
-		},
+// 创建 ESClient，配置来自 ES_CONFIG_FILE 指定的配置文件和 ES_* 环境变量，ES_PROFILE 选择环境
+func connectToElasticsearch() (*Client, error) {
+	cfg, err := LoadConfigFromEnv()
+	if err != nil {
+		return nil, err
 	}
-	return elasticsearch.NewClient((cfg))
+	esClient, err := cfg.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	return WrapClient(esClient, NewStdLogger(nil, LevelInfo)), nil
 }
 
-//  执行 ES query 查询，返回字符串
+// 执行 ES query 查询，返回字符串；需要解析时直接用 SearchInto 或者 Search，不需要再从字符串转换
 func performESQuery(ESClient *elasticsearch.Client, index string, query map[string]interface{}) (string, error) {
-	var buf bytes.Buffer
-
-	if err := json.NewEncoder(&buf).Encode(query); err != nil {
-		return "", errors.WithStack(err)
-	}
-	res, err := ESClient.Search(
-		ESClient.Search.WithContext(context.Background()),
-		ESClient.Search.WithIndex(index),
-		ESClient.Search.WithBody(&buf),
-		ESClient.Search.WithTrackTotalHits((true)),
-		ESClient.Search.WithPretty(),
-	)
+	res, err := doSearch(context.Background(), ESClient, index, query)
 	if err != nil {
-		return "", errors.WithStack(err)
-	}
-	defer res.Body.Close()
-
-	if res.IsError() {
-		var e map[string]interface{}
-		if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
-			return "", fmt.Errorf("Error parsing the response body: %s", err)
-		}
-		return "", fmt.Errorf("[%s] %s: %s",
-			res.Status(),
-			e["error"].(map[string]interface{})["type"],
-			e["error"].(map[string]interface{})["reason"])
-	}
-	// 将字节流转换成字符流
-	var sb strings.Builder
-	buffer := make([]byte, 256)
-	for {
-		n, err := res.Body.Read(buffer)
-		sb.Write(buffer[:n])
-		if err != nil {
-			if err != io.EOF {
-				log.Println("read error:", err)
-			}
-			break
-		}
+		return "", err
 	}
-	return sb.String(), nil
+	// 从复用的缓冲区直接转换成字符串，只复制一次
+	var body string
+	err = readResponse(res, func(data []byte) error {
+		body = string(data)
+		return nil
+	})
+	return body, err
 }
 
 // 分页 query
-func sizeFromQuery() map[string]interface{} {
-	query := map[string]interface{}{
-		"size": 10,
-		"from": 20,
-	}
-	return query
+func sizeFromQuery(from, size int) (map[string]interface{}, error) {
+	return NewSearchBody().From(from).Size(size).Build()
 }
 
 // 指定字段排序 query
-func sortQuery() map[string]interface{} {
-	query := map[string]interface{}{
-		"sort": []map[string]interface{}{
-			map[string]interface{}{
-				"publish_time": map[string]interface{}{
-					"order": "desc",
-				},
-			},
-		},
-	}
-	return query
-}
-
-// 指定范围 query
-func rangeQuery() map[string]interface{} {
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"range": map[string]interface{}{
-				"publish_time": []map[string]interface{}{
-					{
-						"gte": "2020-01-02 00:00:00",
-					},
-					{
-						"lte": "2020-01-03 00:00:00",
-					},
-				},
-			},
-		},
-	}
-	return query
+func sortQuery(field, order string) (map[string]interface{}, error) {
+	return NewSearchBody().Sort(field, order).Build()
+}
+
+// 指定范围 query，例如 rangeQuery("publish_time", "2020-01-02 00:00:00", "2020-01-03 00:00:00")
+func rangeQuery(field string, gte, lte interface{}) (map[string]interface{}, error) {
+	return NewSearchBody().Query(Range(field).Gte(gte).Lte(lte)).Build()
 }
 
 // and 条件连接 query
-func mustQuery() map[string]interface{} {
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": []map[string]interface{}{
-					{
-						"match": map[string]interface{}{
-							"entity_id": "123",
-						},
-					},
-					{
-						"match": map[string]interface{}{
-							"entity_type": "456",
-						},
-					},
-				},
-			},
-		},
-	}
-	return query
+func mustQuery(entityID string, entityType int) (map[string]interface{}, error) {
+	return NewSearchBody().Query(
+		Bool().Must(
+			Match("entity_id", entityID),
+			Match("entity_type", entityType),
+		),
+	).Build()
 }
 
 // or 条件连接 query
-func shouldQuery() map[string]interface{} {
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"should": []map[string]interface{}{
-					{
-						"term": map[string]interface{}{
-							"entity_id": "123",
-						},
-					},
-					{
-						"term": map[string]interface{}{
-							"entity_type": "456",
-						},
-					},
-				},
-			},
-		},
-	}
-	return query
+func shouldQuery(entityID string, entityType int) (map[string]interface{}, error) {
+	return NewSearchBody().Query(
+		Bool().Should(
+			Term("entity_id", entityID),
+			Term("entity_type", entityType),
+		),
+	).Build()
 }
 
 // 如果文档中存在对象，根据指定对象的字段查找 query
-func nestedQuery() map[string]interface{} {
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": map[string]interface{}{
-					"nested": map[string]interface{}{
-						"path": "related_entities",
-						"query": map[string]interface{}{
-							"bool": map[string]interface{}{
-								"must": []map[string]interface{}{
-									{
-										"match": map[string]interface{}{
-											"related_entities.entity_id": "123",
-										},
-									},
-									{
-										"match": map[string]interface{}{
-											"related_entities.entity_type": "456",
-										},
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-	return query
+func nestedQuery(entityID string, entityType int) (map[string]interface{}, error) {
+	return NewSearchBody().Query(
+		Bool().Must(
+			Nested("related_entities", Bool().Must(
+				Match("related_entities.entity_id", entityID),
+				Match("related_entities.entity_type", entityType),
+			)),
+		),
+	).Build()
 }
 
 // 保证至少满足n个should条件 query
-func minimumShouldMatchQuery() map[string]interface{} {
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"should": []map[string]interface{}{
-					{}, {},
-				},
-				"minimum_should_match": 1,
-			},
-		},
-	}
-	return query
+func minimumShouldMatchQuery(minimum int, should ...Query) (map[string]interface{}, error) {
+	return NewSearchBody().Query(
+		Bool().Should(should...).MinimumShouldMatch(minimum),
+	).Build()
 }
 
 // 一般用于类型为text的字段 会分词 分词后只要这个字符串命中一部分就会返回 query
-func matchQuery() map[string]interface{} {
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": []map[string]interface{}{
-					{
-						"match": map[string]interface{}{
-							"entity_id": "123",
-						},
-					},
-				},
-			},
-		},
-	}
-	return query
+func matchQuery(field string, value interface{}) (map[string]interface{}, error) {
+	return NewSearchBody().Query(
+		Bool().Must(Match(field, value)),
+	).Build()
 }
 
 // 会分词 分词后这个字符串必须命中所有的词才会返回 query
-func matchPhraseQuery() map[string]interface{} {
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"should": []map[string]interface{}{
-					{
-						"match_phrase": map[string]interface{}{
-							"entity_id": map[string]interface{}{
-								"query": "123",
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-	return query
+func matchPhraseQuery(field string, value interface{}) (map[string]interface{}, error) {
+	return NewSearchBody().Query(
+		Bool().Should(MatchPhrase(field, value)),
+	).Build()
+}
+
+// 搜索框使用的全文检索，在 ik.* 字段中查找并返回高亮片段，结果在 hit.Highlights 中
+func highlightMatchQuery(field string, value interface{}) (map[string]interface{}, error) {
+	return NewSearchBody().
+		Query(Match(field, value)).
+		Highlight(NewHighlight().
+			Fields(field).
+			PreTags("<em>").
+			PostTags("</em>").
+			FragmentSize(100).
+			NumberOfFragments(3)).
+		Build()
 }
 
 // https://my.oschina.net/u/3777515/blog/4700962
 // 调节各个查询条件的文档的得分 要与function_score连用 query
-func boostQuery() map[string]interface{} {
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"should": []map[string]interface{}{
-					{
-						"match_phrase": map[string]interface{}{
-							"entity_id": map[string]interface{}{
-								"query": "123",
-								"boost": "3",
-							},
-						},
-					},
-					{
-						"match_phrase": map[string]interface{}{
-							"entity_type": map[string]interface{}{
-								"query": "123",
-								"boost": "1",
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-	return query
+func boostQuery(value interface{}, entityIDBoost, entityTypeBoost float64) (map[string]interface{}, error) {
+	return NewSearchBody().Query(
+		Bool().Should(
+			MatchPhrase("entity_id", value).Boost(entityIDBoost),
+			MatchPhrase("entity_type", value).Boost(entityTypeBoost),
+		),
+	).Build()
 }
 
 // 计算特定条件下的文档的function_score
-func scriptScoreQuery() map[string]interface{} {
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"function_score": map[string]interface{}{
-				"query": map[string]interface{}{
-					"bool": map[string]interface{}{
-						"must": []map[string]interface{}{},
-					},
-				},
-				"script_score": map[string]interface{}{
-					"script": map[string]interface{}{
-						"source": "doc[rank_score].value*0.01", //rank_score是文档的一个自定义的字段，想用什么字段来调分数都行
-					},
-				},
-				"boost_mode": "replace", //sum
-			},
-		},
-	}
-	return query
+// field 是文档的一个自定义的字段，想用什么字段来调分数都行，没有该字段的文档得分为 0
+func scriptScoreQuery(query Query, field string, factor float64) (map[string]interface{}, error) {
+	return NewSearchBody().Query(
+		FunctionScore(query).
+			ScriptScore("doc[params.field].size() == 0 ? 0 : doc[params.field].value * params.factor", map[string]interface{}{
+				"field":  field,
+				"factor": factor,
+			}).
+			BoostMode("replace"), //sum
+	).Build()
 }
 
-// 第一次滚动查询时需要要调用，返回scollID，供下一次滚动查询调用
-func PerformESQueryAndBuildScroll(query map[string]interface{}, index string, esClient *elasticsearch.Client) ([]map[string]interface{}, string, error) {
+// 聚合查询，按 entity_type 统计文档数，以及关联实体的类型分布；
+// 结果用 result.Aggregations.Get("related_entities").Get("entity_types").Buckets() 读取
+func entityTypeAggQuery(size int) (map[string]interface{}, error) {
+	return NewSearchBody().
+		Size(0).
+		Aggregation("entity_types", TermsAgg("entity_type").Size(size)).
+		Aggregation("related_entities", NestedAgg("related_entities").
+			SubAggregation("entity_types", TermsAgg("related_entities.entity_type").Size(size))).
+		Build()
+}
 
+// 第一次滚动查询时需要要调用，返回scollID，供下一次滚动查询调用
+func PerformESQueryAndBuildScroll[T any](query map[string]interface{}, index string, esClient *Client) (*SearchResult[T], string, error) {
 	startTime := time.Now()
-
-	resultList := make([]map[string]interface{}, 0)
-	var err error
-
-	var reqBody bytes.Buffer
-	err = json.NewEncoder(&reqBody).Encode(query)
-	if err != nil {
-		err = fmt.Errorf("encode query failed, %v", err)
-		return resultList, "", errors.WithStack(err)
-	}
-	res, err := esClient.Search(
-		esClient.Search.WithContext(context.Background()),
-		esClient.Search.WithIndex(string(index)),
-		esClient.Search.WithBody(&reqBody),
-		esClient.Search.WithTrackTotalHits(true),
-		esClient.Search.WithPretty(),
-		esClient.Search.WithTimeout(5*60*time.Second),
-		esClient.Search.WithScroll(time.Minute),
-	)
+	result, err := startScroll[T](context.Background(), esClient.Client, index, query, defaultScrollKeepAlive)
 	if err != nil {
-		err = fmt.Errorf("Error getting response: %s", err)
-		return resultList, "", errors.WithStack(err)
+		esClient.Logger().Error("build scroll failed", "index", index, "error", err)
+		return nil, "", err
 	}
-	defer res.Body.Close()
 
-	if res.IsError() {
-		var e map[string]interface{}
-		if err = json.NewDecoder(res.Body).Decode(&e); err != nil {
-			err = fmt.Errorf("Error parsing the response body: %s", err)
-		} else {
-			err = fmt.Errorf("[%s] %s: %s", res.Status(),
-				e["error"].(map[string]interface{})["type"],
-				e["error"].(map[string]interface{})["reason"])
-		}
-		return resultList, "", errors.WithStack(err)
-	}
-
-	result := make(map[string]interface{})
-	if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
-		err = fmt.Errorf("Error parsing the response body: %s", err)
-		return resultList, "", errors.WithStack(err)
-	}
-	resultList = append(resultList, result)
-
-	hits := result["hits"].(map[string]interface{})["hits"].([]interface{})
+	hits := result.Hits.Hits
 
+	// 返回条数不足一页说明已经是最后一页，不再需要 scrollID
 	scrollID := ""
-	if len(hits) == query["size"].(int) {
-		scrollID = result["_scroll_id"].(string)
-	}
-
-	// test code
-	if len(hits) > 0 {
-		log.Println("")
-		log.Println("---------------- First level of PerformESQueryAndBuildScroll ---------------")
-		length := len(hits)
-		if length > 1 {
-			length = 1
-		}
-		resultJSON, _ := json.Marshal(hits[0:length])
-		log.Printf("adam Build scroll, result[%+v]", string(resultJSON))
-		log.Printf("adam Build scroll, len(hits): [%+v], query time[%+v]", len(hits), time.Now().Sub(startTime))
-	}
+	size, ok := query["size"].(int)
+	if len(hits) > 0 && (!ok || len(hits) == size) {
+		scrollID = result.ScrollID
+	}
+
+	esClient.Logger().Debug("build scroll",
+		"index", index,
+		"took", result.Took,
+		"hits", len(hits),
+		"total", result.Hits.Total.Value,
+		"elapsed", time.Since(startTime),
+		"scroll_id", scrollIDPrefix(scrollID),
+	)
 
-	return resultList, scrollID, err
+	return result, scrollID, nil
 }
 
 // 调用第一次滚动查询方法，将返回结果封装好
-func GetESDataAndBuildScroll(query map[string]interface{}, index string, esClient *elasticsearch.Client) (*ESDocument, string, error) {
-	resultList, scrollID, err := PerformESQueryAndBuildScroll(query, index, esClient)
+func GetESDataAndBuildScroll[T any](query map[string]interface{}, index string, esClient *Client) (*SearchResult[T], string, error) {
+	response, scrollID, err := PerformESQueryAndBuildScroll[T](query, index, esClient)
 	if err != nil {
 		return nil, "", errors.WithStack(err)
 	}
-
-	response := ESDocument{}
-	for _, v := range resultList {
-		res := new(ESDocument)
-		jsonData, err := json.Marshal(v)
-		if err != nil {
-			return nil, "", errors.WithStack(err)
-		}
-		err = json.Unmarshal(jsonData, &res)
-		if err != nil {
-			return nil, "", errors.WithStack(err)
-		}
-
-		response.OuterHits.Total.Value = res.OuterHits.Total.Value
-		response.OuterHits.InnerHits = append(response.OuterHits.InnerHits, res.OuterHits.InnerHits...)
-	}
-
-	return &response, scrollID, nil
+	return response, scrollID, nil
 }
 
 // 第二次及以上调用滚动查询，根据scrollID查询
-func PerformESQueryWithScroll(scrollID string, esClient *elasticsearch.Client) ([]map[string]interface{}, string, error) {
+func PerformESQueryWithScroll[T any](scrollID string, esClient *Client) (*SearchResult[T], string, error) {
 	if scrollID == "" {
-		return nil, "", fmt.Errorf("=========================*************scrollID can not be empty in adam.PerformESQueryWithScroll")
+		return nil, "", fmt.Errorf("scrollID can not be empty in PerformESQueryWithScroll")
 	}
 
-	resultList := make([]map[string]interface{}, 0)
 	startTime := time.Now()
-
-	res, err := esClient.Scroll(
-		esClient.Scroll.WithContext(context.Background()),
-		esClient.Scroll.WithPretty(),
-		esClient.Scroll.WithScrollID(scrollID),
-		esClient.Scroll.WithScroll(time.Minute),
-	)
+	result, err := continueScroll[T](context.Background(), esClient.Client, scrollID, defaultScrollKeepAlive)
 	if err != nil {
-		err = fmt.Errorf("Error getting response: %s", err)
-		return resultList, "", errors.WithStack(err)
-	}
-	defer res.Body.Close()
-
-	if res.IsError() {
-		var e map[string]interface{}
-		if err = json.NewDecoder(res.Body).Decode(&e); err != nil {
-			err = fmt.Errorf("Error parsing the response body: %s", err)
-		} else {
-			err = fmt.Errorf("[%s] %s: %s", res.Status(),
-				e["error"].(map[string]interface{})["type"],
-				e["error"].(map[string]interface{})["reason"])
-		}
-		return resultList, "", errors.WithStack(err)
-	}
-
-	result := make(map[string]interface{})
-	if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
-		err = fmt.Errorf("Error parsing the response body: %s", err)
-		return resultList, "", errors.WithStack(err)
+		esClient.Logger().Error("continue scroll failed", "scroll_id", scrollIDPrefix(scrollID), "error", err)
+		return nil, "", err
 	}
 
-	resultList = append(resultList, result)
-
 	scrollID = ""
-	hits := result["hits"].(map[string]interface{})["hits"].([]interface{})
+	hits := result.Hits.Hits
 	if len(hits) > 0 {
-		scrollID = result["_scroll_id"].(string)
+		scrollID = result.ScrollID
 	}
 
-	// test code
-	if len(hits) > 0 {
-		log.Println("---------------- Second level of PerformESQueryWithScroll ---------------")
-		resultJSON, _ := json.Marshal(hits[0])
-		log.Printf("adam PerformESQueryWithScroll， len(resultList)[%d], len(hits)[%d], query time: [%+v]",
-			len(resultList), len(hits), time.Now().Sub(startTime))
-		log.Printf("adam PerformESQueryWithScroll， hits[0]: [%+v]", string(resultJSON))
-	}
+	esClient.Logger().Debug("continue scroll",
+		"took", result.Took,
+		"hits", len(hits),
+		"elapsed", time.Since(startTime),
+		"scroll_id", scrollIDPrefix(scrollID),
+	)
 
-	return resultList, scrollID, nil
+	return result, scrollID, nil
 }
 
 // 调用第二次及以上的滚动查询方法，将返回结果封装好
-func GetESDataWithScroll(scrollID string, esClient *elasticsearch.Client) (*ESDocument, string, error) {
-	resultList, scrollID, err := PerformESQueryWithScroll(scrollID, esClient)
+func GetESDataWithScroll[T any](scrollID string, esClient *Client) (*SearchResult[T], string, error) {
+	response, scrollID, err := PerformESQueryWithScroll[T](scrollID, esClient)
 	if err != nil {
 		return nil, "", errors.WithStack(err)
 	}
-
-	response := ESDocument{}
-	for _, v := range resultList {
-		res := new(ESDocument)
-		jsonData, err := json.Marshal(v)
-		if err != nil {
-			return nil, "", errors.WithStack(err)
-		}
-		err = json.Unmarshal(jsonData, &res)
-		if err != nil {
-			return nil, "", errors.WithStack(err)
-		}
-
-		response.OuterHits.Total.Value = res.OuterHits.Total.Value
-		response.OuterHits.InnerHits = append(response.OuterHits.InnerHits, res.OuterHits.InnerHits...)
-	}
-
-	return &response, scrollID, nil
+	return response, scrollID, nil
 }
 
-func scrollSearch(from, size int, scrollID string, esIndex string, client *elasticsearch.Client) (*ESDocument, string, error) {
-	queryResponse := new(ESDocument)
-	indexName := esIndex
-
-	query := map[string]interface{}{
-		"size": size,
-		// 其他查询条件...
-	}
-	// 第一页查询，保证最后一页之后 scrollID 为空时不再执行查询
-	if from == 0 {
-		queryResponse, scrollIDResult, err := GetESDataAndBuildScroll(query, indexName, client)
-		if err != nil {
-			return nil, "", err
-		}
+// ================================ es 的删除更新插入 ================================
 
-		return queryResponse, scrollIDResult, nil
-	}
-	if scrollID != "" {
-		queryResponse, scrollIDResult, err := GetESDataWithScroll(scrollID, client)
-		if err != nil {
-			return nil, scrollIDResult, err
-		}
+// 批量插入数据，边编码边发送，内存中最多只有一批编码好的数据，见 performESDocuments
+func performESInsert(client *Client, index string, documents []interface{}, opts ...BulkOption) (*BulkResult, error) {
+	return performESDocuments(client, index, documents, newBulkOptions(opts), getInsertRequestItem)
+}
 
-		return queryResponse, scrollIDResult, nil
+func getInsertRequestItem(index string, document interface{}) (*bulkItem, error) {
+	docItem, err := NewDocumentItem("create", document)
+	if err != nil {
+		return nil, err
 	}
-
-	return queryResponse, "", nil
+	return newBulkItem(docItem, index)
 }
 
-// ================================ es 的删除更新插入 ================================
+// 批量更新插入数据，有就更新，没有就插入
+func performESUpsert(client *Client, index string, documents []interface{}, opts ...BulkOption) (*BulkResult, error) {
+	return performESDocuments(client, index, documents, newBulkOptions(opts), getUpsertRequestItem)
+}
 
-// 批量插入数据
-func performESInsert(client elasticsearch.Client, index string, documents []interface{}) error {
-	if len(documents) == 0 {
-		return nil
-	}
-	requestBody, err := getInsertRequestBody(index, documents)
+func getUpsertRequestItem(index string, document interface{}) (*bulkItem, error) {
+	docItem, err := NewDocumentItem("update", document)
 	if err != nil {
-		log.Fatalf("Error getting request body: %s", err)
-		return err
+		return nil, err
 	}
-	return performESBulk(client, index, requestBody)
+	// 失败重试 3 次
+	docItem.RetryOnConflict = 3
+	return newBulkItem(docItem, index)
 }
 
-func getInsertRequestBody(index string, documents []interface{}) (string, error) {
-	var bodyBuf bytes.Buffer
-	for _, document := range documents {
-		documentValue := reflect.ValueOf(document).Elem()
-		createHeader :=
-			map[string]interface{}{
-				"create": map[string]interface{}{
-					"_index": index,
-					"_id":    documentValue.FieldByName("ID").String(),
-					"_type":  "_doc",
-				},
-			}
-		header, err := json.Marshal(createHeader)
-		if err != nil {
-			return "", err
-		}
-		bodyBuf.Write(header)
-		bodyBuf.WriteByte('\n')
-		content, err := json.Marshal(document)
+// 批量用脚本更新数据，文档已存在时执行 script，没有就插入 documents 中的内容
+func performESScriptedUpsert(client *Client, index string, documents []interface{}, script *Script, opts ...BulkOption) (*BulkResult, error) {
+	return performESDocuments(client, index, documents, newBulkOptions(opts), func(index string, document interface{}) (*bulkItem, error) {
+		docItem, err := NewScriptedUpdateItem(document, script)
 		if err != nil {
-			// TODO: LOG
-			return "", err
+			return nil, err
 		}
-		bodyBuf.Write(content)
-		bodyBuf.WriteByte('\n')
-	}
-	return bodyBuf.String(), nil
+		// 失败重试 3 次
+		docItem.RetryOnConflict = 3
+		return newBulkItem(docItem, index)
+	})
 }
 
-// 批量更新插入数据，有就更新，没有就插入
-func performESUpsert(client elasticsearch.Client, index string, documents []interface{}) error {
-	requestBody, err := getUpsertRequestBody(index, documents)
-	if err != nil {
-		log.Fatalf("Error getting request body: %s", err)
+// 逐条编码文档，每攒够 defaultFlushActions 条或者 defaultFlushBytes 字节（和 BulkIndexer 的默认值相同）就发送一批，
+// 发送完再编码下一批，不会一次把所有文档都编码到内存中。
+// 某条文档编码失败或者某一批整个请求失败时停止，之前发送成功的批次不会回滚，返回已有的结果和错误
+func performESDocuments(client *Client, index string, documents []interface{}, options *bulkOptions, encode func(index string, document interface{}) (*bulkItem, error)) (*BulkResult, error) {
+	result := &BulkResult{}
+	var items []*bulkItem
+	size := 0
+	send := func() error {
+		if len(items) == 0 {
+			return nil
+		}
+		chunkResult, err := performESBulk(client, index, items, options)
+		result.merge(chunkResult)
+		// 不复用切片，让已经发送的文档可以被回收
+		items = nil
+		size = 0
 		return err
 	}
-	return performESBulk(client, index, requestBody)
-}
 
-func getUpsertRequestBody(index string, documents []interface{}) (string, error) {
-	var bodyBuf bytes.Buffer
 	for _, document := range documents {
-		documentValue := reflect.ValueOf(document).Elem()
-		upsertHeader :=
-			map[string]interface{}{
-				"update": map[string]interface{}{
-					"_index": index,
-					"_id":    documentValue.FieldByName("ID").String(),
-					"_type":  "_doc",
-					// 失败重试 3 次
-					"retry_on_conflict": 3,
-				},
-			}
-		header, err := json.Marshal(upsertHeader)
+		item, err := encode(index, document)
 		if err != nil {
-			// TODO: LOG
-			return "", err
+			return result, err
 		}
-		bodyBuf.Write(header)
-		bodyBuf.WriteByte('\n')
-
-		upsertBody :=
-			map[string]interface{}{
-				"doc":           document,
-				"doc_as_upsert": true,
+		if len(items) > 0 && size+item.size() > defaultFlushBytes {
+			if err := send(); err != nil {
+				return result, err
+			}
+		}
+		items = append(items, item)
+		size += item.size()
+		if len(items) >= defaultFlushActions {
+			if err := send(); err != nil {
+				return result, err
 			}
-		content, err := json.Marshal(upsertBody)
-		if err != nil {
-			// TODO: LOG
-			return "", err
 		}
-		bodyBuf.Write(content)
-		bodyBuf.WriteByte('\n')
 	}
-	return bodyBuf.String(), nil
+	return result, send()
 }
 
-// 删除整个索引
-func deleteESIndex(client elasticsearch.Client, index string) error {
-	indexes := []string{index}
-	req := esapi.IndicesDeleteRequest{
-		Index: indexes,
-	}
-	// Perform the request with the client.
-	res, err := req.Do(context.Background(), &client)
+// 删除整个索引，不允许使用通配符和 _all，索引不存在时返回的错误满足 IsNotFound
+func deleteESIndex(client *Client, index string) error {
+	result, err := DeleteIndex(context.Background(), client.Client, index, DeleteIndexOptions{})
 	if err != nil {
-		log.Fatalf("delete ES all documents, error getting response: %s", err)
 		return err
 	}
-	defer res.Body.Close()
-	if res.IsError() {
-		log.Printf("delete ES all documents, [%s] error indexing document", res.Status())
-		return err
+	for _, info := range result.Indices {
+		client.Logger().Info("index deleted", "index", info.Index, "docs_count", info.DocsCount)
 	}
 	return nil
 }
 
 // 批量删除索引数据
-func performESDelete(client elasticsearch.Client, index string, ids []string) error {
+func performESDelete(client *Client, index string, ids []string, opts ...BulkOption) (*BulkResult, error) {
+	options := newBulkOptions(opts)
+	result := &BulkResult{}
 	for i := 0; i < len(ids); i += 20000 {
 		endIndex := i + 20000
 		if endIndex > len(ids) {
 			endIndex = len(ids)
 		}
-		var bodyBuf bytes.Buffer
+		items := make([]*bulkItem, 0, endIndex-i)
 		for _, id := range ids[i:endIndex] {
-			deleteHeader :=
-				map[string]interface{}{
-					"delete": map[string]interface{}{
-						"_index": index,
-						"_id":    id,
-					},
-				}
-			header, err := json.Marshal(deleteHeader)
+			item, err := newBulkItem(BulkIndexerItem{Action: "delete", Index: index, DocumentID: id}, index)
 			if err != nil {
-				return err
+				return result, err
 			}
-			bodyBuf.Write(header)
-			bodyBuf.WriteByte('\n')
+			items = append(items, item)
 		}
-		err := performESBulk(client, index, bodyBuf.String())
+		chunkResult, err := performESBulk(client, index, items, options)
+		result.merge(chunkResult)
 		if err != nil {
-			return err
+			return result, err
 		}
 	}
-	return nil
+	return result, nil
 }
 
-// 创建索引
-func createZeusESIndex(client elasticsearch.Client) {
-	body := map[string]interface{}{
-		"aliases": map[string]interface{}{},
-		"mappings": map[string]interface{}{
-			"dynamic_templates": []interface{}{
-				map[string]interface{}{
-					"ik_fields": map[string]interface{}{
-						"path_match":         "ik.*",
-						"match_mapping_type": "string",
-						"mapping": map[string]interface{}{
-							"analyzer":        "ik_max_word",
-							"search_analyzer": "ik_smart",
-							"type":            "text",
-						},
-					},
-				},
-				map[string]interface{}{
-					"whitespace_fields": map[string]interface{}{
-						"path_match":         "ws.*",
-						"match_mapping_type": "string",
-						"mapping": map[string]interface{}{
-							"analyzer": "whitespace",
-							"type":     "text",
-						},
-					},
+// 删除所有匹配 query 的数据，不需要先查出 id；版本冲突的文档跳过，数量记录在 Status.VersionConflicts 中
+func performESDeleteByQuery(ctx context.Context, client *Client, index string, query Query) (*TaskInfo, error) {
+	task, err := DeleteByQuery(ctx, client.Client, ByQueryConfig{
+		Index:              index,
+		Query:              query,
+		ProceedOnConflicts: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return waitByQueryTask(ctx, client, index, task)
+}
+
+// 用脚本更新所有匹配 query 的数据
+func performESUpdateByQuery(ctx context.Context, client *Client, index string, query Query, script *Script) (*TaskInfo, error) {
+	task, err := UpdateByQuery(ctx, client.Client, ByQueryConfig{
+		Index:              index,
+		Query:              query,
+		Script:             script,
+		ProceedOnConflicts: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return waitByQueryTask(ctx, client, index, task)
+}
+
+// 等待 update_by_query、delete_by_query 任务结束。只有 ctx 结束（调用方不再需要结果）时才取消任务，
+// 查询进度失败时任务继续在集群上运行，可以用日志中的任务 id 继续查询
+func waitByQueryTask(ctx context.Context, client *Client, index string, task *TaskHandle) (*TaskInfo, error) {
+	info, err := task.Wait(ctx, 0, func(status TaskStatus) {
+		client.Logger().Debug("by query progress", "action", task.Action, "task", task.ID,
+			"total", status.Total, "updated", status.Updated, "deleted", status.Deleted)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			if cancelErr := task.Cancel(context.Background()); cancelErr != nil {
+				client.Logger().Warn("cancel task failed", "task", task.ID, "error", cancelErr)
+			}
+		} else {
+			client.Logger().Warn("poll task failed, task keeps running", "action", task.Action, "task", task.ID, "error", err)
+		}
+		return info, err
+	}
+	client.Logger().Info("by query finished", "action", task.Action, "index", index, "total", info.Status.Total,
+		"updated", info.Status.Updated, "deleted", info.Status.Deleted, "version_conflicts", info.Status.VersionConflicts)
+	return info, info.Err()
+}
+
+// 字段命名约定对应的动态模板：ik.* 中文分词、ws.* 空格分词、sd.* 标准分词、kw.* 不分词、ni.* 不索引
+func zeusDynamicTemplates() []interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"ik_fields": map[string]interface{}{
+				"path_match":         "ik.*",
+				"match_mapping_type": "string",
+				"mapping": map[string]interface{}{
+					"analyzer":        "ik_max_word",
+					"search_analyzer": "ik_smart",
+					"type":            "text",
 				},
-				map[string]interface{}{
-					"standard_fields": map[string]interface{}{
-						"path_match":         "sd.*",
-						"match_mapping_type": "string",
-						"mapping": map[string]interface{}{
-							"analyzer": "standard",
-							"type":     "text",
-						},
-					},
+			},
+		},
+		map[string]interface{}{
+			"whitespace_fields": map[string]interface{}{
+				"path_match":         "ws.*",
+				"match_mapping_type": "string",
+				"mapping": map[string]interface{}{
+					"analyzer": "whitespace",
+					"type":     "text",
 				},
-				map[string]interface{}{
-					"keyword_fields": map[string]interface{}{
-						"path_match":         "kw.*",
-						"match_mapping_type": "string",
-						"mapping": map[string]interface{}{
-							"analyzer": "standard",
-							"type":     "keyword",
-						},
-					},
+			},
+		},
+		map[string]interface{}{
+			"standard_fields": map[string]interface{}{
+				"path_match":         "sd.*",
+				"match_mapping_type": "string",
+				"mapping": map[string]interface{}{
+					"analyzer": "standard",
+					"type":     "text",
 				},
-				map[string]interface{}{
-					"not_indexed_fields": map[string]interface{}{
-						"path_match":         "ni.*",
-						"match_mapping_type": "string",
-						"mapping": map[string]interface{}{
-							"enabled": false,
-							"type":    "object",
-						},
-					},
+			},
+		},
+		map[string]interface{}{
+			"keyword_fields": map[string]interface{}{
+				"path_match":         "kw.*",
+				"match_mapping_type": "string",
+				"mapping": map[string]interface{}{
+					"analyzer": "standard",
+					"type":     "keyword",
 				},
 			},
-			// 因为signals是对象，所以套多了一层properties
-			"properties": map[string]interface{}{
-				"signals": map[string]interface{}{
-					"properties": map[string]interface{}{
-						"score": map[string]interface{}{
-							"type": "float",
-						},
-						"signal_id": map[string]interface{}{
-							"type": "keyword",
-						},
-					},
+		},
+		map[string]interface{}{
+			"not_indexed_fields": map[string]interface{}{
+				"path_match":         "ni.*",
+				"match_mapping_type": "string",
+				"mapping": map[string]interface{}{
+					"enabled": false,
+					"type":    "object",
 				},
 			},
 		},
 	}
+}
+
+// 字段命名约定的组件模板名称
+const zeusFieldConventionsTemplate = "zeus-field-conventions"
+
+// 把字段命名约定登记为组件模板，再登记一个匹配 indexPatterns 的索引模板，
+// 调用 Apply 之后新建的索引会自动使用这些约定，例如 zeusTemplateRegistry("zeus-*").Apply(ctx, client)
+func zeusTemplateRegistry(indexPatterns ...string) *TemplateRegistry {
+	return NewTemplateRegistry().
+		RegisterComponentTemplate(ComponentTemplate{
+			Name:    zeusFieldConventionsTemplate,
+			Version: 1,
+			Template: TemplateBody{
+				Mappings: map[string]interface{}{
+					"dynamic_templates": zeusDynamicTemplates(),
+				},
+			},
+		}).
+		RegisterIndexTemplate(IndexTemplate{
+			Name:          "zeus",
+			IndexPatterns: indexPatterns,
+			ComposedOf:    []string{zeusFieldConventionsTemplate},
+			Priority:      100,
+			Version:       1,
+		})
+}
+
+// 信号字段，signals 是对象
+type Signal struct {
+	Score    float32 `json:"score"`
+	SignalID string  `json:"signal_id"`
+}
+
+// 索引的 mappings，字段 mapping 由 Source 和 Signal 结构体生成，再和动态模板合并
+func zeusIndexBody() (map[string]interface{}, error) {
+	sourceMapping, err := MappingFromStruct(Source{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	signalMapping, err := MappingFromStruct(Signal{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return map[string]interface{}{
+		"mappings": MergeMappings(
+			map[string]interface{}{
+				"dynamic_templates": zeusDynamicTemplates(),
+			},
+			sourceMapping,
+			map[string]interface{}{
+				// 因为signals是对象，所以套多了一层properties
+				"properties": map[string]interface{}{
+					"signals": signalMapping,
+				},
+			},
+		),
+	}, nil
+}
+
+// 创建索引，真正的索引名带版本号，业务代码只通过别名 indexName 读写，
+// 之后修改 mapping 时可以用 reindexZeusESIndex 重建索引并切换别名
+func createZeusESIndex(client *Client) error {
+	const alias = "indexName"
+	index := alias + "_v1"
+	body, err := zeusIndexBody()
+	if err != nil {
+		return err
+	}
+	body["aliases"] = map[string]interface{}{
+		alias: map[string]interface{}{"is_write_index": true},
+	}
 	jsonBody, _ := json.Marshal(body)
-	fmt.Println(string(jsonBody))
+	client.Logger().Debug("create index", "index", index, "alias", alias, "body", string(jsonBody))
 	req := esapi.IndicesCreateRequest{
-		Index: "indexName",
+		Index: index,
 		Body:  bytes.NewReader(jsonBody),
 	}
-	res, err := req.Do(context.Background(), &client)
+	res, err := req.Do(context.Background(), client)
 	if err != nil {
-		return
+		return errors.WithStack(err)
 	}
 	defer res.Body.Close()
-	fmt.Println(res.String())
+	if res.IsError() {
+		return errors.WithStack(newESError(res))
+	}
+	client.Logger().Info("index created", "index", index, "alias", alias)
+	return nil
 }
 
-// 批量操作数据公用方法
-func performESBulk(client elasticsearch.Client, index string, requestBody string) error {
-	// Set up the request object.
-	req := esapi.BulkRequest{
-		Index:   index,
-		Body:    strings.NewReader(requestBody),
-		Refresh: "false",
-		Pretty:  false,
+// 修改 mapping 后用新的 mapping 重建 alias 指向的索引，迁移完成后切换别名，不需要删除索引
+func reindexZeusESIndex(ctx context.Context, client *elasticsearch.Client, alias string) (*ReindexResult, error) {
+	body, err := zeusIndexBody()
+	if err != nil {
+		return nil, err
 	}
+	return ReindexWithAlias(ctx, client, ReindexConfig{
+		Alias:     alias,
+		IndexBody: body,
+	})
+}
 
-	// Perform the request with the client.
-	res, err := req.Do(context.Background(), &client)
+// 批量操作数据公用方法，逐条解析返回结果，失败的操作记录在 BulkResult.Failed 中，
+// 返回可重试状态码（例如 429）的操作会按重试策略重新发送
+func performESBulk(client *Client, index string, items []*bulkItem, options *bulkOptions) (*BulkResult, error) {
+	result := &BulkResult{}
+	startTime := time.Now()
+	policy := client.retryPolicy(options.retryPolicy, "action", "bulk", "index", index)
+	requests, err := sendBulk(context.Background(), client, index, "false", options.compress, items, policy,
+		func(_ *bulkItem, item BulkResponseItem, err error) {
+			result.add(item)
+			if err != nil {
+				if options.onFailure != nil {
+					options.onFailure(item, err)
+				}
+			} else if options.onSuccess != nil {
+				options.onSuccess(item)
+			}
+		})
+	result.NumRequests = requests
+	client.Logger().Debug("bulk",
+		"index", index,
+		"actions", len(items),
+		"requests", result.NumRequests,
+		"succeeded", result.NumSucceeded,
+		"failed", result.NumFailed,
+		"elapsed", time.Since(startTime),
+	)
 	if err != nil {
-		return err
+		client.Logger().Error("bulk failed", "index", index, "actions", len(items), "error", err)
 	}
-	defer res.Body.Close()
-	if res.IsError() {
-		return err
-	}
-	// Deserialize the response into a map.
-	var r map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-	}
-	return nil
+	return result, err
 }
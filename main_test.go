@@ -0,0 +1,192 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestQueryHelpersGoldenJSON(t *testing.T) {
+	body, err := sizeFromQuery(20, 10)
+	assertGoldenJSON(t, "sizeFromQuery", body, err, `{"from": 20, "size": 10}`)
+
+	body, err = sortQuery("publish_time", "desc")
+	assertGoldenJSON(t, "sortQuery", body, err, `{"sort": [{"publish_time": {"order": "desc"}}]}`)
+
+	body, err = rangeQuery("publish_time", "2020-01-02 00:00:00", "2020-01-03 00:00:00")
+	assertGoldenJSON(t, "rangeQuery", body, err, `{"query": {"range": {"publish_time": {
+		"gte": "2020-01-02 00:00:00", "lte": "2020-01-03 00:00:00"}}}}`)
+
+	body, err = mustQuery("123", 456)
+	assertGoldenJSON(t, "mustQuery", body, err, `{"query": {"bool": {"must": [
+		{"match": {"entity_id": "123"}},
+		{"match": {"entity_type": 456}}]}}}`)
+
+	body, err = shouldQuery("123", 456)
+	assertGoldenJSON(t, "shouldQuery", body, err, `{"query": {"bool": {"should": [
+		{"term": {"entity_id": "123"}},
+		{"term": {"entity_type": 456}}]}}}`)
+
+	body, err = nestedQuery("123", 456)
+	assertGoldenJSON(t, "nestedQuery", body, err, `{"query": {"bool": {"must": [{"nested": {
+		"path": "related_entities",
+		"query": {"bool": {"must": [
+			{"match": {"related_entities.entity_id": "123"}},
+			{"match": {"related_entities.entity_type": 456}}]}}}}]}}}`)
+
+	body, err = minimumShouldMatchQuery(1, Term("entity_id", "123"), Term("entity_type", 456))
+	assertGoldenJSON(t, "minimumShouldMatchQuery", body, err, `{"query": {"bool": {
+		"should": [{"term": {"entity_id": "123"}}, {"term": {"entity_type": 456}}],
+		"minimum_should_match": 1}}}`)
+
+	body, err = matchQuery("entity_id", "123")
+	assertGoldenJSON(t, "matchQuery", body, err, `{"query": {"bool": {"must": [{"match": {"entity_id": "123"}}]}}}`)
+
+	body, err = matchPhraseQuery("entity_id", "123")
+	assertGoldenJSON(t, "matchPhraseQuery", body, err, `{"query": {"bool": {"should": [
+		{"match_phrase": {"entity_id": {"query": "123"}}}]}}}`)
+
+	body, err = highlightMatchQuery("ik.title", "关键词")
+	assertGoldenJSON(t, "highlightMatchQuery", body, err, `{
+		"query": {"match": {"ik.title": "关键词"}},
+		"highlight": {"fields": {"ik.title": {}}, "pre_tags": ["<em>"], "post_tags": ["</em>"],
+			"fragment_size": 100, "number_of_fragments": 3}}`)
+
+	body, err = boostQuery("123", 3, 1)
+	assertGoldenJSON(t, "boostQuery", body, err, `{"query": {"bool": {"should": [
+		{"match_phrase": {"entity_id": {"query": "123", "boost": 3}}},
+		{"match_phrase": {"entity_type": {"query": "123", "boost": 1}}}]}}}`)
+
+	body, err = scriptScoreQuery(Bool(), "rank_score", 0.01)
+	assertGoldenJSON(t, "scriptScoreQuery", body, err, `{"query": {"function_score": {
+		"query": {"bool": {}},
+		"functions": [{"script_score": {"script": {
+			"source": "doc[params.field].size() == 0 ? 0 : doc[params.field].value * params.factor",
+			"params": {"field": "rank_score", "factor": 0.01}}}}],
+		"boost_mode": "replace"}}}`)
+
+	body, err = entityTypeAggQuery(10)
+	assertGoldenJSON(t, "entityTypeAggQuery", body, err, `{"size": 0, "aggs": {
+		"entity_types": {"terms": {"field": "entity_type", "size": 10}},
+		"related_entities": {"nested": {"path": "related_entities"}, "aggs": {
+			"entity_types": {"terms": {"field": "related_entities.entity_type", "size": 10}}}}}}`)
+}
+
+func TestQueryHelpersRejectNilClauses(t *testing.T) {
+	if _, err := minimumShouldMatchQuery(1, Term("entity_id", "123"), nil); err == nil {
+		t.Fatal("minimumShouldMatchQuery accepted a nil should clause")
+	}
+}
+
+func TestCreateZeusESIndexUsesVersionedIndexBehindAlias(t *testing.T) {
+	var (
+		method, path string
+		body         map[string]interface{}
+	)
+	transport := &fixtureTransport{
+		status: http.StatusOK,
+		body:   []byte(`{"acknowledged":true,"shards_acknowledged":true,"index":"indexName_v1"}`),
+		onRequest: func(req *http.Request, data []byte) {
+			method, path = req.Method, req.URL.Path
+			json.Unmarshal(data, &body)
+		},
+	}
+	if err := createZeusESIndex(WrapClient(newTransportClient(t, transport), nil)); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPut || path != "/indexName_v1" {
+		t.Fatalf("request = %s %s, want PUT /indexName_v1", method, path)
+	}
+	alias, ok := body["aliases"].(map[string]interface{})["indexName"].(map[string]interface{})
+	if !ok || alias["is_write_index"] != true {
+		t.Fatalf("aliases = %v", body["aliases"])
+	}
+	// reindexZeusESIndex 在此基础上生成下一个版本
+	if got := nextIndexVersion("indexName_v1"); got != "indexName_v2" {
+		t.Fatalf("nextIndexVersion = %s", got)
+	}
+}
+
+// countingDocument 序列化时计数，用来确认文档是分批编码的
+type countingDocument struct {
+	ID      string `json:"id" es:"id"`
+	Payload string `json:"payload,omitempty"`
+	encoded *int
+}
+
+func (d countingDocument) MarshalJSON() ([]byte, error) {
+	*d.encoded++
+	return json.Marshal(map[string]string{"id": d.ID, "payload": d.Payload})
+}
+
+func countingDocuments(n int, payload string, encoded *int) []interface{} {
+	documents := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		documents = append(documents, countingDocument{ID: fmt.Sprint(i), Payload: payload, encoded: encoded})
+	}
+	return documents
+}
+
+func TestPerformESInsertEncodesInChunks(t *testing.T) {
+	encoded := 0
+	var encodedAtRequest []int
+	recorder := &bulkRecorder{}
+	send := recorder.transport(t)
+	client := WrapClient(newTransportClient(t, roundTripFunc(func(req *http.Request) (int, string) {
+		encodedAtRequest = append(encodedAtRequest, encoded)
+		return send(req)
+	})), nil)
+
+	result, err := performESInsert(client, "zeus", countingDocuments(2500, "", &encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(recorder.batches()); got != "[1000 1000 500]" {
+		t.Fatalf("batches = %s", got)
+	}
+	// 发送每一批时只编码到了这一批为止
+	if got := fmt.Sprint(encodedAtRequest); got != "[1000 2000 2500]" {
+		t.Fatalf("documents encoded at each request = %s", got)
+	}
+	if result.NumRequests != 3 || result.NumSucceeded != 2500 || result.NumFailed != 0 {
+		t.Fatalf("result = %+v", result)
+	}
+}
+
+func TestPerformESUpsertChunksByBytes(t *testing.T) {
+	encoded := 0
+	recorder := &bulkRecorder{}
+	client := WrapClient(newTransportClient(t, recorder.transport(t)), nil)
+
+	payload := strings.Repeat("x", 2*1024*1024)
+	result, err := performESUpsert(client, "zeus", countingDocuments(3, payload, &encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(recorder.batches()); got != "[2 1]" {
+		t.Fatalf("batches = %s, want [2 1]", got)
+	}
+	if result.NumSucceeded != 3 {
+		t.Fatalf("result = %+v", result)
+	}
+}
+
+func TestPerformESUpsertStopsAtInvalidDocument(t *testing.T) {
+	encoded := 0
+	recorder := &bulkRecorder{}
+	client := WrapClient(newTransportClient(t, recorder.transport(t)), nil)
+
+	documents := append(countingDocuments(1000, "", &encoded), Source{}, Source{EntityID: "after"})
+	result, err := performESUpsert(client, "zeus", documents)
+	if err == nil {
+		t.Fatal("document without id was accepted")
+	}
+	if got := fmt.Sprint(recorder.batches()); got != "[1000]" {
+		t.Fatalf("batches = %s, want [1000]", got)
+	}
+	if result.NumSucceeded != 1000 {
+		t.Fatalf("result = %+v", result)
+	}
+}
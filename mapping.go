@@ -0,0 +1,275 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ================================ 根据结构体生成 mapping ================================
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// MappingFromStruct 根据结构体生成 mapping，返回 {"properties": {...}}。
+// 字段名取 json tag，字段类型根据 Go 类型推断，也可以通过 es tag 指定：
+//
+//	Title    string    `json:"title" es:"type=text,analyzer=ik_max_word,search_analyzer=ik_smart,keyword=raw"`
+//	Time     time.Time `json:"time" es:"format=yyyy-MM-dd HH:mm:ss"`
+//	Entities []Entity  `json:"entities" es:"nested"`
+//	Raw      string    `json:"raw" es:"index=false"`
+//	Extra    Extra     `json:"extra" es:"enabled=false"`
+//	Ignored  string    `json:"ignored" es:"-"`
+func MappingFromStruct(v interface{}) (map[string]interface{}, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("mapping can only be generated from a struct, got %T", v)
+	}
+	properties, err := structProperties(t, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"properties": properties,
+	}, nil
+}
+
+// structProperties 生成结构体字段的 properties，visiting 用于检测循环引用
+func structProperties(t reflect.Type, visiting map[reflect.Type]bool) (map[string]interface{}, error) {
+	if visiting[t] {
+		return nil, fmt.Errorf("recursive type %s can not be mapped", t)
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	properties := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get(documentTagName)
+		if tag == "-" {
+			continue
+		}
+		name, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+
+		// 没有 json 名称的匿名嵌入结构体，字段展开到当前层级
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded, err := structProperties(ft, visiting)
+				if err != nil {
+					return nil, err
+				}
+				for k, v := range embedded {
+					if _, ok := properties[k]; !ok {
+						properties[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		mapping, err := fieldMapping(field.Type, parseMappingOptions(tag), visiting)
+		if err != nil {
+			return nil, fmt.Errorf("field %s.%s: %s", t.Name(), field.Name, err)
+		}
+		if mapping != nil {
+			properties[name] = mapping
+		}
+	}
+	return properties, nil
+}
+
+// jsonFieldName 取字段的 json 名称，json:"-" 时跳过
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	return strings.Split(tag, ",")[0], false
+}
+
+// mappingOptions es tag 中的 mapping 选项，key=value 形式的参数和不带值的标记
+type mappingOptions struct {
+	params map[string]string
+	flags  map[string]bool
+}
+
+// parseMappingOptions 解析 es tag，id、routing 等元数据选项也会被当作标记，不影响 mapping
+func parseMappingOptions(tag string) mappingOptions {
+	opts := mappingOptions{params: map[string]string{}, flags: map[string]bool{}}
+	for _, option := range strings.Split(tag, ",") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		if kv := strings.SplitN(option, "=", 2); len(kv) == 2 {
+			opts.params[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		} else {
+			opts.flags[option] = true
+		}
+	}
+	return opts
+}
+
+// fieldMapping 生成单个字段的 mapping，返回 nil 表示交给动态映射
+func fieldMapping(t reflect.Type, opts mappingOptions, visiting map[reflect.Type]bool) (map[string]interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// 数组在 es 中和单个值的 mapping 一样
+	if (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t != rawMessageType && t.Elem().Kind() != reflect.Uint8 {
+		return fieldMapping(t.Elem(), opts, visiting)
+	}
+
+	mapping := map[string]interface{}{}
+	fieldType := opts.params["type"]
+	switch {
+	case opts.flags["nested"]:
+		fieldType = "nested"
+	case opts.flags["object"]:
+		fieldType = "object"
+	}
+
+	if fieldType == "" || fieldType == "nested" || fieldType == "object" {
+		switch {
+		case t == timeType:
+			fieldType = "date"
+		case t.Kind() == reflect.Struct:
+			properties, err := structProperties(t, visiting)
+			if err != nil {
+				return nil, err
+			}
+			mapping["properties"] = properties
+		case fieldType == "":
+			inferred, ok := inferFieldType(t)
+			if !ok {
+				return nil, nil
+			}
+			fieldType = inferred
+		}
+	}
+	// object 是默认类型，和手写 mapping 保持一致不输出
+	if fieldType != "" && fieldType != "object" {
+		mapping["type"] = fieldType
+	} else if _, ok := mapping["properties"]; !ok {
+		mapping["type"] = "object"
+	}
+
+	for _, key := range []string{"analyzer", "search_analyzer", "format", "normalizer", "null_value", "copy_to"} {
+		if v, ok := opts.params[key]; ok {
+			mapping[key] = v
+		}
+	}
+	for _, key := range []string{"index", "enabled", "doc_values", "store"} {
+		if v, ok := opts.params[key]; ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s=%s: %s", key, v, err)
+			}
+			mapping[key] = b
+		}
+	}
+	// 不索引的对象不需要 properties
+	if enabled, ok := mapping["enabled"].(bool); ok && !enabled {
+		delete(mapping, "properties")
+	}
+	if v, ok := opts.params["ignore_above"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore_above=%s: %s", v, err)
+		}
+		mapping["ignore_above"] = n
+	}
+	// text 字段加上 keyword 子字段，用于排序和聚合
+	if sub, ok := opts.params["keyword"]; ok {
+		mapping["fields"] = map[string]interface{}{
+			sub: map[string]interface{}{
+				"type":         "keyword",
+				"ignore_above": 256,
+			},
+		}
+	}
+	return mapping, nil
+}
+
+// inferFieldType 根据 Go 类型推断 es 字段类型
+func inferFieldType(t reflect.Type) (string, bool) {
+	switch t.Kind() {
+	case reflect.String:
+		return "keyword", true
+	case reflect.Bool:
+		return "boolean", true
+	case reflect.Int8:
+		return "byte", true
+	case reflect.Int16:
+		return "short", true
+	case reflect.Int32:
+		return "integer", true
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "long", true
+	case reflect.Float32:
+		return "float", true
+	case reflect.Float64:
+		return "double", true
+	case reflect.Slice:
+		// []byte 会被 json 编码成 base64
+		if t.Elem().Kind() == reflect.Uint8 && t != rawMessageType {
+			return "binary", true
+		}
+	case reflect.Map:
+		return "object", true
+	}
+	return "", false
+}
+
+// MergeMappings 深度合并多个 mapping，后面的覆盖前面的，dynamic_templates 数组会拼接
+func MergeMappings(mappings ...map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for _, m := range mappings {
+		mergeMapping(merged, m)
+	}
+	return merged
+}
+
+func mergeMapping(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if k == "dynamic_templates" {
+			existing, _ := dst[k].([]interface{})
+			if templates, ok := v.([]interface{}); ok {
+				dst[k] = append(existing, templates...)
+				continue
+			}
+		}
+		srcMap, ok := v.(map[string]interface{})
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		dstMap, ok := dst[k].(map[string]interface{})
+		if !ok {
+			dstMap = map[string]interface{}{}
+			dst[k] = dstMap
+		}
+		mergeMapping(dstMap, srcMap)
+	}
+}
@@ -0,0 +1,237 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mappingAuthor struct {
+	Name string `json:"name" es:"type=text,analyzer=ik_max_word,search_analyzer=ik_smart,keyword=raw"`
+}
+
+type mappingBase struct {
+	CreatedAt time.Time `json:"created_at" es:"format=yyyy-MM-dd HH:mm:ss"`
+}
+
+type mappingArticle struct {
+	mappingBase
+	ID       string            `json:"id" es:"id"`
+	Title    string            `json:"title" es:"type=text,analyzer=ik_max_word"`
+	Views    int64             `json:"views"`
+	Rank     int32             `json:"rank"`
+	Score    float32           `json:"score"`
+	Weight   float64           `json:"weight"`
+	Public   bool              `json:"public"`
+	Tags     []string          `json:"tags" es:"ignore_above=64"`
+	Author   *mappingAuthor    `json:"author"`
+	Comments []mappingAuthor   `json:"comments" es:"nested"`
+	Raw      string            `json:"raw" es:"index=false"`
+	Extra    mappingAuthor     `json:"extra" es:"enabled=false"`
+	Labels   map[string]string `json:"labels"`
+	Thumb    []byte            `json:"thumb"`
+	Payload  json.RawMessage   `json:"payload"`
+	Skipped  string            `json:"skipped" es:"-"`
+	Hidden   string            `json:"-"`
+	NoTag    string
+	private  string
+}
+
+func TestMappingFromStruct(t *testing.T) {
+	mapping, err := MappingFromStruct(&mappingArticle{})
+	assertGoldenJSON(t, "MappingFromStruct", mapping, err, `{"properties": {
+		"created_at": {"type": "date", "format": "yyyy-MM-dd HH:mm:ss"},
+		"id": {"type": "keyword"},
+		"title": {"type": "text", "analyzer": "ik_max_word"},
+		"views": {"type": "long"},
+		"rank": {"type": "integer"},
+		"score": {"type": "float"},
+		"weight": {"type": "double"},
+		"public": {"type": "boolean"},
+		"tags": {"type": "keyword", "ignore_above": 64},
+		"author": {"properties": {
+			"name": {"type": "text", "analyzer": "ik_max_word", "search_analyzer": "ik_smart",
+				"fields": {"raw": {"type": "keyword", "ignore_above": 256}}}
+		}},
+		"comments": {"type": "nested", "properties": {
+			"name": {"type": "text", "analyzer": "ik_max_word", "search_analyzer": "ik_smart",
+				"fields": {"raw": {"type": "keyword", "ignore_above": 256}}}
+		}},
+		"raw": {"type": "keyword", "index": false},
+		"extra": {"enabled": false},
+		"labels": {"type": "object"},
+		"thumb": {"type": "binary"},
+		"NoTag": {"type": "keyword"}
+	}}`)
+}
+
+type mappingNode struct {
+	Children []mappingNode `json:"children"`
+}
+
+func TestMappingFromStructErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{name: "not a struct", v: map[string]interface{}{}, want: "can only be generated from a struct"},
+		{name: "nil", v: nil, want: "can only be generated from a struct"},
+		{name: "recursive", v: mappingNode{}, want: "recursive type"},
+		{name: "invalid bool option", v: struct {
+			Raw string `json:"raw" es:"index=no"`
+		}{}, want: "invalid index=no"},
+		{name: "invalid ignore_above", v: struct {
+			Tag string `json:"tag" es:"ignore_above=long"`
+		}{}, want: "invalid ignore_above=long"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := MappingFromStruct(tt.v); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeMappings(t *testing.T) {
+	first := map[string]interface{}{
+		"dynamic_templates": []interface{}{map[string]interface{}{"a": 1}},
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{"type": "text", "analyzer": "standard"},
+			"views": map[string]interface{}{"type": "long"},
+		},
+	}
+	second := map[string]interface{}{
+		"dynamic":           "strict",
+		"dynamic_templates": []interface{}{map[string]interface{}{"b": 2}},
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{"analyzer": "ik_max_word"},
+			"tags":  map[string]interface{}{"type": "keyword"},
+		},
+	}
+	assertGoldenJSON(t, "MergeMappings", MergeMappings(first, second, nil), nil, `{
+		"dynamic": "strict",
+		"dynamic_templates": [{"a": 1}, {"b": 2}],
+		"properties": {
+			"title": {"type": "text", "analyzer": "ik_max_word"},
+			"views": {"type": "long"},
+			"tags": {"type": "keyword"}
+		}
+	}`)
+	// 输入的 mapping 不会被修改
+	assertGoldenJSON(t, "first", first, nil, `{
+		"dynamic_templates": [{"a": 1}],
+		"properties": {"title": {"type": "text", "analyzer": "standard"}, "views": {"type": "long"}}
+	}`)
+}
+
+// legacyZeusMappings 改成由结构体生成之前，createZeusESIndex 中手写的 mappings
+func legacyZeusMappings() map[string]interface{} {
+	return map[string]interface{}{
+		"dynamic_templates": []interface{}{
+			map[string]interface{}{
+				"ik_fields": map[string]interface{}{
+					"path_match":         "ik.*",
+					"match_mapping_type": "string",
+					"mapping": map[string]interface{}{
+						"analyzer":        "ik_max_word",
+						"search_analyzer": "ik_smart",
+						"type":            "text",
+					},
+				},
+			},
+			map[string]interface{}{
+				"whitespace_fields": map[string]interface{}{
+					"path_match":         "ws.*",
+					"match_mapping_type": "string",
+					"mapping": map[string]interface{}{
+						"analyzer": "whitespace",
+						"type":     "text",
+					},
+				},
+			},
+			map[string]interface{}{
+				"standard_fields": map[string]interface{}{
+					"path_match":         "sd.*",
+					"match_mapping_type": "string",
+					"mapping": map[string]interface{}{
+						"analyzer": "standard",
+						"type":     "text",
+					},
+				},
+			},
+			map[string]interface{}{
+				"keyword_fields": map[string]interface{}{
+					"path_match":         "kw.*",
+					"match_mapping_type": "string",
+					"mapping": map[string]interface{}{
+						"analyzer": "standard",
+						"type":     "keyword",
+					},
+				},
+			},
+			map[string]interface{}{
+				"not_indexed_fields": map[string]interface{}{
+					"path_match":         "ni.*",
+					"match_mapping_type": "string",
+					"mapping": map[string]interface{}{
+						"enabled": false,
+						"type":    "object",
+					},
+				},
+			},
+		},
+		// 因为signals是对象，所以套多了一层properties
+		"properties": map[string]interface{}{
+			"signals": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"score": map[string]interface{}{
+						"type": "float",
+					},
+					"signal_id": map[string]interface{}{
+						"type": "keyword",
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestZeusIndexMappingsMatchLegacy(t *testing.T) {
+	body, err := zeusIndexBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mappings := body["mappings"].(map[string]interface{})
+
+	// Source 的字段是新生成的，单独比较后去掉，剩下的部分必须和手写的 mappings 完全一致
+	properties := mappings["properties"].(map[string]interface{})
+	sourceProperties := map[string]interface{}{}
+	for _, name := range []string{"entity_id", "entity_type", "related_entities"} {
+		sourceProperties[name] = properties[name]
+		delete(properties, name)
+	}
+	assertGoldenJSON(t, "source properties", sourceProperties, nil, `{
+		"entity_id": {"type": "keyword"},
+		"entity_type": {"type": "long"},
+		"related_entities": {"type": "nested", "properties": {
+			"entity_id": {"type": "keyword"},
+			"entity_type": {"type": "long"}
+		}}
+	}`)
+
+	want, err := json.Marshal(legacyZeusMappings())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGoldenJSON(t, "zeus mappings", mappings, nil, string(want))
+
+	// 组件模板中的动态模板也要和手写的一致
+	component := zeusTemplateRegistry("zeus-*").components[zeusFieldConventionsTemplate]
+	if !reflect.DeepEqual(component.Template.Mappings["dynamic_templates"], legacyZeusMappings()["dynamic_templates"]) {
+		t.Fatalf("component template dynamic_templates = %v", component.Template.Mappings["dynamic_templates"])
+	}
+}
@@ -0,0 +1,109 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+)
+
+// ================================ 多个查询一次发送 ================================
+
+// MultiSearchRequest msearch 中的一个查询，Query 可以是任意查询方法生成的请求体
+type MultiSearchRequest struct {
+	Index string
+	Query map[string]interface{}
+}
+
+// MultiSearchOptions msearch 的可选参数
+type MultiSearchOptions struct {
+	// 集群同时执行的查询数量，小于等于 0 时由 es 决定
+	MaxConcurrentSearches int
+}
+
+// MultiSearchItem 单个查询的结果，查询失败时 Err 为 *ESError，Result 为 nil
+type MultiSearchItem[T any] struct {
+	Result *SearchResult[T]
+	Err    error
+}
+
+// MultiSearch 把多个查询放在一个 _msearch 请求中发送，结果和 requests 的顺序一致。
+// 单个查询失败不影响其他查询，错误记录在对应的 MultiSearchItem.Err 中；
+// 只有整个请求失败时才返回 error。各个查询的 _source 结构不同时 T 可以用 json.RawMessage
+func MultiSearch[T any](ctx context.Context, esClient *elasticsearch.Client, requests []MultiSearchRequest, options MultiSearchOptions) ([]MultiSearchItem[T], error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i, r := range requests {
+		header := map[string]interface{}{}
+		if r.Index != "" {
+			header["index"] = r.Index
+		}
+		// 和 Search 一样返回精确的命中总数
+		query := make(map[string]interface{}, len(r.Query)+1)
+		for k, v := range r.Query {
+			query[k] = v
+		}
+		if _, ok := query["track_total_hits"]; !ok {
+			query["track_total_hits"] = true
+		}
+		// Encode 会在每一行后面加上换行，正好是 NDJSON 格式
+		if err := enc.Encode(header); err != nil {
+			return nil, errors.Wrapf(err, "encode header of request %d", i)
+		}
+		if err := enc.Encode(query); err != nil {
+			return nil, errors.Wrapf(err, "encode query of request %d", i)
+		}
+	}
+
+	opts := []func(*esapi.MsearchRequest){esClient.Msearch.WithContext(ctx)}
+	if options.MaxConcurrentSearches > 0 {
+		opts = append(opts, esClient.Msearch.WithMaxConcurrentSearches(options.MaxConcurrentSearches))
+	}
+	res, err := performWithRetry(ctx, DefaultRetryPolicy, func() (*esapi.Response, error) {
+		return esClient.Msearch(bytes.NewReader(buf.Bytes()), opts...)
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var r struct {
+		Responses []json.RawMessage `json:"responses"`
+	}
+	if err := decodeResponse(res, &r); err != nil {
+		return nil, err
+	}
+	if len(r.Responses) != len(requests) {
+		return nil, fmt.Errorf("msearch response has %d items, expected %d", len(r.Responses), len(requests))
+	}
+
+	items := make([]MultiSearchItem[T], len(requests))
+	for i, raw := range r.Responses {
+		items[i] = parseMultiSearchItem[T](raw)
+	}
+	return items, nil
+}
+
+// parseMultiSearchItem 解析单个查询的结果，有 error 字段时说明该查询失败
+func parseMultiSearchItem[T any](raw json.RawMessage) MultiSearchItem[T] {
+	var status struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return MultiSearchItem[T]{Err: errors.Wrap(err, "Error parsing the response body")}
+	}
+	if len(status.Error) > 0 {
+		return MultiSearchItem[T]{Err: parseESError(status.Status, raw)}
+	}
+	result := new(SearchResult[T])
+	if err := json.Unmarshal(raw, result); err != nil {
+		return MultiSearchItem[T]{Err: errors.Wrap(err, "Error parsing the response body")}
+	}
+	return MultiSearchItem[T]{Result: result}
+}
@@ -0,0 +1,106 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestMultiSearch(t *testing.T) {
+	var (
+		path, concurrency string
+		lines             [][]byte
+	)
+	transport := &fixtureTransport{
+		status: http.StatusOK,
+		body: []byte(`{"took":5,"responses":[
+			{"took":1,"hits":{"total":{"value":1,"relation":"eq"},"hits":[{"_index":"zeus","_id":"1","_source":{"entity_id":"1"}}]},"status":200},
+			{"error":{"root_cause":[{"type":"index_not_found_exception","reason":"no such index [missing]","index":"missing"}],
+				"type":"index_not_found_exception","reason":"no such index [missing]","index":"missing"},"status":404},
+			{"took":2,"hits":{"total":{"value":0,"relation":"eq"},"hits":[]},"status":200}]}`),
+		onRequest: func(req *http.Request, body []byte) {
+			path = req.URL.Path
+			concurrency = req.URL.Query().Get("max_concurrent_searches")
+			lines = bytes.Split(body, []byte("\n"))
+		},
+	}
+	client := newTransportClient(t, transport)
+
+	query := NewSearchBody().Query(Term("entity_id", "1")).Size(1).Map()
+	items, err := MultiSearch[Source](context.Background(), client, []MultiSearchRequest{
+		{Index: "zeus", Query: query},
+		{Index: "missing", Query: NewSearchBody().Map()},
+		// 已经设置的 track_total_hits 不会被覆盖
+		{Query: map[string]interface{}{"track_total_hits": 100}},
+	}, MultiSearchOptions{MaxConcurrentSearches: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/_msearch" || concurrency != "2" {
+		t.Fatalf("path = %s, max_concurrent_searches = %q", path, concurrency)
+	}
+	// 每个查询两行，最后以换行结尾
+	if len(lines) != 7 || len(lines[6]) != 0 {
+		t.Fatalf("body has %d lines: %q", len(lines), bytes.Join(lines, []byte("\n")))
+	}
+	golden := []string{
+		`{"index": "zeus"}`,
+		`{"query": {"term": {"entity_id": "1"}}, "size": 1, "track_total_hits": true}`,
+		`{"index": "missing"}`,
+		`{"track_total_hits": true}`,
+		`{}`,
+		`{"track_total_hits": 100}`,
+	}
+	for i, want := range golden {
+		var line map[string]interface{}
+		if err := json.Unmarshal(lines[i], &line); err != nil {
+			t.Fatalf("line %d %q: %v", i, lines[i], err)
+		}
+		assertGoldenJSON(t, "msearch line", line, nil, want)
+	}
+	// 原始查询没有被修改
+	if _, ok := query["track_total_hits"]; ok {
+		t.Fatal("request query was modified")
+	}
+
+	if len(items) != 3 {
+		t.Fatalf("items = %d, want 3", len(items))
+	}
+	if items[0].Err != nil || items[0].Result == nil || items[0].Result.Hits.Hits[0].Source.EntityID != "1" {
+		t.Fatalf("item 0 = %+v", items[0])
+	}
+	var esErr *ESError
+	if items[1].Result != nil || !IsNotFound(items[1].Err) {
+		t.Fatalf("item 1 = %+v, want a not found error", items[1])
+	}
+	if !errors.As(items[1].Err, &esErr) || esErr.Type != "index_not_found_exception" || esErr.Index != "missing" {
+		t.Fatalf("item 1 error = %#v", items[1].Err)
+	}
+	if items[2].Err != nil || items[2].Result.Hits.Total.Value != 0 {
+		t.Fatalf("item 2 = %+v", items[2])
+	}
+}
+
+func TestMultiSearchErrors(t *testing.T) {
+	ctx := context.Background()
+	items, err := MultiSearch[Source](ctx, newTransportClient(t, failTransport{t}), nil, MultiSearchOptions{})
+	if err != nil || items != nil {
+		t.Fatalf("empty requests = %v, %v", items, err)
+	}
+
+	requests := []MultiSearchRequest{{Index: "zeus"}, {Index: "zeus"}}
+	client := newFixtureClient(t, http.StatusOK, []byte(`{"responses":[{"hits":{"hits":[]},"status":200}]}`))
+	if _, err := MultiSearch[Source](ctx, client, requests, MultiSearchOptions{}); err == nil {
+		t.Fatal("response with missing items accepted")
+	}
+
+	client = newFixtureClient(t, http.StatusBadRequest, []byte(`{"error":{"type":"illegal_argument_exception","reason":"bad msearch"},"status":400}`))
+	if _, err := MultiSearch[Source](ctx, client, requests, MultiSearchOptions{}); err == nil || IsNotFound(err) {
+		t.Fatalf("err = %v, want the request error", err)
+	}
+}
@@ -0,0 +1,327 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+)
+
+// ================================ point-in-time + search_after 分页 ================================
+
+// 没有指定时使用的排序兜底字段，保证排序值唯一
+const defaultTiebreaker = "_shard_doc"
+
+const (
+	// MaxPageSize 每页最多返回的条数，和 es 默认的 index.max_result_window 一致
+	MaxPageSize = 10000
+	// MaxKeepAlive point-in-time 最长的保留时间，避免游标长期占用集群资源
+	MaxKeepAlive = time.Hour
+)
+
+// Paginator 基于 point-in-time 和 search_after 的深度分页，适合给接口调用方翻页，
+// 不像滚动查询那样长期占用 scroll 上下文
+//
+//	query, err := NewSearchBody().Sort("publish_time", "desc").Build()
+//	p := NewPaginator[Source](client, "indexName", query, 100, time.Minute)
+//	if p.Next(ctx) {
+//		hits, cursor := p.Hits(), p.Cursor() // cursor 交给调用方，下次用 ResumePaginator 继续
+//	}
+//	if p.Cursor() == "" {
+//		err = p.Close() // 已经是最后一页，返回自动关闭 point-in-time 时的错误
+//	}
+type Paginator[T any] struct {
+	client     *elasticsearch.Client
+	index      string
+	query      map[string]interface{}
+	pageSize   int
+	keepAlive  time.Duration
+	tiebreaker string
+
+	pitID       string
+	searchAfter []interface{}
+	hits        []Hit[T]
+	total       Total
+	err         error
+	done        bool
+	// 翻到最后一页时自动关闭 point-in-time 的错误，由 Close 返回
+	closeErr error
+}
+
+// paginatorCursor 游标的内容，对调用方不透明
+type paginatorCursor struct {
+	PitID       string        `json:"pit"`
+	SearchAfter []interface{} `json:"after,omitempty"`
+	PageSize    int           `json:"size"`
+	KeepAlive   int64         `json:"keep_alive"`
+}
+
+// NewPaginator 创建分页器，query 可以是任意查询方法生成的请求体，其中的 sort 会自动追加 _shard_doc 兜底，
+// from 和 size 会被忽略；pageSize 小于等于 0 时使用 10，最大 MaxPageSize；
+// keepAlive 为每次翻页后 point-in-time 的保留时间，小于等于 0 时使用 1 分钟，最长 MaxKeepAlive
+func NewPaginator[T any](client *elasticsearch.Client, index string, query map[string]interface{}, pageSize int, keepAlive time.Duration) *Paginator[T] {
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+	if keepAlive <= 0 {
+		keepAlive = time.Minute
+	}
+	if keepAlive > MaxKeepAlive {
+		keepAlive = MaxKeepAlive
+	}
+	return &Paginator[T]{
+		client:     client,
+		index:      index,
+		query:      query,
+		pageSize:   pageSize,
+		keepAlive:  keepAlive,
+		tiebreaker: defaultTiebreaker,
+	}
+}
+
+// ResumePaginator 根据 Cursor 返回的游标继续翻页，query 需要和第一次查询时一致。
+// 游标没有签名，调用方可以修改其中的每页条数和保留时间，因此同样限制在 MaxPageSize 和 MaxKeepAlive 以内
+func ResumePaginator[T any](client *elasticsearch.Client, query map[string]interface{}, cursor string) (*Paginator[T], error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %s", err)
+	}
+	var c paginatorCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.PitID == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	p := NewPaginator[T](client, "", query, c.PageSize, time.Duration(c.KeepAlive)*time.Millisecond)
+	p.pitID = c.PitID
+	p.searchAfter = c.SearchAfter
+	return p, nil
+}
+
+// Tiebreaker 修改兜底排序字段，集群版本低于 7.12 不支持 _shard_doc 时可以改为 _id 等唯一字段
+func (p *Paginator[T]) Tiebreaker(field string) *Paginator[T] {
+	p.tiebreaker = field
+	return p
+}
+
+// Next 取下一页，没有数据或者出错时返回 false，返回 true 时 Err 一定为 nil
+func (p *Paginator[T]) Next(ctx context.Context) bool {
+	if p.done || p.err != nil {
+		return false
+	}
+	if p.pitID == "" {
+		pitID, err := openPointInTime(ctx, p.client, p.index, p.keepAlive)
+		if err != nil {
+			p.err = err
+			return false
+		}
+		p.pitID = pitID
+	}
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(p.pageQuery()); err != nil {
+		p.err = errors.WithStack(err)
+		return false
+	}
+	res, err := performWithRetry(ctx, DefaultRetryPolicy, func() (*esapi.Response, error) {
+		return p.client.Search(
+			p.client.Search.WithContext(ctx),
+			p.client.Search.WithBody(bytes.NewReader(body.Bytes())),
+		)
+	})
+	if err != nil {
+		p.err = errors.WithStack(fmt.Errorf("Error getting response: %s", err))
+		return false
+	}
+	result, err := decodeSearchResponse[T](res)
+	if err != nil {
+		p.err = err
+		return false
+	}
+
+	// 每次返回的 pit_id 可能变化，需要使用最新的
+	if result.PitID != "" {
+		p.pitID = result.PitID
+	}
+	p.total = result.Hits.Total
+	p.hits = result.Hits.Hits
+	if len(p.hits) == 0 {
+		p.finish(ctx)
+		return false
+	}
+	p.searchAfter = p.hits[len(p.hits)-1].Sort
+	// 最后一页直接关闭 point-in-time，不用等到 keep_alive 过期
+	if len(p.hits) < p.pageSize {
+		p.finish(ctx)
+	}
+	return true
+}
+
+// finish 翻页结束，关闭 point-in-time，关闭失败时不影响已经取到的最后一页，错误由 Close 返回
+func (p *Paginator[T]) finish(ctx context.Context) {
+	p.done = true
+	p.closeErr = p.closePit(ctx)
+}
+
+// closePit 关闭 point-in-time，已经关闭时什么都不做
+func (p *Paginator[T]) closePit(ctx context.Context) error {
+	if p.pitID == "" {
+		return nil
+	}
+	pitID := p.pitID
+	p.pitID = ""
+	return closePointInTime(ctx, p.client, pitID)
+}
+
+// pageQuery 在原始查询的基础上加上 pit、sort 和 search_after
+func (p *Paginator[T]) pageQuery() map[string]interface{} {
+	query := make(map[string]interface{}, len(p.query)+4)
+	for k, v := range p.query {
+		query[k] = v
+	}
+	delete(query, "from")
+	query["size"] = p.pageSize
+	query["pit"] = map[string]interface{}{
+		"id":         p.pitID,
+		"keep_alive": formatKeepAlive(p.keepAlive),
+	}
+	query["sort"] = withTiebreaker(p.query["sort"], p.tiebreaker)
+	if len(p.searchAfter) > 0 {
+		query["search_after"] = p.searchAfter
+	}
+	return query
+}
+
+// Hits 当前页的数据
+func (p *Paginator[T]) Hits() []Hit[T] {
+	return p.hits
+}
+
+// Total 查询命中的总数
+func (p *Paginator[T]) Total() Total {
+	return p.total
+}
+
+// Err 翻页过程中的错误
+func (p *Paginator[T]) Err() error {
+	return p.err
+}
+
+// Cursor 下一页的游标，已经是最后一页时返回空字符串
+func (p *Paginator[T]) Cursor() string {
+	if p.done || p.pitID == "" {
+		return ""
+	}
+	data, _ := json.Marshal(paginatorCursor{
+		PitID:       p.pitID,
+		SearchAfter: p.searchAfter,
+		PageSize:    p.pageSize,
+		KeepAlive:   p.keepAlive.Milliseconds(),
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Close 关闭 point-in-time，关闭后游标失效，可以重复调用。翻到最后一页时 Next 已经自动关闭，
+// 此时 Close 返回自动关闭时的错误；需要把游标交给调用方继续翻页时不要调用
+func (p *Paginator[T]) Close() error {
+	p.done = true
+	if err := p.closePit(context.Background()); err != nil {
+		return err
+	}
+	err := p.closeErr
+	p.closeErr = nil
+	return err
+}
+
+// withTiebreaker 在已有排序后面追加兜底字段，已经包含时不重复追加
+func withTiebreaker(sort interface{}, tiebreaker string) []interface{} {
+	sorts := make([]interface{}, 0)
+	switch s := sort.(type) {
+	case nil:
+	case []interface{}:
+		sorts = append(sorts, s...)
+	case []map[string]interface{}:
+		for _, v := range s {
+			sorts = append(sorts, v)
+		}
+	case []string:
+		for _, v := range s {
+			sorts = append(sorts, v)
+		}
+	default:
+		sorts = append(sorts, s)
+	}
+	for _, s := range sorts {
+		switch v := s.(type) {
+		case string:
+			if v == tiebreaker {
+				return sorts
+			}
+		case map[string]interface{}:
+			if _, ok := v[tiebreaker]; ok {
+				return sorts
+			}
+		}
+	}
+	return append(sorts, map[string]interface{}{
+		tiebreaker: map[string]interface{}{
+			"order": "asc",
+		},
+	})
+}
+
+// formatKeepAlive 转换成 es 的时间格式
+func formatKeepAlive(d time.Duration) string {
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+// openPointInTime 打开 point-in-time，返回 pit id
+func openPointInTime(ctx context.Context, esClient *elasticsearch.Client, index string, keepAlive time.Duration) (string, error) {
+	res, err := esClient.OpenPointInTime(
+		esClient.OpenPointInTime.WithContext(ctx),
+		esClient.OpenPointInTime.WithIndex(strings.Split(index, ",")...),
+		esClient.OpenPointInTime.WithKeepAlive(formatKeepAlive(keepAlive)),
+	)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return "", errors.WithStack(newESError(res))
+	}
+	var r struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return "", errors.WithStack(fmt.Errorf("Error parsing the response body: %s", err))
+	}
+	return r.ID, nil
+}
+
+// closePointInTime 关闭 point-in-time，已经过期时返回 404，不算错误
+func closePointInTime(ctx context.Context, esClient *elasticsearch.Client, pitID string) error {
+	body, err := json.Marshal(map[string]interface{}{"id": pitID})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	res, err := esClient.ClosePointInTime(
+		esClient.ClosePointInTime.WithContext(ctx),
+		esClient.ClosePointInTime.WithBody(bytes.NewReader(body)),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	if res.IsError() && res.StatusCode != 404 {
+		return errors.WithStack(newESError(res))
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc 用函数实现 http.RoundTripper，按请求返回不同的内容
+type roundTripFunc func(req *http.Request) (int, string)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	status, body := f(req)
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader([]byte(body))),
+		Request:    req,
+	}, nil
+}
+
+// paginatorTransport 模拟 pit 的打开、翻页和关闭，pages 为每一页的命中数
+func paginatorTransport(pages []int, closed *int) roundTripFunc {
+	page := 0
+	return func(req *http.Request) (int, string) {
+		switch {
+		case req.Method == http.MethodPost && req.URL.Path == "/zeus/_pit":
+			return http.StatusOK, `{"id":"pit-1"}`
+		case req.Method == http.MethodDelete && req.URL.Path == "/_pit":
+			*closed++
+			return http.StatusOK, `{"succeeded":true,"num_freed":1}`
+		case req.URL.Path == "/_search":
+			var hits bytes.Buffer
+			for i := 0; page < len(pages) && i < pages[page]; i++ {
+				if i > 0 {
+					hits.WriteByte(',')
+				}
+				fmt.Fprintf(&hits, `{"_index":"zeus","_id":"%d-%d","_source":{"entity_id":"e"},"sort":[%d,%d]}`, page, i, page, i)
+			}
+			page++
+			return http.StatusOK, fmt.Sprintf(`{"pit_id":"pit-1","hits":{"total":{"value":3,"relation":"eq"},"hits":[%s]}}`, hits.String())
+		}
+		return http.StatusNotFound, `{"error":"unexpected request","status":404}`
+	}
+}
+
+func TestPaginatorClosesPitAfterLastPage(t *testing.T) {
+	closed := 0
+	client := newTransportClient(t, paginatorTransport([]int{2, 1}, &closed))
+	p := NewPaginator[Source](client, "zeus", NewSearchBody().Query(MatchAll()).Map(), 2, time.Minute)
+
+	var ids []string
+	for p.Next(context.Background()) {
+		for _, hit := range p.Hits() {
+			ids = append(ids, hit.ID)
+		}
+	}
+	if err := p.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 {
+		t.Fatalf("ids = %v, want 3", ids)
+	}
+	if closed != 1 {
+		t.Fatalf("pit closed %d times after last page, want 1", closed)
+	}
+	if p.Cursor() != "" {
+		t.Fatal("cursor is not empty after last page")
+	}
+	if err := p.Close(); err != nil || closed != 1 {
+		t.Fatalf("Close after last page = %v, closed %d times", err, closed)
+	}
+}
+
+func TestPaginatorClosesPitOnEmptyPage(t *testing.T) {
+	closed := 0
+	client := newTransportClient(t, paginatorTransport([]int{2, 0}, &closed))
+	p := NewPaginator[Source](client, "zeus", NewSearchBody().Query(MatchAll()).Map(), 2, time.Minute)
+	for p.Next(context.Background()) {
+	}
+	if err := p.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if closed != 1 {
+		t.Fatalf("pit closed %d times, want 1", closed)
+	}
+}
+
+func TestPaginatorCloseIsIdempotent(t *testing.T) {
+	closed := 0
+	client := newTransportClient(t, paginatorTransport([]int{2, 2, 2}, &closed))
+	p := NewPaginator[Source](client, "zeus", NewSearchBody().Query(MatchAll()).Map(), 2, time.Minute)
+	if !p.Next(context.Background()) {
+		t.Fatal(p.Err())
+	}
+	for i := 0; i < 3; i++ {
+		if err := p.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if closed != 1 {
+		t.Fatalf("pit closed %d times, want 1", closed)
+	}
+	if p.Next(context.Background()) {
+		t.Fatal("Next returned true after Close")
+	}
+}
+
+func TestPaginatorLastPageCloseError(t *testing.T) {
+	closes := 0
+	client := newTransportClient(t, roundTripFunc(func(req *http.Request) (int, string) {
+		switch {
+		case req.Method == http.MethodPost && req.URL.Path == "/zeus/_pit":
+			return http.StatusOK, `{"id":"pit-1"}`
+		case req.Method == http.MethodDelete && req.URL.Path == "/_pit":
+			closes++
+			return http.StatusInternalServerError, `{"error":{"type":"exception","reason":"close failed"},"status":500}`
+		case req.URL.Path == "/_search":
+			return http.StatusOK, `{"pit_id":"pit-1","hits":{"total":{"value":1,"relation":"eq"},"hits":[{"_id":"1","_source":{},"sort":[1]}]}}`
+		}
+		return http.StatusNotFound, `{"error":"unexpected request","status":404}`
+	}))
+	p := NewPaginator[Source](client, "zeus", NewSearchBody().Map(), 2, time.Minute)
+
+	// 最后一页的数据正常返回，关闭失败不影响 Next 和 Err
+	if !p.Next(context.Background()) || len(p.Hits()) != 1 {
+		t.Fatalf("last page not returned, err = %v", p.Err())
+	}
+	if p.Err() != nil {
+		t.Fatalf("Err = %v after Next returned true", p.Err())
+	}
+	if p.Next(context.Background()) || p.Err() != nil || p.Cursor() != "" {
+		t.Fatalf("Next after last page: err = %v, cursor = %q", p.Err(), p.Cursor())
+	}
+	// 关闭的错误由 Close 返回，之后不再重复返回
+	if err := p.Close(); err == nil || !strings.Contains(err.Error(), "close failed") {
+		t.Fatalf("Close = %v, want the close error", err)
+	}
+	if err := p.Close(); err != nil || closes != 1 {
+		t.Fatalf("second Close = %v, closes = %d", err, closes)
+	}
+}
+
+func TestPaginatorNextReturnsFalseOnError(t *testing.T) {
+	client := newTransportClient(t, roundTripFunc(func(req *http.Request) (int, string) {
+		if req.URL.Path == "/zeus/_pit" {
+			return http.StatusOK, `{"id":"pit-1"}`
+		}
+		if req.URL.Path == "/_search" {
+			return http.StatusBadRequest, `{"error":{"type":"parsing_exception","reason":"bad query"},"status":400}`
+		}
+		return http.StatusOK, `{"succeeded":true,"num_freed":1}`
+	}))
+	p := NewPaginator[Source](client, "zeus", NewSearchBody().Map(), 2, time.Minute)
+	if p.Next(context.Background()) || p.Err() == nil {
+		t.Fatalf("Next returned true or Err is nil: %v", p.Err())
+	}
+	if p.Next(context.Background()) {
+		t.Fatal("Next returned true after an error")
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPaginatorCursorResume(t *testing.T) {
+	var bodies []map[string]interface{}
+	client := newTransportClient(t, roundTripFunc(func(req *http.Request) (int, string) {
+		switch {
+		case req.Method == http.MethodPost && req.URL.Path == "/zeus/_pit":
+			return http.StatusOK, `{"id":"pit-1"}`
+		case req.URL.Path == "/_search":
+			var body map[string]interface{}
+			data, _ := io.ReadAll(req.Body)
+			json.Unmarshal(data, &body)
+			bodies = append(bodies, body)
+			return http.StatusOK, fmt.Sprintf(`{"pit_id":"pit-%d","hits":{"total":{"value":4,"relation":"eq"},"hits":[
+				{"_id":"a","_source":{},"sort":[%d,1]},{"_id":"b","_source":{},"sort":[%d,2]}]}}`, len(bodies)+1, len(bodies), len(bodies))
+		}
+		return http.StatusOK, `{"succeeded":true,"num_freed":1}`
+	}))
+	query := NewSearchBody().Sort("publish_time", "desc").Map()
+	p := NewPaginator[Source](client, "zeus", query, 2, 30*time.Second)
+	if !p.Next(context.Background()) {
+		t.Fatal(p.Err())
+	}
+	cursor := p.Cursor()
+
+	resumed, err := ResumePaginator[Source](client, query, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resumed.Next(context.Background()) {
+		t.Fatal(resumed.Err())
+	}
+	assertGoldenJSON(t, "resumed page", bodies[1], nil, `{
+		"size": 2,
+		"pit": {"id": "pit-2", "keep_alive": "30000ms"},
+		"sort": [{"publish_time": {"order": "desc"}}, {"_shard_doc": {"order": "asc"}}],
+		"search_after": [1, 2]}`)
+}
+
+func TestResumePaginatorClampsCursor(t *testing.T) {
+	encode := func(c paginatorCursor) string {
+		data, _ := json.Marshal(c)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	tests := []struct {
+		name      string
+		cursor    paginatorCursor
+		pageSize  int
+		keepAlive time.Duration
+	}{
+		{name: "unchanged", cursor: paginatorCursor{PitID: "pit", PageSize: 50, KeepAlive: 30000}, pageSize: 50, keepAlive: 30 * time.Second},
+		{name: "page size too large", cursor: paginatorCursor{PitID: "pit", PageSize: 1 << 30, KeepAlive: 30000}, pageSize: MaxPageSize, keepAlive: 30 * time.Second},
+		{name: "keep alive too long", cursor: paginatorCursor{PitID: "pit", PageSize: 50, KeepAlive: int64(365 * 24 * time.Hour / time.Millisecond)}, pageSize: 50, keepAlive: MaxKeepAlive},
+		{name: "negative values", cursor: paginatorCursor{PitID: "pit", PageSize: -1, KeepAlive: -1}, pageSize: 10, keepAlive: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ResumePaginator[Source](nil, nil, encode(tt.cursor))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.pageSize != tt.pageSize || p.keepAlive != tt.keepAlive {
+				t.Fatalf("pageSize = %d, keepAlive = %v, want %d and %v", p.pageSize, p.keepAlive, tt.pageSize, tt.keepAlive)
+			}
+		})
+	}
+
+	for _, cursor := range []string{"not base64!", base64.RawURLEncoding.EncodeToString([]byte("{")), encode(paginatorCursor{PageSize: 10})} {
+		if _, err := ResumePaginator[Source](nil, nil, cursor); err == nil {
+			t.Fatalf("invalid cursor %q accepted", cursor)
+		}
+	}
+}
+
+func TestNewPaginatorClampsPageSize(t *testing.T) {
+	p := NewPaginator[Source](nil, "zeus", nil, MaxPageSize+1, 2*MaxKeepAlive)
+	if p.pageSize != MaxPageSize || p.keepAlive != MaxKeepAlive {
+		t.Fatalf("pageSize = %d, keepAlive = %v", p.pageSize, p.keepAlive)
+	}
+}
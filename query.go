@@ -0,0 +1,526 @@
+package elasticsearch
+
+import (
+	"fmt"
+)
+
+// ================================ es 查询 DSL 构造器 ================================
+
+// Query 所有查询子句的公共接口，Map 返回可直接放进请求体的结构
+type Query interface {
+	Map() map[string]interface{}
+}
+
+// SearchBody 查询请求体，Map 的结果可直接交给 performESQuery
+type SearchBody struct {
+	query     Query
+	from      *int
+	size      *int
+	sorts     []map[string]interface{}
+	aggs      map[string]Aggregation
+	highlight *Highlight
+	suggests  map[string]Suggester
+	// 脚本字段，结果在每条命中的 Hit.Fields 中
+	scriptFields map[string]*Script
+}
+
+// NewSearchBody 创建一个空的查询请求体
+func NewSearchBody() *SearchBody {
+	return &SearchBody{}
+}
+
+// Query 设置查询条件
+func (b *SearchBody) Query(q Query) *SearchBody {
+	b.query = q
+	return b
+}
+
+// From 设置分页起始位置
+func (b *SearchBody) From(from int) *SearchBody {
+	b.from = &from
+	return b
+}
+
+// Size 设置返回条数，es 最多只能支持 10000 条
+func (b *SearchBody) Size(size int) *SearchBody {
+	b.size = &size
+	return b
+}
+
+// Sort 追加一个排序字段，order 为 asc 或 desc
+func (b *SearchBody) Sort(field, order string) *SearchBody {
+	b.sorts = append(b.sorts, map[string]interface{}{
+		field: map[string]interface{}{
+			"order": order,
+		},
+	})
+	return b
+}
+
+// Aggregation 添加一个聚合，name 为结果中 Aggregations 的 key；只需要聚合结果时可以 Size(0)
+func (b *SearchBody) Aggregation(name string, agg Aggregation) *SearchBody {
+	if b.aggs == nil {
+		b.aggs = map[string]Aggregation{}
+	}
+	b.aggs[name] = agg
+	return b
+}
+
+// Highlight 设置高亮，结果在 Hit.Highlights 中
+func (b *SearchBody) Highlight(h *Highlight) *SearchBody {
+	b.highlight = h
+	return b
+}
+
+// Suggest 添加一个搜索建议，name 为结果中 Suggest 的 key；只需要建议时可以 Size(0)
+func (b *SearchBody) Suggest(name string, s Suggester) *SearchBody {
+	if b.suggests == nil {
+		b.suggests = map[string]Suggester{}
+	}
+	b.suggests[name] = s
+	return b
+}
+
+// ScriptField 添加一个由脚本计算的返回字段，脚本中用 doc['field'] 读取字段值
+func (b *SearchBody) ScriptField(name string, script *Script) *SearchBody {
+	if b.scriptFields == nil {
+		b.scriptFields = map[string]*Script{}
+	}
+	b.scriptFields[name] = script
+	return b
+}
+
+// Build 校验查询条件和聚合后生成请求体，function_score 等带参数校验的查询在发送前就能发现错误
+func (b *SearchBody) Build() (map[string]interface{}, error) {
+	if b.query != nil {
+		if err := validateQuery(b.query); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateAggregations(b.aggs); err != nil {
+		return nil, err
+	}
+	for _, name := range sortedKeys(b.scriptFields) {
+		if err := b.scriptFields[name].Validate(); err != nil {
+			return nil, fmt.Errorf("script field %s: %s", name, err)
+		}
+	}
+	return b.Map(), nil
+}
+
+// Map 生成最终的请求体
+func (b *SearchBody) Map() map[string]interface{} {
+	body := map[string]interface{}{}
+	if b.query != nil {
+		body["query"] = b.query.Map()
+	}
+	if b.from != nil {
+		body["from"] = *b.from
+	}
+	if b.size != nil {
+		body["size"] = *b.size
+	}
+	if len(b.sorts) > 0 {
+		body["sort"] = b.sorts
+	}
+	if len(b.aggs) > 0 {
+		body["aggs"] = aggregationMaps(b.aggs)
+	}
+	if b.highlight != nil {
+		body["highlight"] = b.highlight.Map()
+	}
+	if len(b.suggests) > 0 {
+		suggest := make(map[string]interface{}, len(b.suggests))
+		for name, s := range b.suggests {
+			suggest[name] = s.Map()
+		}
+		body["suggest"] = suggest
+	}
+	if len(b.scriptFields) > 0 {
+		fields := make(map[string]interface{}, len(b.scriptFields))
+		for name, script := range b.scriptFields {
+			fields[name] = map[string]interface{}{"script": script.Map()}
+		}
+		body["script_fields"] = fields
+		// 有 script_fields 时 es 默认不再返回 _source
+		body["_source"] = true
+	}
+	return body
+}
+
+// queryMaps 将子句列表转换成请求体中的数组。
+// nil 子句生成 null 而不是被去掉，Build 会在发送前报错，直接使用 Map 时 es 也会返回解析错误
+func queryMaps(queries []Query) []map[string]interface{} {
+	clauses := make([]map[string]interface{}, 0, len(queries))
+	for _, q := range queries {
+		if q == nil {
+			clauses = append(clauses, nil)
+			continue
+		}
+		clauses = append(clauses, q.Map())
+	}
+	return clauses
+}
+
+// MatchAllQuery 匹配所有文档
+type MatchAllQuery struct{}
+
+// MatchAll 创建 match_all 查询
+func MatchAll() *MatchAllQuery {
+	return &MatchAllQuery{}
+}
+
+// Map 实现 Query 接口
+func (q *MatchAllQuery) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"match_all": map[string]interface{}{},
+	}
+}
+
+// MatchQuery 会分词，分词后只要命中一部分就会返回
+type MatchQuery struct {
+	field    string
+	value    interface{}
+	operator string
+	boost    *float64
+}
+
+// Match 创建 match 查询
+func Match(field string, value interface{}) *MatchQuery {
+	return &MatchQuery{field: field, value: value}
+}
+
+// Operator 设置分词之间的连接方式，and 或 or
+func (q *MatchQuery) Operator(operator string) *MatchQuery {
+	q.operator = operator
+	return q
+}
+
+// Boost 调节该条件的得分权重
+func (q *MatchQuery) Boost(boost float64) *MatchQuery {
+	q.boost = &boost
+	return q
+}
+
+// Map 实现 Query 接口
+func (q *MatchQuery) Map() map[string]interface{} {
+	// 没有额外参数时使用简写形式
+	if q.operator == "" && q.boost == nil {
+		return map[string]interface{}{
+			"match": map[string]interface{}{
+				q.field: q.value,
+			},
+		}
+	}
+	params := map[string]interface{}{
+		"query": q.value,
+	}
+	if q.operator != "" {
+		params["operator"] = q.operator
+	}
+	if q.boost != nil {
+		params["boost"] = *q.boost
+	}
+	return map[string]interface{}{
+		"match": map[string]interface{}{
+			q.field: params,
+		},
+	}
+}
+
+// MatchPhraseQuery 会分词，分词后必须命中所有的词才会返回
+type MatchPhraseQuery struct {
+	field string
+	value interface{}
+	slop  *int
+	boost *float64
+}
+
+// MatchPhrase 创建 match_phrase 查询
+func MatchPhrase(field string, value interface{}) *MatchPhraseQuery {
+	return &MatchPhraseQuery{field: field, value: value}
+}
+
+// Slop 设置词与词之间允许间隔的距离
+func (q *MatchPhraseQuery) Slop(slop int) *MatchPhraseQuery {
+	q.slop = &slop
+	return q
+}
+
+// Boost 调节该条件的得分权重
+func (q *MatchPhraseQuery) Boost(boost float64) *MatchPhraseQuery {
+	q.boost = &boost
+	return q
+}
+
+// Map 实现 Query 接口
+func (q *MatchPhraseQuery) Map() map[string]interface{} {
+	params := map[string]interface{}{
+		"query": q.value,
+	}
+	if q.slop != nil {
+		params["slop"] = *q.slop
+	}
+	if q.boost != nil {
+		params["boost"] = *q.boost
+	}
+	return map[string]interface{}{
+		"match_phrase": map[string]interface{}{
+			q.field: params,
+		},
+	}
+}
+
+// TermQuery 精确匹配，不分词
+type TermQuery struct {
+	field string
+	value interface{}
+	boost *float64
+}
+
+// Term 创建 term 查询
+func Term(field string, value interface{}) *TermQuery {
+	return &TermQuery{field: field, value: value}
+}
+
+// Boost 调节该条件的得分权重
+func (q *TermQuery) Boost(boost float64) *TermQuery {
+	q.boost = &boost
+	return q
+}
+
+// Map 实现 Query 接口
+func (q *TermQuery) Map() map[string]interface{} {
+	if q.boost == nil {
+		return map[string]interface{}{
+			"term": map[string]interface{}{
+				q.field: q.value,
+			},
+		}
+	}
+	return map[string]interface{}{
+		"term": map[string]interface{}{
+			q.field: map[string]interface{}{
+				"value": q.value,
+				"boost": *q.boost,
+			},
+		},
+	}
+}
+
+// TermsQuery 精确匹配多个值中的任意一个
+type TermsQuery struct {
+	field  string
+	values []interface{}
+}
+
+// Terms 创建 terms 查询
+func Terms(field string, values ...interface{}) *TermsQuery {
+	return &TermsQuery{field: field, values: values}
+}
+
+// Map 实现 Query 接口
+func (q *TermsQuery) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"terms": map[string]interface{}{
+			q.field: q.values,
+		},
+	}
+}
+
+// RangeQuery 指定范围查询
+type RangeQuery struct {
+	field  string
+	params map[string]interface{}
+}
+
+// Range 创建 range 查询
+func Range(field string) *RangeQuery {
+	return &RangeQuery{field: field, params: map[string]interface{}{}}
+}
+
+// Gt 大于
+func (q *RangeQuery) Gt(value interface{}) *RangeQuery {
+	q.params["gt"] = value
+	return q
+}
+
+// Gte 大于等于
+func (q *RangeQuery) Gte(value interface{}) *RangeQuery {
+	q.params["gte"] = value
+	return q
+}
+
+// Lt 小于
+func (q *RangeQuery) Lt(value interface{}) *RangeQuery {
+	q.params["lt"] = value
+	return q
+}
+
+// Lte 小于等于
+func (q *RangeQuery) Lte(value interface{}) *RangeQuery {
+	q.params["lte"] = value
+	return q
+}
+
+// Format 日期字段的格式，例如 yyyy-MM-dd HH:mm:ss
+func (q *RangeQuery) Format(format string) *RangeQuery {
+	q.params["format"] = format
+	return q
+}
+
+// TimeZone 日期字段的时区，例如 +08:00
+func (q *RangeQuery) TimeZone(timeZone string) *RangeQuery {
+	q.params["time_zone"] = timeZone
+	return q
+}
+
+// Boost 调节该条件的得分权重
+func (q *RangeQuery) Boost(boost float64) *RangeQuery {
+	q.params["boost"] = boost
+	return q
+}
+
+// Map 实现 Query 接口
+func (q *RangeQuery) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			q.field: q.params,
+		},
+	}
+}
+
+// BoolQuery 用 must(and)、should(or)、filter、must_not 组合多个条件
+type BoolQuery struct {
+	must               []Query
+	should             []Query
+	filter             []Query
+	mustNot            []Query
+	minimumShouldMatch interface{}
+	boost              *float64
+}
+
+// Bool 创建 bool 查询
+func Bool() *BoolQuery {
+	return &BoolQuery{}
+}
+
+// Must and 条件，参与算分
+func (q *BoolQuery) Must(queries ...Query) *BoolQuery {
+	q.must = append(q.must, queries...)
+	return q
+}
+
+// Should or 条件
+func (q *BoolQuery) Should(queries ...Query) *BoolQuery {
+	q.should = append(q.should, queries...)
+	return q
+}
+
+// Filter and 条件，不参与算分
+func (q *BoolQuery) Filter(queries ...Query) *BoolQuery {
+	q.filter = append(q.filter, queries...)
+	return q
+}
+
+// MustNot 排除条件
+func (q *BoolQuery) MustNot(queries ...Query) *BoolQuery {
+	q.mustNot = append(q.mustNot, queries...)
+	return q
+}
+
+// MinimumShouldMatch 保证至少满足 n 个 should 条件，也可以传 "75%" 这样的字符串
+func (q *BoolQuery) MinimumShouldMatch(minimum interface{}) *BoolQuery {
+	q.minimumShouldMatch = minimum
+	return q
+}
+
+// Boost 调节该条件的得分权重
+func (q *BoolQuery) Boost(boost float64) *BoolQuery {
+	q.boost = &boost
+	return q
+}
+
+// Validate 校验所有子句，子句不能为 nil
+func (q *BoolQuery) Validate() error {
+	for _, clauses := range [][]Query{q.must, q.should, q.filter, q.mustNot} {
+		for _, clause := range clauses {
+			if clause == nil {
+				return fmt.Errorf("bool query clause can not be nil")
+			}
+			if err := validateQuery(clause); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Map 实现 Query 接口
+func (q *BoolQuery) Map() map[string]interface{} {
+	params := map[string]interface{}{}
+	if len(q.must) > 0 {
+		params["must"] = queryMaps(q.must)
+	}
+	if len(q.should) > 0 {
+		params["should"] = queryMaps(q.should)
+	}
+	if len(q.filter) > 0 {
+		params["filter"] = queryMaps(q.filter)
+	}
+	if len(q.mustNot) > 0 {
+		params["must_not"] = queryMaps(q.mustNot)
+	}
+	if q.minimumShouldMatch != nil {
+		params["minimum_should_match"] = q.minimumShouldMatch
+	}
+	if q.boost != nil {
+		params["boost"] = *q.boost
+	}
+	return map[string]interface{}{
+		"bool": params,
+	}
+}
+
+// NestedQuery 文档中存在对象数组时，根据对象的字段查找，字段需要映射为 nested 类型
+type NestedQuery struct {
+	path      string
+	query     Query
+	scoreMode string
+}
+
+// Nested 创建 nested 查询，query 中的字段需要带上 path 前缀
+func Nested(path string, query Query) *NestedQuery {
+	return &NestedQuery{path: path, query: query}
+}
+
+// ScoreMode 子文档得分的合并方式，avg、max、min、sum、none
+func (q *NestedQuery) ScoreMode(scoreMode string) *NestedQuery {
+	q.scoreMode = scoreMode
+	return q
+}
+
+// Validate 校验子查询，子查询不能为 nil
+func (q *NestedQuery) Validate() error {
+	if q.query == nil {
+		return fmt.Errorf("nested query %s requires a query", q.path)
+	}
+	return validateQuery(q.query)
+}
+
+// Map 实现 Query 接口
+func (q *NestedQuery) Map() map[string]interface{} {
+	params := map[string]interface{}{
+		"path": q.path,
+	}
+	// query 为 nil 时不生成 query，Build 会在发送前报错，直接使用 Map 时 es 也会返回缺少 query 的错误
+	if q.query != nil {
+		params["query"] = q.query.Map()
+	}
+	if q.scoreMode != "" {
+		params["score_mode"] = q.scoreMode
+	}
+	return map[string]interface{}{
+		"nested": params,
+	}
+}
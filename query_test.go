@@ -0,0 +1,153 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// assertGoldenJSON 比较生成的请求体和期望的 json，忽略 key 的顺序和空白
+func assertGoldenJSON(t *testing.T, name string, got map[string]interface{}, err error, want string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(data, &gotValue); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("%s: invalid golden json: %v", name, err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Fatalf("%s = %s\nwant %s", name, data, want)
+	}
+}
+
+func TestQueryBuildersGoldenJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		want  string
+	}{
+		{name: "match_all", query: MatchAll(), want: `{"match_all": {}}`},
+		{name: "match", query: Match("ik.title", "关键词"), want: `{"match": {"ik.title": "关键词"}}`},
+		{
+			name:  "match with params",
+			query: Match("ik.title", "关键词").Operator("and").Boost(2),
+			want:  `{"match": {"ik.title": {"query": "关键词", "operator": "and", "boost": 2}}}`,
+		},
+		{name: "match_phrase", query: MatchPhrase("entity_id", "123"), want: `{"match_phrase": {"entity_id": {"query": "123"}}}`},
+		{
+			name:  "match_phrase with params",
+			query: MatchPhrase("ik.title", "关键 词").Slop(2).Boost(3),
+			want:  `{"match_phrase": {"ik.title": {"query": "关键 词", "slop": 2, "boost": 3}}}`,
+		},
+		{name: "term", query: Term("entity_type", 1), want: `{"term": {"entity_type": 1}}`},
+		{name: "term with boost", query: Term("entity_id", "123").Boost(1.5), want: `{"term": {"entity_id": {"value": "123", "boost": 1.5}}}`},
+		{name: "terms", query: Terms("entity_type", 1, 2, 3), want: `{"terms": {"entity_type": [1, 2, 3]}}`},
+		{
+			name:  "range",
+			query: Range("publish_time").Gte("2020-01-02 00:00:00").Lt("2020-01-03 00:00:00").Format("yyyy-MM-dd HH:mm:ss").TimeZone("+08:00"),
+			want: `{"range": {"publish_time": {"gte": "2020-01-02 00:00:00", "lt": "2020-01-03 00:00:00",
+				"format": "yyyy-MM-dd HH:mm:ss", "time_zone": "+08:00"}}}`,
+		},
+		{name: "range gt lte boost", query: Range("score").Gt(1).Lte(10).Boost(2), want: `{"range": {"score": {"gt": 1, "lte": 10, "boost": 2}}}`},
+		{name: "empty bool", query: Bool(), want: `{"bool": {}}`},
+		{
+			name: "bool",
+			query: Bool().
+				Must(Match("ik.title", "关键词")).
+				Should(Term("entity_type", 1), Term("entity_type", 2)).
+				Filter(Range("publish_time").Gte("now-7d")).
+				MustNot(Term("deleted", true)).
+				MinimumShouldMatch("50%").
+				Boost(2),
+			want: `{"bool": {
+				"must": [{"match": {"ik.title": "关键词"}}],
+				"should": [{"term": {"entity_type": 1}}, {"term": {"entity_type": 2}}],
+				"filter": [{"range": {"publish_time": {"gte": "now-7d"}}}],
+				"must_not": [{"term": {"deleted": true}}],
+				"minimum_should_match": "50%",
+				"boost": 2}}`,
+		},
+		{
+			name:  "nested",
+			query: Nested("related_entities", Term("related_entities.entity_id", "123")).ScoreMode("max"),
+			want: `{"nested": {"path": "related_entities", "score_mode": "max",
+				"query": {"term": {"related_entities.entity_id": "123"}}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertGoldenJSON(t, tt.name, tt.query.Map(), nil, tt.want)
+			body, err := NewSearchBody().Query(tt.query).Build()
+			assertGoldenJSON(t, tt.name, body, err, `{"query": `+tt.want+`}`)
+		})
+	}
+}
+
+func TestSearchBodyGoldenJSON(t *testing.T) {
+	assertGoldenJSON(t, "empty", NewSearchBody().Map(), nil, `{}`)
+
+	body, err := NewSearchBody().
+		Query(MatchAll()).
+		From(20).
+		Size(10).
+		Sort("publish_time", "desc").
+		Sort("_score", "desc").
+		Build()
+	assertGoldenJSON(t, "search body", body, err, `{
+		"query": {"match_all": {}},
+		"from": 20,
+		"size": 10,
+		"sort": [{"publish_time": {"order": "desc"}}, {"_score": {"order": "desc"}}]}`)
+}
+
+func TestNilInnerQueries(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		// Map 的结果，nil 子句不会被悄悄去掉
+		want string
+		err  string
+	}{
+		{
+			name:  "nil must clause",
+			query: Bool().Must(Match("entity_id", "123"), nil),
+			want:  `{"bool": {"must": [{"match": {"entity_id": "123"}}, null]}}`,
+			err:   "bool query clause can not be nil",
+		},
+		{
+			name:  "nil should clause",
+			query: Bool().Should(nil),
+			want:  `{"bool": {"should": [null]}}`,
+			err:   "bool query clause can not be nil",
+		},
+		{
+			name:  "nil clause in nested bool",
+			query: Nested("related_entities", Bool().Filter(nil)),
+			want:  `{"nested": {"path": "related_entities", "query": {"bool": {"filter": [null]}}}}`,
+			err:   "bool query clause can not be nil",
+		},
+		{
+			name:  "nested without query",
+			query: Nested("related_entities", nil),
+			want:  `{"nested": {"path": "related_entities"}}`,
+			err:   "nested query related_entities requires a query",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertGoldenJSON(t, tt.name, tt.query.Map(), nil, tt.want)
+			if _, err := NewSearchBody().Query(tt.query).Build(); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Build err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
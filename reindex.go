@@ -0,0 +1,257 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/pkg/errors"
+)
+
+// ================================ 通过别名无停机重建索引 ================================
+
+// 带版本号的索引名，例如 zeus_v3
+var versionedIndexPattern = regexp.MustCompile(`^(.+)_v(\d+)$`)
+
+// ReindexConfig 重建索引的配置
+type ReindexConfig struct {
+	// 读写别名，调用方只通过别名访问索引
+	Alias string
+	// 新索引名，为空时根据旧索引名生成下一个版本，例如 zeus_v2 -> zeus_v3、zeus -> zeus_v2
+	NewIndex string
+	// 新索引的 settings、mappings，和创建索引的请求体一样，不要包含 aliases
+	IndexBody map[string]interface{}
+	// 只迁移匹配的文档，为空时迁移全部
+	Query Query
+	// 迁移时对每条文档执行的脚本，例如 NewScript("ctx._source.remove(params.field)").Param("field", "old_field")
+	Script *Script
+	// 并行的 slice 数量，小于等于 0 时由 es 自动决定
+	Slices int
+	// 查询任务进度的间隔，默认 2 秒
+	PollInterval time.Duration
+	// 每次查询任务进度后回调
+	OnProgress func(status TaskStatus)
+	// 切换别名后删除旧索引
+	DeleteOldIndex bool
+}
+
+// ReindexResult 重建索引的结果
+type ReindexResult struct {
+	OldIndex string
+	NewIndex string
+	TaskID   string
+	Status   TaskStatus
+	// 新索引的文档数
+	Count int64
+	// 旧索引已经删除
+	OldIndexDeleted bool
+}
+
+// ReindexWithAlias 创建新版本的索引并迁移数据，校验文档数后原子切换别名：
+// 创建新索引 -> reindex 任务 -> 轮询进度 -> 校验文档数 -> 切换别名 -> 删除旧索引（可选）。
+// 切换别名之前失败会删除新索引，别名始终指向旧索引；切换别名失败时会把别名恢复到旧索引。
+// 迁移期间写入旧索引的数据不会同步到新索引，需要在迁移期间暂停写入
+func ReindexWithAlias(ctx context.Context, client *elasticsearch.Client, config ReindexConfig) (*ReindexResult, error) {
+	if config.Alias == "" {
+		return nil, fmt.Errorf("alias can not be empty")
+	}
+	if config.Query != nil {
+		if err := validateQuery(config.Query); err != nil {
+			return nil, errors.Wrap(err, "reindex query")
+		}
+	}
+	if config.Script != nil {
+		if err := config.Script.Validate(); err != nil {
+			return nil, errors.Wrap(err, "reindex script")
+		}
+	}
+	oldIndices, err := getAliasIndices(ctx, client, config.Alias)
+	if IsNotFound(err) {
+		return nil, errors.Wrapf(err, "%s is not an alias, the index must be created as a versioned index (e.g. %s_v1) behind the alias", config.Alias, config.Alias)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get indices of alias %s", config.Alias)
+	}
+	if len(oldIndices) != 1 {
+		return nil, fmt.Errorf("alias %s must point to exactly one index, got %v", config.Alias, oldIndices)
+	}
+	result := &ReindexResult{OldIndex: oldIndices[0], NewIndex: config.NewIndex}
+	if result.NewIndex == "" {
+		result.NewIndex = nextIndexVersion(result.OldIndex)
+	}
+	if result.NewIndex == result.OldIndex {
+		return nil, fmt.Errorf("new index can not be the same as the old index %s", result.OldIndex)
+	}
+
+	if err := createIndex(ctx, client, result.NewIndex, config.IndexBody); err != nil {
+		return nil, errors.Wrapf(err, "create index %s", result.NewIndex)
+	}
+	// 切换别名之前的失败都要删除新索引，使用新的 ctx 避免 ctx 已经结束时无法清理
+	cleanup := func(cause error) (*ReindexResult, error) {
+		if err := deleteIndex(context.Background(), client, result.NewIndex); err != nil {
+			return result, errors.Wrapf(cause, "delete index %s failed: %s", result.NewIndex, err)
+		}
+		return result, cause
+	}
+
+	result.TaskID, err = startReindex(ctx, client, result.OldIndex, result.NewIndex, config)
+	if err != nil {
+		return cleanup(errors.Wrap(err, "start reindex"))
+	}
+	info, err := WaitForTask(ctx, client, result.TaskID, config.PollInterval, config.OnProgress)
+	if err != nil {
+		// 不再等待时取消任务，否则任务会继续往即将删除的新索引写数据
+		if cancelErr := CancelTask(context.Background(), client, result.TaskID); cancelErr != nil && !IsNotFound(cancelErr) {
+			err = errors.Wrapf(err, "cancel reindex task %s failed: %s", result.TaskID, cancelErr)
+		}
+		return cleanup(errors.Wrapf(err, "wait for reindex task %s", result.TaskID))
+	}
+	result.Status = info.Status
+	if err := info.Err(); err != nil {
+		return cleanup(err)
+	}
+
+	if err := refreshIndex(ctx, client, result.NewIndex); err != nil {
+		return cleanup(errors.Wrapf(err, "refresh index %s", result.NewIndex))
+	}
+	expected, err := countDocuments(ctx, client, result.OldIndex, config.Query)
+	if err != nil {
+		return cleanup(errors.Wrapf(err, "count index %s", result.OldIndex))
+	}
+	// 脚本中 ctx.op = 'noop' 跳过的文档不会写入新索引
+	expected -= info.Status.Noops
+	result.Count, err = countDocuments(ctx, client, result.NewIndex, nil)
+	if err != nil {
+		return cleanup(errors.Wrapf(err, "count index %s", result.NewIndex))
+	}
+	if result.Count != expected {
+		return cleanup(fmt.Errorf("document count mismatch: %s has %d, %s expected %d", result.NewIndex, result.Count, result.OldIndex, expected))
+	}
+
+	if err := swapAlias(ctx, client, config.Alias, result.OldIndex, result.NewIndex); err != nil {
+		// 请求超时等情况下别名可能已经切换，统一恢复到旧索引；恢复失败时别名可能还指向新索引，不能删除新索引
+		if rollbackErr := restoreAlias(context.Background(), client, config.Alias, result.OldIndex, result.NewIndex); rollbackErr != nil {
+			return result, errors.Wrapf(err, "swap alias %s, rollback to %s failed: %s", config.Alias, result.OldIndex, rollbackErr)
+		}
+		return cleanup(errors.Wrapf(err, "swap alias %s", config.Alias))
+	}
+
+	if config.DeleteOldIndex {
+		// 别名已经切换成功，删除旧索引失败不影响使用，只返回错误
+		if err := deleteIndex(ctx, client, result.OldIndex); err != nil {
+			return result, errors.Wrapf(err, "delete old index %s", result.OldIndex)
+		}
+		result.OldIndexDeleted = true
+	}
+	return result, nil
+}
+
+// nextIndexVersion 生成下一个版本的索引名
+func nextIndexVersion(index string) string {
+	if m := versionedIndexPattern.FindStringSubmatch(index); m != nil {
+		version, err := strconv.Atoi(m[2])
+		if err == nil {
+			return fmt.Sprintf("%s_v%d", m[1], version+1)
+		}
+	}
+	return index + "_v2"
+}
+
+// startReindex 以异步任务的方式开始 reindex，返回任务 id
+func startReindex(ctx context.Context, client *elasticsearch.Client, oldIndex, newIndex string, config ReindexConfig) (string, error) {
+	source := map[string]interface{}{"index": oldIndex}
+	if config.Query != nil {
+		source["query"] = config.Query.Map()
+	}
+	body := map[string]interface{}{
+		"source": source,
+		// 新索引中已经存在的文档不覆盖
+		"dest": map[string]interface{}{"index": newIndex, "op_type": "create"},
+	}
+	if config.Script != nil {
+		body["script"] = config.Script.Map()
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	var slices interface{} = "auto"
+	if config.Slices > 0 {
+		slices = config.Slices
+	}
+	res, err := client.Reindex(bytes.NewReader(data),
+		client.Reindex.WithContext(ctx),
+		client.Reindex.WithWaitForCompletion(false),
+		client.Reindex.WithSlices(slices),
+	)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	task, err := newTaskHandle(client, "reindex", res)
+	if err != nil {
+		return "", err
+	}
+	return task.ID, nil
+}
+
+// getAliasIndices 别名指向的索引
+func getAliasIndices(ctx context.Context, client *elasticsearch.Client, alias string) ([]string, error) {
+	res, err := client.Indices.GetAlias(
+		client.Indices.GetAlias.WithContext(ctx),
+		client.Indices.GetAlias.WithName(alias),
+	)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	r := map[string]json.RawMessage{}
+	if err := decodeResponse(res, &r); err != nil {
+		return nil, err
+	}
+	return sortedKeys(r), nil
+}
+
+// swapAlias 在一个请求中把别名从 from 移到 to，es 保证这些操作是原子的
+func swapAlias(ctx context.Context, client *elasticsearch.Client, alias, from, to string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"actions": []interface{}{
+			map[string]interface{}{"remove": map[string]interface{}{"index": from, "alias": alias}},
+			map[string]interface{}{"add": map[string]interface{}{"index": to, "alias": alias, "is_write_index": true}},
+		},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	res, err := client.Indices.UpdateAliases(bytes.NewReader(body),
+		client.Indices.UpdateAliases.WithContext(ctx),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeResponse(res, nil)
+}
+
+// restoreAlias 不管别名当前在 index 还是 other 上，都恢复到 index
+func restoreAlias(ctx context.Context, client *elasticsearch.Client, alias, index, other string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"actions": []interface{}{
+			map[string]interface{}{"remove": map[string]interface{}{"indices": []string{index, other}, "alias": alias}},
+			map[string]interface{}{"add": map[string]interface{}{"index": index, "alias": alias, "is_write_index": true}},
+		},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	res, err := client.Indices.UpdateAliases(bytes.NewReader(body),
+		client.Indices.UpdateAliases.WithContext(ctx),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeResponse(res, nil)
+}
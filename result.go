@@ -0,0 +1,181 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+)
+
+// ================================ es 查询返回结构 ================================
+
+// SearchResult es 查询返回结构，T 为 _source 的结构
+type SearchResult[T any] struct {
+	Took     int           `json:"took"`
+	TimedOut bool          `json:"timed_out"`
+	ScrollID string        `json:"_scroll_id,omitempty"`
+	PitID    string        `json:"pit_id,omitempty"`
+	Hits     SearchHits[T] `json:"hits"`
+	// 请求中带 aggs 时才有
+	Aggregations Aggregations `json:"aggregations,omitempty"`
+	// 请求中带 suggest 时才有，key 为建议名称
+	Suggest map[string][]SuggestEntry[T] `json:"suggest,omitempty"`
+}
+
+// SearchHits 命中的文档及总数
+type SearchHits[T any] struct {
+	Total    Total    `json:"total"`
+	MaxScore *float64 `json:"max_score"`
+	Hits     []Hit[T] `json:"hits"`
+}
+
+// Total 命中总数，relation 为 eq 时是精确值，为 gte 时是下限
+type Total struct {
+	Value    int64  `json:"value"`
+	Relation string `json:"relation"`
+}
+
+// Hit 单条命中的文档
+type Hit[T any] struct {
+	Index  string        `json:"_index"`
+	ID     string        `json:"_id"`
+	Score  float64       `json:"_score"`
+	Source T             `json:"_source"`
+	Sort   []interface{} `json:"sort,omitempty"`
+	// 请求中设置了 highlight 时才有，key 为字段名，value 为高亮片段
+	Highlights map[string][]string        `json:"highlight,omitempty"`
+	InnerHits  map[string]InnerHitsResult `json:"inner_hits,omitempty"`
+	// 请求中设置了 script_fields 时才有，脚本的结果总是数组
+	Fields map[string][]interface{} `json:"fields,omitempty"`
+}
+
+// InnerHitsResult nested 查询的 inner_hits，子文档结构不固定，按需再解析 _source
+type InnerHitsResult struct {
+	Hits SearchHits[json.RawMessage] `json:"hits"`
+}
+
+// Sources 取出所有命中文档的 _source
+func (r *SearchResult[T]) Sources() []T {
+	sources := make([]T, 0, len(r.Hits.Hits))
+	for _, hit := range r.Hits.Hits {
+		sources = append(sources, hit.Source)
+	}
+	return sources
+}
+
+// Search 执行 ES query 查询，直接将返回结果解析成 SearchResult[T]
+func Search[T any](ctx context.Context, esClient *elasticsearch.Client, index string, query map[string]interface{}) (*SearchResult[T], error) {
+	res, err := doSearch(ctx, esClient, index, query)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSearchResponse[T](res)
+}
+
+// SearchInto 执行 ES query 查询，把返回内容直接解析到 target，target 需要是指针
+func SearchInto(ctx context.Context, esClient *elasticsearch.Client, index string, query map[string]interface{}, target interface{}) error {
+	res, err := doSearch(ctx, esClient, index, query)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(res, target)
+}
+
+// SearchRaw 执行 ES query 查询，返回原始的 json，适合直接转发给调用方
+func SearchRaw(ctx context.Context, esClient *elasticsearch.Client, index string, query map[string]interface{}) (json.RawMessage, error) {
+	res, err := doSearch(ctx, esClient, index, query)
+	if err != nil {
+		return nil, err
+	}
+	var raw json.RawMessage
+	err = readResponse(res, func(data []byte) error {
+		raw = append(json.RawMessage(nil), data...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// doSearch 发送查询请求，返回内容不做格式化
+func doSearch(ctx context.Context, esClient *elasticsearch.Client, index string, query map[string]interface{}) (*esapi.Response, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(query); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	res, err := performWithRetry(ctx, DefaultRetryPolicy, func() (*esapi.Response, error) {
+		return esClient.Search(
+			esClient.Search.WithContext(ctx),
+			esClient.Search.WithIndex(index),
+			esClient.Search.WithBody(bytes.NewReader(buf.Bytes())),
+			esClient.Search.WithTrackTotalHits(true),
+		)
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res, nil
+}
+
+// decodeResponse 检查返回状态并把返回内容解析到 target，target 为 nil 时只检查状态，最后关闭 Body
+func decodeResponse(res *esapi.Response, target interface{}) error {
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.WithStack(newESError(res))
+	}
+	if target == nil {
+		return nil
+	}
+	return decodeBody(res.Body, target)
+}
+
+// readResponse 检查返回状态，用复用的缓冲区读取返回内容后交给 fn，最后关闭 Body
+func readResponse(res *esapi.Response, fn func(data []byte) error) error {
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.WithStack(newESError(res))
+	}
+	return readBody(res.Body, fn)
+}
+
+// 超过该大小的缓冲区不放回池中，避免偶尔一次很大的返回长期占用内存
+const maxPooledBufferSize = 16 * 1024 * 1024
+
+// 读取返回内容的缓冲区
+var responseBufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// readBody 用复用的缓冲区读取整个返回内容后调用 fn，避免每次都重新分配和扩容读缓冲区；
+// fn 返回后缓冲区会放回池中，fn 中不能保留 data，需要时复制出来
+func readBody(body io.Reader, fn func(data []byte) error) error {
+	buf := responseBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBufferSize {
+			responseBufferPool.Put(buf)
+		}
+	}()
+	if _, err := buf.ReadFrom(body); err != nil {
+		return errors.Wrap(err, "Error reading the response body")
+	}
+	return fn(buf.Bytes())
+}
+
+// decodeBody 读取并解析返回内容，解析出来的字符串和 json.RawMessage 都是复制出来的，不受缓冲区复用影响
+func decodeBody(body io.Reader, target interface{}) error {
+	return readBody(body, func(data []byte) error {
+		if err := json.Unmarshal(data, target); err != nil {
+			return errors.Wrap(err, "Error parsing the response body")
+		}
+		return nil
+	})
+}
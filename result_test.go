@@ -0,0 +1,246 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v7"
+)
+
+// fixtureTransport 每次都返回同一个 body 的 http.RoundTripper，onRequest 不为 nil 时可以检查请求
+type fixtureTransport struct {
+	status    int
+	body      []byte
+	onRequest func(req *http.Request, body []byte)
+}
+
+func (t *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		reqBody, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
+	if t.onRequest != nil {
+		t.onRequest(req, reqBody)
+	}
+	return &http.Response{
+		StatusCode: t.status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(t.body)),
+		Request:    req,
+	}, nil
+}
+
+// newFixtureClient 创建所有请求都返回 body 的客户端
+func newFixtureClient(tb testing.TB, status int, body []byte) *elasticsearch.Client {
+	return newTransportClient(tb, &fixtureTransport{status: status, body: body})
+}
+
+// newTransportClient 创建使用指定 transport 的客户端
+func newTransportClient(tb testing.TB, transport http.RoundTripper) *elasticsearch.Client {
+	tb.Helper()
+	client, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses:    []string{"http://localhost:9200"},
+		Transport:    transport,
+		DisableRetry: true,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return client
+}
+
+var (
+	searchFixtureOnce sync.Once
+	searchFixture     []byte
+)
+
+// searchFixture10k 10000 条命中的查询返回，和 es 的返回格式一致
+func searchFixture10k() []byte {
+	searchFixtureOnce.Do(func() {
+		var buf bytes.Buffer
+		buf.WriteString(`{"took":42,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},`)
+		buf.WriteString(`"hits":{"total":{"value":10000,"relation":"eq"},"max_score":1.0,"hits":[`)
+		for i := 0; i < 10000; i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(&buf, `{"_index":"zeus_v1","_type":"_doc","_id":"%d","_score":1.0,"_source":{"entity_id":"entity-%d","entity_type":%d,"related_entities":[{"entity_id":"related-%d-a","entity_type":1},{"entity_id":"related-%d-b","entity_type":2}]}}`, i, i, i%5, i, i)
+		}
+		buf.WriteString(`]}}`)
+		searchFixture = buf.Bytes()
+	})
+	return searchFixture
+}
+
+func BenchmarkSearch10k(b *testing.B) {
+	client := newFixtureClient(b, http.StatusOK, searchFixture10k())
+	query := NewSearchBody().Query(MatchAll()).Size(10000).Map()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(searchFixture10k())))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, err := Search[Source](context.Background(), client, "zeus", query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(result.Hits.Hits) != 10000 {
+			b.Fatalf("got %d hits", len(result.Hits.Hits))
+		}
+	}
+}
+
+func BenchmarkSearchInto10k(b *testing.B) {
+	client := newFixtureClient(b, http.StatusOK, searchFixture10k())
+	query := NewSearchBody().Query(MatchAll()).Size(10000).Map()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(searchFixture10k())))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var result struct {
+			Hits struct {
+				Hits []struct {
+					ID string `json:"_id"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := SearchInto(context.Background(), client, "zeus", query, &result); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSearchRaw10k(b *testing.B) {
+	client := newFixtureClient(b, http.StatusOK, searchFixture10k())
+	query := NewSearchBody().Query(MatchAll()).Size(10000).Map()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(searchFixture10k())))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		raw, err := SearchRaw(context.Background(), client, "zeus", query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !json.Valid(raw) {
+			b.Fatal("invalid json")
+		}
+	}
+}
+
+func BenchmarkPerformESQuery10k(b *testing.B) {
+	client := newFixtureClient(b, http.StatusOK, searchFixture10k())
+	query := NewSearchBody().Query(MatchAll()).Size(10000).Map()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(searchFixture10k())))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		body, err := performESQuery(client, "zeus", query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(body) != len(searchFixture10k()) {
+			b.Fatalf("got %d bytes", len(body))
+		}
+	}
+}
+
+// legacyPerformESQuery 改造前 performESQuery 的读取方式：每次用 256 字节的块读进 strings.Builder，作为基准对比
+func legacyPerformESQuery(client *elasticsearch.Client, index string, query map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(query); err != nil {
+		return "", err
+	}
+	res, err := client.Search(
+		client.Search.WithContext(context.Background()),
+		client.Search.WithIndex(index),
+		client.Search.WithBody(&buf),
+		client.Search.WithTrackTotalHits(true),
+	)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	var sb strings.Builder
+	buffer := make([]byte, 256)
+	for {
+		n, err := res.Body.Read(buffer)
+		sb.Write(buffer[:n])
+		if err != nil {
+			break
+		}
+	}
+	return sb.String(), nil
+}
+
+func BenchmarkPerformESQueryLegacy10k(b *testing.B) {
+	client := newFixtureClient(b, http.StatusOK, searchFixture10k())
+	query := NewSearchBody().Query(MatchAll()).Size(10000).Map()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(searchFixture10k())))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		body, err := legacyPerformESQuery(client, "zeus", query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(body) != len(searchFixture10k()) {
+			b.Fatalf("got %d bytes", len(body))
+		}
+	}
+}
+
+func TestPerformESQueryReturnsBody(t *testing.T) {
+	client := newFixtureClient(t, http.StatusOK, searchFixture10k())
+	body, err := performESQuery(client, "zeus", NewSearchBody().Query(MatchAll()).Map())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != string(searchFixture10k()) {
+		t.Fatal("performESQuery body differs from the response")
+	}
+	raw, err := SearchRaw(context.Background(), client, "zeus", NewSearchBody().Query(MatchAll()).Map())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 返回的 raw 不能和复用的缓冲区共享内存
+	if _, err := performESQuery(client, "zeus", NewSearchBody().Query(MatchAll()).Map()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, searchFixture10k()) {
+		t.Fatal("SearchRaw result was overwritten by a later request")
+	}
+}
+
+func TestSearchDecodesHits(t *testing.T) {
+	client := newFixtureClient(t, http.StatusOK, searchFixture10k())
+	result, err := Search[Source](context.Background(), client, "zeus", NewSearchBody().Query(MatchAll()).Map())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(result.Hits.Hits); got != 10000 {
+		t.Fatalf("hits = %d, want 10000", got)
+	}
+	if result.Hits.Total.Value != 10000 || result.Hits.Total.Relation != "eq" {
+		t.Fatalf("total = %+v", result.Hits.Total)
+	}
+	hit := result.Hits.Hits[9999]
+	if hit.ID != "9999" || hit.Source.EntityID != "entity-9999" || len(hit.Source.RelationEntities) != 2 {
+		t.Fatalf("last hit = %+v", hit)
+	}
+}
+
+func TestSearchReturnsESError(t *testing.T) {
+	body := []byte(`{"error":{"root_cause":[{"type":"index_not_found_exception","reason":"no such index [zeus]"}],"type":"index_not_found_exception","reason":"no such index [zeus]","index":"zeus"},"status":404}`)
+	client := newFixtureClient(t, http.StatusNotFound, body)
+	_, err := Search[Source](context.Background(), client, "zeus", NewSearchBody().Query(MatchAll()).Map())
+	if !IsNotFound(err) {
+		t.Fatalf("err = %v, want not found", err)
+	}
+}
@@ -0,0 +1,113 @@
+package elasticsearch
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+)
+
+// ================================ 失败重试 ================================
+
+// RetryPolicy 重试策略，按指数退避加随机抖动等待
+type RetryPolicy struct {
+	// 最多尝试次数，包括第一次，小于等于 1 时不重试
+	MaxAttempts int
+	// 第一次重试前的等待时间，之后每次翻倍
+	InitialBackoff time.Duration
+	// 等待时间上限
+	MaxBackoff time.Duration
+	// 随机抖动比例，0.2 表示在等待时间上下浮动 20%
+	Jitter float64
+	// 需要重试的状态码，对整个请求和 bulk 中的单条操作都生效
+	RetryOnStatus []int
+	// 每次重试等待之前调用，attempt 为已经失败的次数，err 为这次失败的原因，可以用来记录日志
+	OnRetry func(attempt int, backoff time.Duration, err error)
+}
+
+// DefaultRetryPolicy 默认重试策略，查询、滚动查询的第一页以及没有指定策略的批量操作都使用它；
+// 滚动查询的后续页不重试，见 continueScroll
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Jitter:         0.2,
+	RetryOnStatus:  []int{429, 502, 503, 504},
+}
+
+// Backoff 第 attempt 次失败后需要等待的时间，attempt 从 1 开始
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if p.Jitter > 0 && backoff > 0 {
+		delta := float64(backoff) * p.Jitter
+		backoff += time.Duration(delta*2*rand.Float64() - delta)
+	}
+	return backoff
+}
+
+// retryableStatus 状态码是否需要重试
+func (p RetryPolicy) retryableStatus(status int) bool {
+	for _, code := range p.RetryOnStatus {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// canRetry 第 attempt 次失败后是否还能继续重试
+func (p RetryPolicy) canRetry(ctx context.Context, attempt int) bool {
+	return attempt < p.MaxAttempts && ctx.Err() == nil
+}
+
+// wait 等待退避时间，ctx 结束时提前返回
+func (p RetryPolicy) wait(ctx context.Context, attempt int, cause error) error {
+	backoff := p.Backoff(attempt)
+	if p.OnRetry != nil {
+		p.OnRetry(attempt, backoff, cause)
+	}
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// performWithRetry 执行请求，传输错误或者返回可重试的状态码时按策略重试，
+// do 每次都要重新构造请求体
+func performWithRetry(ctx context.Context, policy RetryPolicy, do func() (*esapi.Response, error)) (*esapi.Response, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := do()
+		if err == nil && !policy.retryableStatus(res.StatusCode) {
+			return res, nil
+		}
+		if !policy.canRetry(ctx, attempt) {
+			return res, err
+		}
+		if res != nil {
+			if err == nil {
+				err = newESError(res)
+			}
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		if err := policy.wait(ctx, attempt, err); err != nil {
+			return nil, err
+		}
+	}
+}
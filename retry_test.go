@@ -0,0 +1,209 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+)
+
+// fastRetryPolicy 测试用的重试策略，不需要真的等待
+var fastRetryPolicy = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, RetryOnStatus: []int{429, 502, 503, 504}}
+
+func TestSendBulkRetriesOnlyRetryableItems(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts = map[string]int{}
+	)
+	recorder := &bulkRecorder{status: func(id string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[id]++
+		switch {
+		case id == "2" && attempts[id] == 1:
+			return http.StatusTooManyRequests
+		case id == "3":
+			return http.StatusBadRequest
+		}
+		return http.StatusCreated
+	}}
+	client := newTransportClient(t, recorder.transport(t))
+	items := testBulkItems(t)[:3]
+
+	var succeeded, failed []string
+	requests, err := sendBulk(context.Background(), client, "zeus", "false", false, items, fastRetryPolicy,
+		func(item *bulkItem, res BulkResponseItem, err error) {
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s:%d", res.ID, res.Status))
+				return
+			}
+			succeeded = append(succeeded, res.ID)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Fatalf("requests = %d, want 2", requests)
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if got := fmt.Sprint(recorder.requests[0].ids, recorder.requests[1].ids); got != "[1 2 3] [2]" {
+		t.Fatalf("sent ids = %s, want [1 2 3] [2]", got)
+	}
+	if fmt.Sprint(succeeded) != "[1 2]" || fmt.Sprint(failed) != "[3:400]" {
+		t.Fatalf("succeeded = %v, failed = %v", succeeded, failed)
+	}
+}
+
+func TestSendBulkGivesUpAfterMaxAttempts(t *testing.T) {
+	recorder := &bulkRecorder{status: func(id string) int { return http.StatusTooManyRequests }}
+	client := newTransportClient(t, recorder.transport(t))
+
+	var failed []string
+	requests, err := sendBulk(context.Background(), client, "zeus", "false", false, testBulkItems(t)[:1], fastRetryPolicy,
+		func(item *bulkItem, res BulkResponseItem, err error) {
+			if IsTooManyRequests(err) {
+				failed = append(failed, res.ID)
+			}
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != fastRetryPolicy.MaxAttempts || fmt.Sprint(failed) != "[1]" {
+		t.Fatalf("requests = %d, failed = %v", requests, failed)
+	}
+}
+
+func TestSendBulkStopsBackoffWhenContextCancelled(t *testing.T) {
+	recorder := &bulkRecorder{status: func(id string) int { return http.StatusTooManyRequests }}
+	client := newTransportClient(t, recorder.transport(t))
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour, RetryOnStatus: []int{429}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var failures int
+	requests, err := sendBulk(ctx, client, "zeus", "false", false, testBulkItems(t)[:2], policy,
+		func(item *bulkItem, res BulkResponseItem, err error) {
+			failures++
+		})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("sendBulk took %v after ctx was cancelled", elapsed)
+	}
+	if requests != 1 || failures != 2 {
+		t.Fatalf("requests = %d, failures = %d", requests, failures)
+	}
+}
+
+func TestPerformWithRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		want     int
+		requests int
+	}{
+		{name: "ok", statuses: []int{200}, want: 200, requests: 1},
+		{name: "retry 503", statuses: []int{503, 502, 200}, want: 200, requests: 3},
+		{name: "give up", statuses: []int{503, 503, 503, 200}, want: 503, requests: 3},
+		{name: "not retryable", statuses: []int{400, 200}, want: 400, requests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			res, err := performWithRetry(context.Background(), fastRetryPolicy, func() (*esapi.Response, error) {
+				status := tt.statuses[requests]
+				requests++
+				return &esapi.Response{StatusCode: status, Body: http.NoBody}, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.want || requests != tt.requests {
+				t.Fatalf("status = %d after %d requests, want %d after %d", res.StatusCode, requests, tt.want, tt.requests)
+			}
+		})
+	}
+}
+
+func TestPerformWithRetryStopsWhenContextCancelled(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour, RetryOnStatus: []int{503}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	requests := 0
+	_, err := performWithRetry(ctx, policy, func() (*esapi.Response, error) {
+		requests++
+		return &esapi.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second || requests != 1 {
+		t.Fatalf("stopped after %v and %d requests", elapsed, requests)
+	}
+}
+
+func TestScrollContinuationIsNotRetried(t *testing.T) {
+	var scrolls, clears int
+	client := newTransportClient(t, roundTripFunc(func(req *http.Request) (int, string) {
+		switch {
+		case req.URL.Path == "/zeus/_search":
+			return http.StatusOK, `{"_scroll_id":"scroll-1","hits":{"total":{"value":4,"relation":"eq"},"hits":[{"_id":"1","_source":{}}]}}`
+		case req.Method == http.MethodDelete && strings.HasPrefix(req.URL.Path, "/_search/scroll"):
+			clears++
+			return http.StatusOK, `{"succeeded":true,"num_freed":1}`
+		case req.URL.Path == "/_search/scroll":
+			// 网关超时，但 scroll 可能已经在服务端前进了一页
+			scrolls++
+			return http.StatusGatewayTimeout, `<html><body>504 Gateway Time-out</body></html>`
+		}
+		return http.StatusNotFound, `{"error":"unexpected request","status":404}`
+	}))
+
+	it := NewScrollIterator[Source](client, "zeus", NewSearchBody().Size(1).Map(), time.Minute)
+	pages := 0
+	for it.Next(context.Background()) {
+		pages++
+	}
+	if pages != 1 || scrolls != 1 {
+		t.Fatalf("pages = %d, scroll requests = %d, want 1 and 1", pages, scrolls)
+	}
+	var esErr *ESError
+	if !errors.As(it.Err(), &esErr) || esErr.Status != http.StatusGatewayTimeout {
+		t.Fatalf("err = %v, want 504", it.Err())
+	}
+	if clears != 1 {
+		t.Fatalf("clear scroll called %d times, want 1", clears)
+	}
+}
+
+func TestPerformWithRetryCallsOnRetry(t *testing.T) {
+	var causes []string
+	policy := fastRetryPolicy
+	policy.OnRetry = func(attempt int, backoff time.Duration, err error) {
+		causes = append(causes, fmt.Sprintf("%d:%v", attempt, IsTooManyRequests(err)))
+	}
+	statuses := []int{429, 429, 200}
+	requests := 0
+	_, err := performWithRetry(context.Background(), policy, func() (*esapi.Response, error) {
+		status := statuses[requests]
+		requests++
+		return &esapi.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(`{"error":{"type":"es_rejected_execution_exception","reason":"rejected"},"status":429}`))}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(causes) != "[1:true 2:true]" {
+		t.Fatalf("OnRetry calls = %v", causes)
+	}
+}
@@ -0,0 +1,233 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/pkg/errors"
+)
+
+// ================================ painless 脚本 ================================
+
+// Script 内联脚本或者存储脚本的引用，可以用在 function_score、update_by_query、
+// bulk 的 update 操作和 script_fields 中。变化的值放在 params 中，不要拼接到 source 里，
+// 否则每个不同的 source 都会重新编译，很快会触发编译次数限制
+//
+//	NewScript("ctx._source.views += params.n").Param("n", 1)
+//	StoredScriptRef("incr-views").Param("n", 1)
+type Script struct {
+	id     string
+	source string
+	lang   string
+	params map[string]interface{}
+}
+
+// NewScript 创建内联脚本，默认语言为 painless
+func NewScript(source string) *Script {
+	return &Script{source: source}
+}
+
+// StoredScriptRef 引用 PutStoredScript 保存的脚本
+func StoredScriptRef(id string) *Script {
+	return &Script{id: id}
+}
+
+// Lang 脚本语言，只对内联脚本有效，存储脚本的语言在保存时已经确定
+func (s *Script) Lang(lang string) *Script {
+	s.lang = lang
+	return s
+}
+
+// Param 设置一个脚本参数，脚本中用 params.name 读取
+func (s *Script) Param(name string, value interface{}) *Script {
+	if s.params == nil {
+		s.params = map[string]interface{}{}
+	}
+	s.params[name] = value
+	return s
+}
+
+// Params 批量设置脚本参数，会和已有的参数合并
+func (s *Script) Params(params map[string]interface{}) *Script {
+	for name, value := range params {
+		s.Param(name, value)
+	}
+	return s
+}
+
+// Validate 检查 source 和 id 必须且只能设置一个
+func (s *Script) Validate() error {
+	switch {
+	case s.source == "" && s.id == "":
+		return fmt.Errorf("script requires a source or a stored script id")
+	case s.source != "" && s.id != "":
+		return fmt.Errorf("script can not have both a source and a stored script id")
+	case s.id != "" && s.lang != "":
+		return fmt.Errorf("stored script %s can not set lang", s.id)
+	}
+	return nil
+}
+
+// Map 生成请求体中的 script
+func (s *Script) Map() map[string]interface{} {
+	script := map[string]interface{}{}
+	if s.id != "" {
+		script["id"] = s.id
+	} else {
+		script["source"] = s.source
+		if s.lang != "" {
+			script["lang"] = s.lang
+		}
+	}
+	if len(s.params) > 0 {
+		script["params"] = s.params
+	}
+	return script
+}
+
+// MarshalJSON 实现 json.Marshaler 接口，Script 可以直接放进任意请求体
+func (s *Script) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Map())
+}
+
+// StoredScript 保存在集群中的脚本
+type StoredScript struct {
+	ID   string `json:"-"`
+	Lang string `json:"lang"`
+	// 脚本内容，lang 为 mustache 时是搜索模板
+	Source string `json:"source"`
+}
+
+// PutStoredScript 创建或更新存储脚本，保存时会编译，语法错误直接返回 *ESError
+func PutStoredScript(ctx context.Context, client *elasticsearch.Client, script StoredScript) error {
+	if script.ID == "" {
+		return fmt.Errorf("stored script id can not be empty")
+	}
+	if script.Source == "" {
+		return fmt.Errorf("stored script %s requires a source", script.ID)
+	}
+	if script.Lang == "" {
+		script.Lang = "painless"
+	}
+	body, err := json.Marshal(map[string]interface{}{"script": script})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	res, err := client.PutScript(script.ID, bytes.NewReader(body),
+		client.PutScript.WithContext(ctx),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeResponse(res, nil)
+}
+
+// GetStoredScript 获取存储脚本，不存在时返回的错误满足 IsNotFound
+func GetStoredScript(ctx context.Context, client *elasticsearch.Client, id string) (*StoredScript, error) {
+	res, err := client.GetScript(id,
+		client.GetScript.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var r struct {
+		Found  bool          `json:"found"`
+		Script *StoredScript `json:"script"`
+	}
+	if err := decodeResponse(res, &r); err != nil {
+		return nil, err
+	}
+	if !r.Found || r.Script == nil {
+		return nil, &ESError{Status: 404, Type: "resource_not_found_exception", Reason: fmt.Sprintf("stored script [%s] not found", id)}
+	}
+	r.Script.ID = id
+	return r.Script, nil
+}
+
+// DeleteStoredScript 删除存储脚本，不存在时返回的错误满足 IsNotFound
+func DeleteStoredScript(ctx context.Context, client *elasticsearch.Client, id string) error {
+	res, err := client.DeleteScript(id,
+		client.DeleteScript.WithContext(ctx),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeResponse(res, nil)
+}
+
+// PainlessExecuteRequest 在集群上试运行脚本的参数，不会修改任何数据
+type PainlessExecuteRequest struct {
+	Script *Script
+	// painless_test（默认）、filter 或 score；filter 和 score 需要同时指定 Index 和 Document
+	Context string
+	Index   string
+	// 用来试运行的文档，脚本中用 doc['field'] 读取
+	Document interface{}
+	// score 上下文中计算 _score 用的查询
+	Query Query
+}
+
+// ExecutePainless 调用 _scripts/painless/_execute 试运行脚本，返回脚本的结果。
+// 编译或运行出错时返回 *ESError，可以用 IsScriptError 判断，ScriptStack 中有出错的位置
+func ExecutePainless(ctx context.Context, client *elasticsearch.Client, req PainlessExecuteRequest) (json.RawMessage, error) {
+	if req.Script == nil {
+		return nil, fmt.Errorf("painless execute requires a script")
+	}
+	if err := req.Script.Validate(); err != nil {
+		return nil, err
+	}
+	if req.Script.id != "" {
+		return nil, fmt.Errorf("painless execute only supports inline scripts, got stored script %s", req.Script.id)
+	}
+	if req.Query != nil {
+		if err := validateQuery(req.Query); err != nil {
+			return nil, errors.Wrap(err, "painless execute query")
+		}
+	}
+	body := map[string]interface{}{"script": req.Script}
+	if req.Context != "" {
+		body["context"] = req.Context
+	}
+	// context_setup 中只放设置了的字段，都没有设置时不发送 context_setup
+	setup := map[string]interface{}{}
+	if req.Index != "" {
+		setup["index"] = req.Index
+	}
+	if req.Document != nil {
+		setup["document"] = req.Document
+	}
+	if req.Query != nil {
+		setup["query"] = req.Query.Map()
+	}
+	if len(setup) > 0 {
+		body["context_setup"] = setup
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	res, err := client.ScriptsPainlessExecute(
+		client.ScriptsPainlessExecute.WithContext(ctx),
+		client.ScriptsPainlessExecute.WithBody(bytes.NewReader(data)),
+	)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var r struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := decodeResponse(res, &r); err != nil {
+		return nil, err
+	}
+	return r.Result, nil
+}
+
+// CheckPainless 在发送真正的请求之前检查脚本，脚本会在 painless_test 上下文中执行一次，
+// 编译错误和运行时错误都会返回。这个上下文中没有文档，用到 doc 的脚本需要用 ExecutePainless 并提供 Document
+func CheckPainless(ctx context.Context, client *elasticsearch.Client, script *Script) error {
+	_, err := ExecutePainless(ctx, client, PainlessExecuteRequest{Script: script})
+	return err
+}
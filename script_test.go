@@ -0,0 +1,75 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// executePainlessBody 调用 ExecutePainless 并返回发送的请求体
+func executePainlessBody(t *testing.T, req PainlessExecuteRequest) map[string]interface{} {
+	t.Helper()
+	var sent map[string]interface{}
+	client := newTransportClient(t, &fixtureTransport{
+		status: http.StatusOK,
+		body:   []byte(`{"result":"ok"}`),
+		onRequest: func(r *http.Request, body []byte) {
+			if err := json.Unmarshal(body, &sent); err != nil {
+				t.Fatalf("request body %s: %v", body, err)
+			}
+		},
+	})
+	result, err := ExecutePainless(context.Background(), client, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != `"ok"` {
+		t.Fatalf("result = %s", result)
+	}
+	return sent
+}
+
+func TestExecutePainlessOmitsEmptyContextSetup(t *testing.T) {
+	body := executePainlessBody(t, PainlessExecuteRequest{Script: NewScript("params.a * 2").Param("a", 1)})
+	if _, ok := body["context_setup"]; ok {
+		t.Fatalf("context_setup sent without index or document: %v", body)
+	}
+	if _, ok := body["context"]; ok {
+		t.Fatalf("context sent when empty: %v", body)
+	}
+}
+
+func TestExecutePainlessContextSetup(t *testing.T) {
+	body := executePainlessBody(t, PainlessExecuteRequest{
+		Script:   NewScript("doc['entity_type'].value > params.min").Param("min", 1),
+		Context:  "filter",
+		Index:    "zeus",
+		Document: map[string]interface{}{"entity_type": 2},
+	})
+	want := map[string]interface{}{
+		"index":    "zeus",
+		"document": map[string]interface{}{"entity_type": float64(2)},
+	}
+	if got := body["context_setup"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("context_setup = %v, want %v", got, want)
+	}
+	if body["context"] != "filter" {
+		t.Fatalf("context = %v", body["context"])
+	}
+
+	body = executePainlessBody(t, PainlessExecuteRequest{
+		Script:  NewScript("_score * 2"),
+		Context: "score",
+		Index:   "zeus",
+		Query:   Match("entity_id", "e1"),
+	})
+	setup := body["context_setup"].(map[string]interface{})
+	if _, ok := setup["document"]; ok {
+		t.Fatalf("document sent when nil: %v", setup)
+	}
+	if setup["index"] != "zeus" || setup["query"] == nil {
+		t.Fatalf("context_setup = %v", setup)
+	}
+}
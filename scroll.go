@@ -0,0 +1,184 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+)
+
+// ================================ 滚动查询 ================================
+
+// 滚动查询默认的 scroll 上下文保留时间
+const defaultScrollKeepAlive = time.Minute
+
+// ScrollIterator 滚动查询迭代器，负责维护 scrollID，结束时清理 scroll 上下文
+//
+//	query, err := NewSearchBody().Size(5000).Build()
+//	it := NewScrollIterator[Source](client, "indexName", query, time.Minute)
+//	defer it.Close()
+//	for it.Next(ctx) {
+//		for _, hit := range it.Hits() { ... }
+//	}
+//	if err := it.Err(); err != nil { ... }
+type ScrollIterator[T any] struct {
+	client    *elasticsearch.Client
+	index     string
+	query     map[string]interface{}
+	keepAlive time.Duration
+
+	scrollID string
+	hits     []Hit[T]
+	total    Total
+	err      error
+	started  bool
+	done     bool
+}
+
+// NewScrollIterator 创建滚动查询迭代器，query 可以是任意查询方法生成的请求体，
+// 其中的 size 即每页条数；keepAlive 小于等于 0 时使用 1 分钟
+func NewScrollIterator[T any](client *elasticsearch.Client, index string, query map[string]interface{}, keepAlive time.Duration) *ScrollIterator[T] {
+	if keepAlive <= 0 {
+		keepAlive = defaultScrollKeepAlive
+	}
+	return &ScrollIterator[T]{
+		client:    client,
+		index:     index,
+		query:     query,
+		keepAlive: keepAlive,
+	}
+}
+
+// Next 取下一页，没有数据或者出错时返回 false
+func (it *ScrollIterator[T]) Next(ctx context.Context) bool {
+	if it.done || it.err != nil {
+		return false
+	}
+
+	var result *SearchResult[T]
+	var err error
+	if !it.started {
+		it.started = true
+		result, err = startScroll[T](ctx, it.client, it.index, it.query, it.keepAlive)
+	} else {
+		result, err = continueScroll[T](ctx, it.client, it.scrollID, it.keepAlive)
+	}
+	if err != nil {
+		it.err = err
+		it.hits = nil
+		it.Close()
+		return false
+	}
+
+	if result.ScrollID != "" {
+		it.scrollID = result.ScrollID
+	}
+	it.total = result.Hits.Total
+	it.hits = result.Hits.Hits
+	if len(it.hits) == 0 {
+		it.Close()
+		return false
+	}
+	return true
+}
+
+// Hits 当前页的数据
+func (it *ScrollIterator[T]) Hits() []Hit[T] {
+	return it.hits
+}
+
+// Total 查询命中的总数
+func (it *ScrollIterator[T]) Total() Total {
+	return it.total
+}
+
+// Err 迭代过程中的错误
+func (it *ScrollIterator[T]) Err() error {
+	return it.err
+}
+
+// Close 结束迭代并清理 scroll 上下文，可以重复调用
+func (it *ScrollIterator[T]) Close() error {
+	it.done = true
+	if it.scrollID == "" {
+		return nil
+	}
+	scrollID := it.scrollID
+	it.scrollID = ""
+	return clearScroll(context.Background(), it.client, scrollID)
+}
+
+// startScroll 发起第一次滚动查询
+func startScroll[T any](ctx context.Context, esClient *elasticsearch.Client, index string, query map[string]interface{}, keepAlive time.Duration) (*SearchResult[T], error) {
+	var reqBody bytes.Buffer
+	if err := json.NewEncoder(&reqBody).Encode(query); err != nil {
+		return nil, errors.WithStack(fmt.Errorf("encode query failed, %v", err))
+	}
+	res, err := performWithRetry(ctx, DefaultRetryPolicy, func() (*esapi.Response, error) {
+		return esClient.Search(
+			esClient.Search.WithContext(ctx),
+			esClient.Search.WithIndex(index),
+			esClient.Search.WithBody(bytes.NewReader(reqBody.Bytes())),
+			esClient.Search.WithTrackTotalHits(true),
+			esClient.Search.WithTimeout(5*60*time.Second),
+			esClient.Search.WithScroll(keepAlive),
+		)
+	})
+	if err != nil {
+		return nil, errors.WithStack(fmt.Errorf("Error getting response: %s", err))
+	}
+	return decodeSearchResponse[T](res)
+}
+
+// continueScroll 根据 scrollID 查询下一页。
+// 不重试：第一次请求可能已经在服务端推进了 scroll 游标，只是返回丢了（例如网关返回 502/504），
+// 用同一个 scrollID 重发会拿到再下一页，中间那一页就被悄悄跳过了，所以出错时直接返回，由调用方重新开始
+func continueScroll[T any](ctx context.Context, esClient *elasticsearch.Client, scrollID string, keepAlive time.Duration) (*SearchResult[T], error) {
+	if scrollID == "" {
+		return nil, fmt.Errorf("scrollID can not be empty")
+	}
+	res, err := esClient.Scroll(
+		esClient.Scroll.WithContext(ctx),
+		esClient.Scroll.WithScrollID(scrollID),
+		esClient.Scroll.WithScroll(keepAlive),
+	)
+	if err != nil {
+		return nil, errors.WithStack(fmt.Errorf("Error getting response: %s", err))
+	}
+	return decodeSearchResponse[T](res)
+}
+
+// decodeSearchResponse 解析查询返回并关闭 Body
+func decodeSearchResponse[T any](res *esapi.Response) (*SearchResult[T], error) {
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, errors.WithStack(newESError(res))
+	}
+	result := new(SearchResult[T])
+	if err := decodeBody(res.Body, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// clearScroll 清理 scroll 上下文，避免在集群上一直占用到过期
+func clearScroll(ctx context.Context, esClient *elasticsearch.Client, scrollIDs ...string) error {
+	res, err := esClient.ClearScroll(
+		esClient.ClearScroll.WithContext(ctx),
+		esClient.ClearScroll.WithScrollID(scrollIDs...),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	// scroll 已经过期时返回 404，不算错误
+	if res.IsError() && res.StatusCode != 404 {
+		return errors.WithStack(newESError(res))
+	}
+	return nil
+}
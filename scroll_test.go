@@ -0,0 +1,161 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrollServer 模拟滚动查询，pages 为每一页的命中数，failAt 大于 0 时第 failAt 次翻页返回 500，
+// clearStatus 为清理 scroll 时返回的状态码
+type scrollServer struct {
+	pages       []int
+	failAt      int
+	clearStatus int
+
+	page    int
+	scrolls int
+	cleared []string
+}
+
+func (s *scrollServer) transport() roundTripFunc {
+	return func(req *http.Request) (int, string) {
+		switch {
+		case req.Method == http.MethodDelete && strings.HasPrefix(req.URL.Path, "/_search/scroll"):
+			s.cleared = append(s.cleared, strings.TrimPrefix(req.URL.Path, "/_search/scroll/"))
+			if s.clearStatus == http.StatusNotFound {
+				return http.StatusNotFound, `{"succeeded":true,"num_freed":0}`
+			}
+			return s.clearStatus, `{"succeeded":true,"num_freed":1}`
+		case strings.HasSuffix(req.URL.Path, "/_search"):
+			return http.StatusOK, s.nextPage()
+		case req.URL.Path == "/_search/scroll":
+			s.scrolls++
+			if s.scrolls == s.failAt {
+				return http.StatusInternalServerError, `{"error":{"type":"search_context_missing_exception","reason":"No search context found"},"status":500}`
+			}
+			return http.StatusOK, s.nextPage()
+		}
+		return http.StatusNotFound, `{"error":"unexpected request","status":404}`
+	}
+}
+
+// nextPage 每一页返回新的 scroll id
+func (s *scrollServer) nextPage() string {
+	var hits []string
+	if s.page < len(s.pages) {
+		for i := 0; i < s.pages[s.page]; i++ {
+			hits = append(hits, fmt.Sprintf(`{"_index":"zeus","_id":"%d-%d","_source":{"entity_id":"e"}}`, s.page, i))
+		}
+	}
+	s.page++
+	return fmt.Sprintf(`{"_scroll_id":"scroll-%d","hits":{"total":{"value":3,"relation":"eq"},"hits":[%s]}}`, s.page, strings.Join(hits, ","))
+}
+
+func newTestScroll(t *testing.T, server *scrollServer) *ScrollIterator[Source] {
+	if server.clearStatus == 0 {
+		server.clearStatus = http.StatusOK
+	}
+	client := newTransportClient(t, server.transport())
+	return NewScrollIterator[Source](client, "zeus", NewSearchBody().Size(2).Map(), time.Minute)
+}
+
+func TestScrollIteratorClearsScrollAtEnd(t *testing.T) {
+	server := &scrollServer{pages: []int{2, 1}}
+	it := newTestScroll(t, server)
+	var ids []string
+	for it.Next(context.Background()) {
+		for _, hit := range it.Hits() {
+			ids = append(ids, hit.ID)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[0-0 0-1 1-0]" || it.Total().Value != 3 {
+		t.Fatalf("ids = %v, total = %+v", ids, it.Total())
+	}
+	// 最后一次返回的 scroll id 被清理，之后的 Close 不再发请求
+	if fmt.Sprint(server.cleared) != "[scroll-3]" {
+		t.Fatalf("cleared = %v, want [scroll-3]", server.cleared)
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.cleared) != 1 {
+		t.Fatalf("Close cleared again: %v", server.cleared)
+	}
+}
+
+func TestScrollIteratorCloseEarly(t *testing.T) {
+	server := &scrollServer{pages: []int{2, 2, 2}}
+	it := newTestScroll(t, server)
+	if !it.Next(context.Background()) {
+		t.Fatal(it.Err())
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(server.cleared) != "[scroll-1]" {
+		t.Fatalf("cleared = %v, want [scroll-1]", server.cleared)
+	}
+	if it.Next(context.Background()) {
+		t.Fatal("Next returned true after Close")
+	}
+	if server.scrolls != 0 {
+		t.Fatalf("%d scroll requests after Close", server.scrolls)
+	}
+}
+
+func TestScrollIteratorClearsScrollOnError(t *testing.T) {
+	server := &scrollServer{pages: []int{2, 2, 2}, failAt: 2}
+	it := newTestScroll(t, server)
+	pages := 0
+	for it.Next(context.Background()) {
+		pages++
+	}
+	if pages != 2 {
+		t.Fatalf("pages = %d, want 2", pages)
+	}
+	if it.Err() == nil || it.Hits() != nil {
+		t.Fatalf("err = %v, hits = %v", it.Err(), it.Hits())
+	}
+	// 出错时清理的是出错之前最后一个有效的 scroll id
+	if fmt.Sprint(server.cleared) != "[scroll-2]" {
+		t.Fatalf("cleared = %v, want [scroll-2]", server.cleared)
+	}
+	if err := it.Close(); err != nil || len(server.cleared) != 1 {
+		t.Fatalf("Close = %v, cleared = %v", err, server.cleared)
+	}
+}
+
+func TestScrollIteratorIgnoresExpiredScroll(t *testing.T) {
+	server := &scrollServer{pages: []int{2, 2}, clearStatus: http.StatusNotFound}
+	it := newTestScroll(t, server)
+	if !it.Next(context.Background()) {
+		t.Fatal(it.Err())
+	}
+	if err := it.Close(); err != nil {
+		t.Fatalf("Close with expired scroll = %v", err)
+	}
+	if len(server.cleared) != 1 {
+		t.Fatalf("cleared = %v", server.cleared)
+	}
+}
+
+func TestScrollIteratorReportsClearError(t *testing.T) {
+	server := &scrollServer{pages: []int{2, 2}, clearStatus: http.StatusInternalServerError}
+	it := newTestScroll(t, server)
+	if !it.Next(context.Background()) {
+		t.Fatal(it.Err())
+	}
+	if err := it.Close(); err == nil {
+		t.Fatal("Close ignored a 500 from clear scroll")
+	}
+}
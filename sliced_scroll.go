@@ -0,0 +1,124 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7"
+)
+
+// ================================ 分片并行滚动查询 ================================
+
+// SlicedScrollConfig 分片并行滚动查询配置
+type SlicedScrollConfig struct {
+	// 分片数量，一般设置为索引的主分片数，小于等于 1 时不分片
+	Slices int
+	// scroll 上下文保留时间，默认 1 分钟
+	KeepAlive time.Duration
+	// 每读完一页回调一次进度
+	OnProgress func(progress SliceProgress)
+}
+
+// SliceProgress 单个分片的进度
+type SliceProgress struct {
+	Slice int
+	// 已读取的文档数
+	Read int64
+	// 该分片命中的总数
+	Total int64
+	Done  bool
+}
+
+// SlicedScrollError 各个分片的错误，key 为分片 id
+type SlicedScrollError struct {
+	Errors map[int]error
+}
+
+// Error 实现 error 接口
+func (e *SlicedScrollError) Error() string {
+	slices := make([]int, 0, len(e.Errors))
+	for slice := range e.Errors {
+		slices = append(slices, slice)
+	}
+	sort.Ints(slices)
+	msgs := make([]string, 0, len(slices))
+	for _, slice := range slices {
+		msgs = append(msgs, fmt.Sprintf("slice %d: %s", slice, e.Errors[slice]))
+	}
+	return fmt.Sprintf("%d slices of sliced scroll failed: %s", len(slices), strings.Join(msgs, "; "))
+}
+
+// SlicedScroll 把查询拆成多个 slice，每个 slice 在独立的 goroutine 中滚动查询。
+// handle 和 OnProgress 的调用是串行的，不需要自己加锁；handle 返回错误时该分片停止。
+// 所有分片结束后返回，每个分片的 scroll 都会被清理，出错的分片通过 *SlicedScrollError 返回
+func SlicedScroll[T any](ctx context.Context, client *elasticsearch.Client, index string, query map[string]interface{}, config SlicedScrollConfig, handle func(slice int, hits []Hit[T]) error) error {
+	slices := config.Slices
+	if slices < 1 {
+		slices = 1
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs = map[int]error{}
+	)
+	for i := 0; i < slices; i++ {
+		// 每个分片使用独立的请求体，避免并发修改同一个 map
+		sliceQuery := make(map[string]interface{}, len(query)+1)
+		for k, v := range query {
+			sliceQuery[k] = v
+		}
+		if slices > 1 {
+			sliceQuery["slice"] = map[string]interface{}{
+				"id":  i,
+				"max": slices,
+			}
+		}
+
+		wg.Add(1)
+		go func(slice int) {
+			defer wg.Done()
+			it := NewScrollIterator[T](client, index, sliceQuery, config.KeepAlive)
+			defer it.Close()
+
+			var read int64
+			for it.Next(ctx) {
+				hits := it.Hits()
+				read += int64(len(hits))
+
+				mu.Lock()
+				err := handle(slice, hits)
+				if config.OnProgress != nil {
+					config.OnProgress(SliceProgress{Slice: slice, Read: read, Total: it.Total().Value})
+				}
+				mu.Unlock()
+				if err != nil {
+					mu.Lock()
+					errs[slice] = err
+					mu.Unlock()
+					return
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err := it.Err(); err != nil {
+				errs[slice] = err
+				return
+			}
+			if config.OnProgress != nil {
+				config.OnProgress(SliceProgress{Slice: slice, Read: read, Total: it.Total().Value, Done: true})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &SlicedScrollError{Errors: errs}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// slicedScrollServer 模拟分片滚动查询，pages[slice] 为该分片每一页的命中数，
+// failSlice 分片的第一次翻页返回 500
+type slicedScrollServer struct {
+	pages     [][]int
+	failSlice int
+
+	mu      sync.Mutex
+	page    map[int]int
+	cleared []string
+}
+
+func newSlicedScrollServer(failSlice int, pages ...[]int) *slicedScrollServer {
+	return &slicedScrollServer{pages: pages, failSlice: failSlice, page: map[int]int{}}
+}
+
+func (s *slicedScrollServer) transport(t *testing.T) roundTripFunc {
+	return func(req *http.Request) (int, string) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch {
+		case req.Method == http.MethodDelete && strings.HasPrefix(req.URL.Path, "/_search/scroll/"):
+			s.cleared = append(s.cleared, strings.TrimPrefix(req.URL.Path, "/_search/scroll/"))
+			return http.StatusOK, `{"succeeded":true,"num_freed":1}`
+		case req.URL.Path == "/zeus/_search":
+			var body struct {
+				Slice *struct {
+					ID  int `json:"id"`
+					Max int `json:"max"`
+				} `json:"slice"`
+			}
+			data, _ := io.ReadAll(req.Body)
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Errorf("search body %s: %v", data, err)
+			}
+			slice := 0
+			if body.Slice != nil {
+				if body.Slice.Max != len(s.pages) {
+					t.Errorf("slice max = %d, want %d", body.Slice.Max, len(s.pages))
+				}
+				slice = body.Slice.ID
+			} else if len(s.pages) > 1 {
+				t.Errorf("search without slice")
+			}
+			return http.StatusOK, s.nextPage(slice)
+		case req.URL.Path == "/_search/scroll":
+			var slice int
+			fmt.Sscanf(req.URL.Query().Get("scroll_id"), "s%d-", &slice)
+			if slice == s.failSlice {
+				return http.StatusInternalServerError, `{"error":{"type":"search_context_missing_exception","reason":"No search context found"},"status":500}`
+			}
+			return http.StatusOK, s.nextPage(slice)
+		}
+		return http.StatusNotFound, `{"error":"unexpected request","status":404}`
+	}
+}
+
+// nextPage 分片的下一页，scroll id 为 s{分片}-{页码}
+func (s *slicedScrollServer) nextPage(slice int) string {
+	page := s.page[slice]
+	s.page[slice]++
+	var hits []string
+	if page < len(s.pages[slice]) {
+		for i := 0; i < s.pages[slice][page]; i++ {
+			hits = append(hits, fmt.Sprintf(`{"_index":"zeus","_id":"%d-%d-%d","_source":{}}`, slice, page, i))
+		}
+	}
+	total := 0
+	for _, n := range s.pages[slice] {
+		total += n
+	}
+	return fmt.Sprintf(`{"_scroll_id":"s%d-%d","hits":{"total":{"value":%d,"relation":"eq"},"hits":[%s]}}`, slice, page, total, strings.Join(hits, ","))
+}
+
+func (s *slicedScrollServer) clearedIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := append([]string(nil), s.cleared...)
+	sort.Strings(ids)
+	return ids
+}
+
+func TestSlicedScrollReadsAllSlices(t *testing.T) {
+	server := newSlicedScrollServer(-1, []int{2, 1}, []int{1}, []int{})
+	client := newTransportClient(t, server.transport(t))
+
+	read := map[int][]string{}
+	var progress []string
+	err := SlicedScroll[Source](context.Background(), client, "zeus", NewSearchBody().Size(2).Map(), SlicedScrollConfig{
+		Slices: 3,
+		OnProgress: func(p SliceProgress) {
+			progress = append(progress, fmt.Sprintf("%d:%d/%d:%v", p.Slice, p.Read, p.Total, p.Done))
+		},
+	}, func(slice int, hits []Hit[Source]) error {
+		for _, hit := range hits {
+			read[slice] = append(read[slice], hit.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(read[0], read[1], len(read[2])); got != "[0-0-0 0-0-1 0-1-0] [1-0-0] 0" {
+		t.Fatalf("read = %s", got)
+	}
+	sort.Strings(progress)
+	want := "[0:2/3:false 0:3/3:false 0:3/3:true 1:1/1:false 1:1/1:true 2:0/0:true]"
+	if fmt.Sprint(progress) != want {
+		t.Fatalf("progress = %v, want %s", progress, want)
+	}
+	// 每个分片最后一次返回的 scroll id 都被清理
+	if got := fmt.Sprint(server.clearedIDs()); got != "[s0-2 s1-1 s2-0]" {
+		t.Fatalf("cleared = %s", got)
+	}
+}
+
+func TestSlicedScrollReportsErrorsPerSlice(t *testing.T) {
+	server := newSlicedScrollServer(1, []int{1, 1}, []int{2, 2}, []int{1})
+	client := newTransportClient(t, server.transport(t))
+
+	var done []int
+	err := SlicedScroll[Source](context.Background(), client, "zeus", NewSearchBody().Size(2).Map(), SlicedScrollConfig{
+		Slices: 3,
+		OnProgress: func(p SliceProgress) {
+			if p.Done {
+				done = append(done, p.Slice)
+			}
+		},
+	}, func(slice int, hits []Hit[Source]) error { return nil })
+
+	var slicedErr *SlicedScrollError
+	if !errors.As(err, &slicedErr) {
+		t.Fatalf("err = %v, want *SlicedScrollError", err)
+	}
+	if len(slicedErr.Errors) != 1 || slicedErr.Errors[1] == nil {
+		t.Fatalf("errors = %v, want only slice 1", slicedErr.Errors)
+	}
+	if !strings.Contains(err.Error(), "slice 1: ") || !strings.Contains(err.Error(), "search_context_missing_exception") {
+		t.Fatalf("Error() = %q", err.Error())
+	}
+	sort.Ints(done)
+	if fmt.Sprint(done) != "[0 2]" {
+		t.Fatalf("done slices = %v, want [0 2]", done)
+	}
+	// 出错的分片也会清理 scroll
+	if got := fmt.Sprint(server.clearedIDs()); got != "[s0-2 s1-0 s2-1]" {
+		t.Fatalf("cleared = %s", got)
+	}
+}
+
+func TestSlicedScrollStopsSliceWhenHandleFails(t *testing.T) {
+	server := newSlicedScrollServer(-1, []int{1, 1, 1}, []int{1})
+	client := newTransportClient(t, server.transport(t))
+
+	stop := errors.New("stop")
+	err := SlicedScroll[Source](context.Background(), client, "zeus", NewSearchBody().Size(1).Map(), SlicedScrollConfig{Slices: 2},
+		func(slice int, hits []Hit[Source]) error {
+			if slice == 0 {
+				return stop
+			}
+			return nil
+		})
+	var slicedErr *SlicedScrollError
+	if !errors.As(err, &slicedErr) || slicedErr.Errors[0] != stop || len(slicedErr.Errors) != 1 {
+		t.Fatalf("err = %v", err)
+	}
+	if got := fmt.Sprint(server.clearedIDs()); got != "[s0-0 s1-1]" {
+		t.Fatalf("cleared = %s", got)
+	}
+}
+
+func TestSlicedScrollSingleSliceHasNoSliceParam(t *testing.T) {
+	server := newSlicedScrollServer(-1, []int{1})
+	client := newTransportClient(t, server.transport(t))
+	count := 0
+	err := SlicedScroll[Source](context.Background(), client, "zeus", NewSearchBody().Size(1).Map(), SlicedScrollConfig{},
+		func(slice int, hits []Hit[Source]) error {
+			count += len(hits)
+			return nil
+		})
+	if err != nil || count != 1 {
+		t.Fatalf("err = %v, count = %d", err, count)
+	}
+}
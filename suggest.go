@@ -0,0 +1,321 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+)
+
+// ================================ 搜索建议 ================================
+
+// Suggester term、phrase、completion 建议的公共接口，Map 返回 suggest 中单个建议的结构
+type Suggester interface {
+	Map() map[string]interface{}
+}
+
+// TermSuggester 按单个词给出拼写纠正，适合“你是不是要找”
+type TermSuggester struct {
+	text   string
+	field  string
+	params map[string]interface{}
+}
+
+// TermSuggest 创建 term 建议，text 为用户输入，field 为用来纠错的字段
+func TermSuggest(text, field string) *TermSuggester {
+	return &TermSuggester{text: text, field: field, params: map[string]interface{}{}}
+}
+
+// Size 每个词最多返回的建议数
+func (s *TermSuggester) Size(size int) *TermSuggester {
+	s.params["size"] = size
+	return s
+}
+
+// SuggestMode missing（默认，词不存在时才建议）、popular（只建议出现更多的词）或 always
+func (s *TermSuggester) SuggestMode(mode string) *TermSuggester {
+	s.params["suggest_mode"] = mode
+	return s
+}
+
+// MaxEdits 允许的最大编辑距离，1 或 2
+func (s *TermSuggester) MaxEdits(maxEdits int) *TermSuggester {
+	s.params["max_edits"] = maxEdits
+	return s
+}
+
+// PrefixLength 前几个字符必须相同，默认 1
+func (s *TermSuggester) PrefixLength(length int) *TermSuggester {
+	s.params["prefix_length"] = length
+	return s
+}
+
+// Map 实现 Suggester 接口
+func (s *TermSuggester) Map() map[string]interface{} {
+	params := map[string]interface{}{"field": s.field}
+	for k, v := range s.params {
+		params[k] = v
+	}
+	return map[string]interface{}{
+		"text": s.text,
+		"term": params,
+	}
+}
+
+// PhraseSuggester 对整个短语给出纠正，会考虑词与词之间的关系
+type PhraseSuggester struct {
+	text       string
+	field      string
+	params     map[string]interface{}
+	generators []map[string]interface{}
+}
+
+// PhraseSuggest 创建 phrase 建议，field 最好是带 shingle 分词的字段
+func PhraseSuggest(text, field string) *PhraseSuggester {
+	return &PhraseSuggester{text: text, field: field, params: map[string]interface{}{}}
+}
+
+// Size 最多返回的建议数
+func (s *PhraseSuggester) Size(size int) *PhraseSuggester {
+	s.params["size"] = size
+	return s
+}
+
+// GramSize 字段 shingle 的最大长度
+func (s *PhraseSuggester) GramSize(size int) *PhraseSuggester {
+	s.params["gram_size"] = size
+	return s
+}
+
+// Confidence 建议的得分要超过原始输入得分的多少倍才返回，默认 1.0
+func (s *PhraseSuggester) Confidence(confidence float64) *PhraseSuggester {
+	s.params["confidence"] = confidence
+	return s
+}
+
+// MaxErrors 最多允许有多少个词拼错，小于 1 时为比例
+func (s *PhraseSuggester) MaxErrors(maxErrors float64) *PhraseSuggester {
+	s.params["max_errors"] = maxErrors
+	return s
+}
+
+// Highlight 被纠正的词前后加上的标签，结果在 SuggestOption.Highlighted 中
+func (s *PhraseSuggester) Highlight(preTag, postTag string) *PhraseSuggester {
+	s.params["highlight"] = map[string]interface{}{
+		"pre_tag":  preTag,
+		"post_tag": postTag,
+	}
+	return s
+}
+
+// DirectGenerator 添加候选词生成器，suggestMode 和 TermSuggester 的一样
+func (s *PhraseSuggester) DirectGenerator(field, suggestMode string) *PhraseSuggester {
+	generator := map[string]interface{}{"field": field}
+	if suggestMode != "" {
+		generator["suggest_mode"] = suggestMode
+	}
+	s.generators = append(s.generators, generator)
+	return s
+}
+
+// Map 实现 Suggester 接口
+func (s *PhraseSuggester) Map() map[string]interface{} {
+	params := map[string]interface{}{"field": s.field}
+	for k, v := range s.params {
+		params[k] = v
+	}
+	if len(s.generators) > 0 {
+		params["direct_generator"] = s.generators
+	}
+	return map[string]interface{}{
+		"text":   s.text,
+		"phrase": params,
+	}
+}
+
+// CompletionSuggester 输入提示，根据前缀在 completion 类型的字段中查找
+type CompletionSuggester struct {
+	prefix   string
+	field    string
+	params   map[string]interface{}
+	contexts map[string][]interface{}
+}
+
+// CompletionSuggest 创建 completion 建议，field 需要映射为 completion 类型
+func CompletionSuggest(prefix, field string) *CompletionSuggester {
+	return &CompletionSuggester{prefix: prefix, field: field, params: map[string]interface{}{}, contexts: map[string][]interface{}{}}
+}
+
+// Size 最多返回的建议数，默认 5
+func (s *CompletionSuggester) Size(size int) *CompletionSuggester {
+	s.params["size"] = size
+	return s
+}
+
+// SkipDuplicates 去掉文本相同的建议
+func (s *CompletionSuggester) SkipDuplicates(skip bool) *CompletionSuggester {
+	s.params["skip_duplicates"] = skip
+	return s
+}
+
+// Fuzzy 允许前缀有拼写错误，fuzziness 为 0、1、2 或 "AUTO"，prefixLength 为前几个字符必须相同
+func (s *CompletionSuggester) Fuzzy(fuzziness interface{}, prefixLength int) *CompletionSuggester {
+	s.params["fuzzy"] = map[string]interface{}{
+		"fuzziness":     fuzziness,
+		"prefix_length": prefixLength,
+	}
+	return s
+}
+
+// Context 只返回 category 上下文为这些值之一的建议，name 为 mapping 中上下文的名称
+func (s *CompletionSuggester) Context(name string, values ...string) *CompletionSuggester {
+	for _, v := range values {
+		s.contexts[name] = append(s.contexts[name], v)
+	}
+	return s
+}
+
+// BoostContext 上下文为 value 的建议得分乘以 boost
+func (s *CompletionSuggester) BoostContext(name, value string, boost float64) *CompletionSuggester {
+	s.contexts[name] = append(s.contexts[name], map[string]interface{}{
+		"context": value,
+		"boost":   boost,
+	})
+	return s
+}
+
+// Map 实现 Suggester 接口
+func (s *CompletionSuggester) Map() map[string]interface{} {
+	params := map[string]interface{}{"field": s.field}
+	for k, v := range s.params {
+		params[k] = v
+	}
+	if len(s.contexts) > 0 {
+		params["contexts"] = s.contexts
+	}
+	return map[string]interface{}{
+		"prefix":     s.prefix,
+		"completion": params,
+	}
+}
+
+// CompletionContext completion 字段的上下文，Type 为 category 或 geo，
+// Path 为空时上下文的值需要写在 completion 字段里，否则从文档的 Path 字段读取
+type CompletionContext struct {
+	Name string
+	Type string
+	Path string
+	// geo 上下文的精度，例如 4 或者 "1km"
+	Precision interface{}
+}
+
+// CompletionField completion 字段的 mapping
+type CompletionField struct {
+	Analyzer       string
+	SearchAnalyzer string
+	Contexts       []CompletionContext
+	// 单个输入最多索引的字符数，默认 50
+	MaxInputLength int
+}
+
+// Map 生成字段的 mapping
+func (f CompletionField) Map() map[string]interface{} {
+	mapping := map[string]interface{}{"type": "completion"}
+	if f.Analyzer != "" {
+		mapping["analyzer"] = f.Analyzer
+	}
+	if f.SearchAnalyzer != "" {
+		mapping["search_analyzer"] = f.SearchAnalyzer
+	}
+	if f.MaxInputLength > 0 {
+		mapping["max_input_length"] = f.MaxInputLength
+	}
+	if len(f.Contexts) > 0 {
+		contexts := make([]map[string]interface{}, 0, len(f.Contexts))
+		for _, c := range f.Contexts {
+			context := map[string]interface{}{"name": c.Name, "type": c.Type}
+			if c.Path != "" {
+				context["path"] = c.Path
+			}
+			if c.Precision != nil {
+				context["precision"] = c.Precision
+			}
+			contexts = append(contexts, context)
+		}
+		mapping["contexts"] = contexts
+	}
+	return mapping
+}
+
+// CompletionProperties 生成 {"properties": {...}}，可以和 MappingFromStruct 的结果一起传给 MergeMappings
+func CompletionProperties(fields map[string]CompletionField) map[string]interface{} {
+	properties := make(map[string]interface{}, len(fields))
+	for name, field := range fields {
+		properties[name] = field.Map()
+	}
+	return map[string]interface{}{
+		"properties": properties,
+	}
+}
+
+// SuggestEntry 输入文本中的一段（term 建议为一个词）以及对应的建议
+type SuggestEntry[T any] struct {
+	Text    string             `json:"text"`
+	Offset  int                `json:"offset"`
+	Length  int                `json:"length"`
+	Options []SuggestOption[T] `json:"options"`
+}
+
+// SuggestOption 单条建议，completion 建议还会带上对应的文档
+type SuggestOption[T any] struct {
+	Text  string
+	Score float64
+	// term 建议中该词出现的文档数
+	Freq int64
+	// phrase 建议设置了 Highlight 时带标签的文本
+	Highlighted string
+	// completion 建议对应的文档
+	Index    string
+	ID       string
+	Source   *T
+	Contexts map[string][]string
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler 接口，completion 建议的得分字段是 _score，其他是 score
+func (o *SuggestOption[T]) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Text            string              `json:"text"`
+		Score           *float64            `json:"score"`
+		CompletionScore *float64            `json:"_score"`
+		Freq            int64               `json:"freq"`
+		Highlighted     string              `json:"highlighted"`
+		Index           string              `json:"_index"`
+		ID              string              `json:"_id"`
+		Source          *T                  `json:"_source"`
+		Contexts        map[string][]string `json:"contexts"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*o = SuggestOption[T]{
+		Text:        raw.Text,
+		Freq:        raw.Freq,
+		Highlighted: raw.Highlighted,
+		Index:       raw.Index,
+		ID:          raw.ID,
+		Source:      raw.Source,
+		Contexts:    raw.Contexts,
+	}
+	if raw.Score != nil {
+		o.Score = *raw.Score
+	} else if raw.CompletionScore != nil {
+		o.Score = *raw.CompletionScore
+	}
+	return nil
+}
+
+// Suggestions 取出指定建议的所有选项，按输入文本中的顺序
+func (r *SearchResult[T]) Suggestions(name string) []SuggestOption[T] {
+	options := make([]SuggestOption[T], 0)
+	for _, entry := range r.Suggest[name] {
+		options = append(options, entry.Options...)
+	}
+	return options
+}
@@ -0,0 +1,130 @@
+package elasticsearch
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestSuggestersGoldenJSON(t *testing.T) {
+	assertGoldenJSON(t, "term", TermSuggest("elasticsaerch", "ik.title").Map(), nil,
+		`{"text": "elasticsaerch", "term": {"field": "ik.title"}}`)
+	assertGoldenJSON(t, "term with params", TermSuggest("elasticsaerch", "ik.title").
+		Size(3).SuggestMode("popular").MaxEdits(2).PrefixLength(0).Map(), nil,
+		`{"text": "elasticsaerch", "term": {"field": "ik.title", "size": 3, "suggest_mode": "popular", "max_edits": 2, "prefix_length": 0}}`)
+
+	assertGoldenJSON(t, "phrase", PhraseSuggest("noble prize", "title.trigram").Map(), nil,
+		`{"text": "noble prize", "phrase": {"field": "title.trigram"}}`)
+	assertGoldenJSON(t, "phrase with params", PhraseSuggest("noble prize", "title.trigram").
+		Size(1).GramSize(3).Confidence(0.5).MaxErrors(2).
+		Highlight("<em>", "</em>").
+		DirectGenerator("title.trigram", "always").
+		DirectGenerator("title.reverse", "").Map(), nil,
+		`{"text": "noble prize", "phrase": {
+			"field": "title.trigram", "size": 1, "gram_size": 3, "confidence": 0.5, "max_errors": 2,
+			"highlight": {"pre_tag": "<em>", "post_tag": "</em>"},
+			"direct_generator": [{"field": "title.trigram", "suggest_mode": "always"}, {"field": "title.reverse"}]}}`)
+
+	assertGoldenJSON(t, "completion", CompletionSuggest("elas", "suggest").Map(), nil,
+		`{"prefix": "elas", "completion": {"field": "suggest"}}`)
+	assertGoldenJSON(t, "completion with params", CompletionSuggest("elas", "suggest").
+		Size(5).SkipDuplicates(true).Fuzzy("AUTO", 1).
+		Context("entity_type", "person", "company").
+		BoostContext("entity_type", "product", 2).Map(), nil,
+		`{"prefix": "elas", "completion": {
+			"field": "suggest", "size": 5, "skip_duplicates": true,
+			"fuzzy": {"fuzziness": "AUTO", "prefix_length": 1},
+			"contexts": {"entity_type": ["person", "company", {"context": "product", "boost": 2}]}}}`)
+}
+
+func TestSearchBodySuggest(t *testing.T) {
+	body, err := NewSearchBody().
+		Size(0).
+		Suggest("spelling", TermSuggest("elasticsaerch", "ik.title")).
+		Suggest("autocomplete", CompletionSuggest("elas", "suggest").Size(3)).
+		Build()
+	assertGoldenJSON(t, "search body", body, err, `{"size": 0, "suggest": {
+		"spelling": {"text": "elasticsaerch", "term": {"field": "ik.title"}},
+		"autocomplete": {"prefix": "elas", "completion": {"field": "suggest", "size": 3}}}}`)
+}
+
+func TestCompletionPropertiesGoldenJSON(t *testing.T) {
+	properties := CompletionProperties(map[string]CompletionField{
+		"suggest": {},
+		"title_suggest": {
+			Analyzer:       "ik_max_word",
+			SearchAnalyzer: "ik_smart",
+			MaxInputLength: 100,
+			Contexts: []CompletionContext{
+				{Name: "entity_type", Type: "category", Path: "entity_type"},
+				{Name: "location", Type: "geo", Precision: 4},
+			},
+		},
+	})
+	assertGoldenJSON(t, "completion properties", properties, nil, `{"properties": {
+		"suggest": {"type": "completion"},
+		"title_suggest": {"type": "completion", "analyzer": "ik_max_word", "search_analyzer": "ik_smart", "max_input_length": 100,
+			"contexts": [
+				{"name": "entity_type", "type": "category", "path": "entity_type"},
+				{"name": "location", "type": "geo", "precision": 4}]}}}`)
+}
+
+const suggestFixture = `{"took":3,"hits":{"total":{"value":0,"relation":"eq"},"hits":[]},"suggest":{
+	"spelling":[
+		{"text":"elasticsaerch","offset":0,"length":13,"options":[{"text":"elasticsearch","score":0.9,"freq":12}]},
+		{"text":"gude","offset":14,"length":4,"options":[{"text":"guide","score":0.75,"freq":3},{"text":"gude","score":0.5,"freq":1}]}],
+	"phrase":[
+		{"text":"noble prize","offset":0,"length":11,"options":[{"text":"nobel prize","highlighted":"<em>nobel</em> prize","score":0.48}]}],
+	"autocomplete":[
+		{"text":"elas","offset":0,"length":4,"options":[
+			{"text":"Elasticsearch","_index":"zeus","_type":"_doc","_id":"e1","_score":7,"_source":{"entity_id":"e1","entity_type":2},
+				"contexts":{"entity_type":["product"]}}]}],
+	"empty":[{"text":"zzz","offset":0,"length":3,"options":[]}]}}`
+
+func TestDecodeSuggestResults(t *testing.T) {
+	client := newFixtureClient(t, http.StatusOK, []byte(suggestFixture))
+	result, err := Search[Source](context.Background(), client, "zeus", NewSearchBody().Size(0).Map())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spelling := result.Suggest["spelling"]
+	if len(spelling) != 2 || spelling[1].Text != "gude" || spelling[1].Offset != 14 || spelling[1].Length != 4 {
+		t.Fatalf("spelling entries = %+v", spelling)
+	}
+	options := result.Suggestions("spelling")
+	if len(options) != 3 {
+		t.Fatalf("spelling options = %+v", options)
+	}
+	if o := options[0]; o.Text != "elasticsearch" || o.Score != 0.9 || o.Freq != 12 || o.Source != nil {
+		t.Fatalf("term option = %+v", o)
+	}
+	if options[1].Text != "guide" || options[2].Text != "gude" {
+		t.Fatalf("options are not in input order: %+v", options)
+	}
+
+	phrase := result.Suggestions("phrase")
+	if len(phrase) != 1 || phrase[0].Text != "nobel prize" || phrase[0].Highlighted != "<em>nobel</em> prize" || phrase[0].Score != 0.48 {
+		t.Fatalf("phrase options = %+v", phrase)
+	}
+
+	completion := result.Suggestions("autocomplete")
+	if len(completion) != 1 {
+		t.Fatalf("completion options = %+v", completion)
+	}
+	c := completion[0]
+	// completion 的得分在 _score 中
+	if c.Text != "Elasticsearch" || c.Score != 7 || c.Index != "zeus" || c.ID != "e1" {
+		t.Fatalf("completion option = %+v", c)
+	}
+	if c.Source == nil || c.Source.EntityID != "e1" || c.Source.EntityType != 2 || c.Contexts["entity_type"][0] != "product" {
+		t.Fatalf("completion source = %+v, contexts = %v", c.Source, c.Contexts)
+	}
+
+	if got := result.Suggestions("empty"); got == nil || len(got) != 0 {
+		t.Fatalf("empty suggestion = %#v", got)
+	}
+	if got := result.Suggestions("unknown"); got == nil || len(got) != 0 {
+		t.Fatalf("unknown suggestion = %#v", got)
+	}
+}
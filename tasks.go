@@ -0,0 +1,199 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+)
+
+// ================================ 后台任务 ================================
+
+// 没有指定时查询任务进度的间隔
+const defaultTaskPollInterval = 2 * time.Second
+
+// TaskStatus reindex、update_by_query、delete_by_query 等任务的进度
+type TaskStatus struct {
+	Total             int64   `json:"total"`
+	Created           int64   `json:"created"`
+	Updated           int64   `json:"updated"`
+	Deleted           int64   `json:"deleted"`
+	Batches           int64   `json:"batches"`
+	VersionConflicts  int64   `json:"version_conflicts"`
+	Noops             int64   `json:"noops"`
+	ThrottledMillis   int64   `json:"throttled_millis"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+}
+
+// TaskFailure 任务中单条文档或者单个分片的失败，写入失败时原因在 Cause 中，查询失败时在 Reason 中
+type TaskFailure struct {
+	Index  string     `json:"index"`
+	ID     string     `json:"id"`
+	Shard  int        `json:"shard"`
+	Status int        `json:"status"`
+	Cause  ErrorCause `json:"cause"`
+	Reason ErrorCause `json:"reason"`
+}
+
+// TaskInfo 任务的当前状态
+type TaskInfo struct {
+	ID        string
+	Action    string
+	Completed bool
+	Cancelled bool
+	Status    TaskStatus
+	// 任务结束后才有
+	Failures []TaskFailure
+	Error    *ErrorCause
+}
+
+// Err 任务失败时返回错误，包括任务本身的错误和部分文档的失败
+func (t *TaskInfo) Err() error {
+	if t.Error != nil {
+		return fmt.Errorf("task %s failed: %s: %s", t.ID, t.Error.Type, t.Error.Reason)
+	}
+	if len(t.Failures) > 0 {
+		f := t.Failures[0]
+		cause := f.Cause
+		if cause.Type == "" {
+			cause = f.Reason
+		}
+		return fmt.Errorf("task %s has %d failures, first: [%s/%s] %s: %s", t.ID, len(t.Failures), f.Index, f.ID, cause.Type, cause.Reason)
+	}
+	if t.Cancelled {
+		return fmt.Errorf("task %s was cancelled", t.ID)
+	}
+	return nil
+}
+
+// GetTask 查询任务状态，传输错误和 502、503 等可重试的状态码按 DefaultRetryPolicy 重试
+func GetTask(ctx context.Context, client *elasticsearch.Client, taskID string) (*TaskInfo, error) {
+	res, err := performWithRetry(ctx, DefaultRetryPolicy, func() (*esapi.Response, error) {
+		return client.Tasks.Get(taskID, client.Tasks.Get.WithContext(ctx))
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var r struct {
+		Completed bool `json:"completed"`
+		Task      struct {
+			Action    string     `json:"action"`
+			Cancelled bool       `json:"cancelled"`
+			Status    TaskStatus `json:"status"`
+		} `json:"task"`
+		Response *struct {
+			TaskStatus
+			Failures []TaskFailure `json:"failures"`
+		} `json:"response"`
+		Error *ErrorCause `json:"error"`
+	}
+	if err := decodeResponse(res, &r); err != nil {
+		return nil, err
+	}
+	info := &TaskInfo{
+		ID:        taskID,
+		Action:    r.Task.Action,
+		Completed: r.Completed,
+		Cancelled: r.Task.Cancelled,
+		Status:    r.Task.Status,
+		Error:     r.Error,
+	}
+	// 结束后以最终结果为准
+	if r.Response != nil {
+		info.Status = r.Response.TaskStatus
+		info.Failures = r.Response.Failures
+	}
+	return info, nil
+}
+
+// CancelTask 取消任务，已经处理的文档不会回滚
+func CancelTask(ctx context.Context, client *elasticsearch.Client, taskID string) error {
+	res, err := client.Tasks.Cancel(
+		client.Tasks.Cancel.WithContext(ctx),
+		client.Tasks.Cancel.WithTaskID(taskID),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeResponse(res, nil)
+}
+
+// WaitForTask 每隔 interval 查询一次任务进度直到结束，onProgress 可以为 nil；
+// 每次查询失败时先按 DefaultRetryPolicy 重试，重试用完才返回错误。
+// 返回错误时任务本身不会被取消，仍然在集群上运行，可以用任务 id 继续查询
+func WaitForTask(ctx context.Context, client *elasticsearch.Client, taskID string, interval time.Duration, onProgress func(TaskStatus)) (*TaskInfo, error) {
+	if interval <= 0 {
+		interval = defaultTaskPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		info, err := GetTask(ctx, client, taskID)
+		if err != nil {
+			return nil, err
+		}
+		if onProgress != nil {
+			onProgress(info.Status)
+		}
+		if info.Completed {
+			return info, nil
+		}
+		select {
+		case <-ctx.Done():
+			return info, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// TaskHandle 异步执行的 reindex、update_by_query、delete_by_query 任务，可以查询进度、调整速度或者取消
+type TaskHandle struct {
+	ID string
+	// reindex、update_by_query 或 delete_by_query，决定 Rethrottle 调用的接口
+	Action string
+	client *elasticsearch.Client
+}
+
+// Get 查询任务当前的进度，结束后 Status 为最终的 created、updated、deleted、version_conflicts 等计数
+func (t *TaskHandle) Get(ctx context.Context) (*TaskInfo, error) {
+	return GetTask(ctx, t.client, t.ID)
+}
+
+// Wait 等待任务结束，参数和 WaitForTask 一样；任务失败时 TaskInfo.Err 不为 nil
+func (t *TaskHandle) Wait(ctx context.Context, interval time.Duration, onProgress func(TaskStatus)) (*TaskInfo, error) {
+	return WaitForTask(ctx, t.client, t.ID, interval, onProgress)
+}
+
+// Cancel 取消任务，已经处理的文档不会回滚
+func (t *TaskHandle) Cancel(ctx context.Context) error {
+	return CancelTask(ctx, t.client, t.ID)
+}
+
+// Rethrottle 调整任务每秒处理的文档数，小于等于 0 时不限速；
+// 加速立即生效，减速要等当前这一批处理完才生效
+func (t *TaskHandle) Rethrottle(ctx context.Context, requestsPerSecond int) error {
+	if requestsPerSecond <= 0 {
+		requestsPerSecond = -1
+	}
+	var (
+		res *esapi.Response
+		err error
+	)
+	switch t.Action {
+	case "reindex":
+		res, err = t.client.ReindexRethrottle(t.ID, &requestsPerSecond, t.client.ReindexRethrottle.WithContext(ctx))
+	case "update_by_query":
+		res, err = t.client.UpdateByQueryRethrottle(t.ID, &requestsPerSecond, t.client.UpdateByQueryRethrottle.WithContext(ctx))
+	case "delete_by_query":
+		res, err = t.client.DeleteByQueryRethrottle(t.ID, &requestsPerSecond, t.client.DeleteByQueryRethrottle.WithContext(ctx))
+	default:
+		return fmt.Errorf("task %s with action %q can not be rethrottled", t.ID, t.Action)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeResponse(res, nil)
+}
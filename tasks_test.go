@@ -0,0 +1,109 @@
+package elasticsearch
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// taskTransport 模拟 update_by_query 任务，tasks 按顺序返回每次查询任务的结果，用完后重复最后一个
+type taskTransport struct {
+	mu        sync.Mutex
+	tasks     []func() (int, string)
+	polls     int
+	cancelled int
+}
+
+func (t *taskTransport) handle(req *http.Request) (int, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/_update_by_query"):
+		return http.StatusOK, `{"task":"node:1"}`
+	case req.URL.Path == "/_tasks/node:1/_cancel":
+		t.cancelled++
+		return http.StatusOK, `{"nodes":{}}`
+	case req.URL.Path == "/_tasks/node:1":
+		i := t.polls
+		if i >= len(t.tasks) {
+			i = len(t.tasks) - 1
+		}
+		t.polls++
+		return t.tasks[i]()
+	}
+	return http.StatusBadRequest, `{"error":"unexpected request","status":400}`
+}
+
+func runningTask() (int, string) {
+	return http.StatusOK, `{"completed":false,"task":{"action":"indices:data/write/update/byquery","status":{"total":10,"updated":3}}}`
+}
+
+func completedTask() (int, string) {
+	return http.StatusOK, `{"completed":true,"task":{"action":"indices:data/write/update/byquery","status":{"total":10,"updated":10}},
+		"response":{"total":10,"updated":9,"version_conflicts":1,"failures":[]}}`
+}
+
+func badGateway() (int, string) {
+	return http.StatusBadGateway, `<html>502 Bad Gateway</html>`
+}
+
+func TestGetTaskRetriesTransientErrors(t *testing.T) {
+	transport := &taskTransport{tasks: []func() (int, string){badGateway, completedTask}}
+	client := newTransportClient(t, roundTripFunc(transport.handle))
+
+	info, err := GetTask(context.Background(), client, "node:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Completed || info.Status.Updated != 9 || info.Status.VersionConflicts != 1 {
+		t.Fatalf("info = %+v", info)
+	}
+	if transport.polls != 2 {
+		t.Fatalf("polls = %d, want 2", transport.polls)
+	}
+}
+
+func TestWaitForTaskSurvivesTransientPollErrors(t *testing.T) {
+	transport := &taskTransport{tasks: []func() (int, string){runningTask, badGateway, completedTask}}
+	client := WrapClient(newTransportClient(t, roundTripFunc(transport.handle)), nil)
+	task, err := UpdateByQuery(context.Background(), client.Client, ByQueryConfig{Index: "zeus", Query: MatchAll(), Script: NewScript("ctx._source.n++")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := WaitForTask(context.Background(), client.Client, task.ID, time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Status.Updated != 9 || transport.cancelled != 0 {
+		t.Fatalf("updated = %d, cancelled = %d", info.Status.Updated, transport.cancelled)
+	}
+}
+
+func TestWaitByQueryTaskCancelsOnlyWhenContextEnds(t *testing.T) {
+	serverError := func() (int, string) {
+		return http.StatusInternalServerError, `{"error":{"type":"exception","reason":"boom"},"status":500}`
+	}
+	transport := &taskTransport{tasks: []func() (int, string){serverError}}
+	client := WrapClient(newTransportClient(t, roundTripFunc(transport.handle)), nil)
+	task := &TaskHandle{ID: "node:1", Action: "update_by_query", client: client.Client}
+
+	if _, err := waitByQueryTask(context.Background(), client, "zeus", task); err == nil {
+		t.Fatal("poll error was not returned")
+	}
+	if transport.cancelled != 0 {
+		t.Fatal("task was cancelled after a poll error")
+	}
+
+	transport.tasks = []func() (int, string){runningTask}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := waitByQueryTask(ctx, client, "zeus", task); err == nil {
+		t.Fatal("context error was not returned")
+	}
+	if transport.cancelled != 1 {
+		t.Fatalf("cancelled = %d after context ended, want 1", transport.cancelled)
+	}
+}
@@ -0,0 +1,296 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/pkg/errors"
+)
+
+// ================================ 索引模板 ================================
+
+// TemplateBody 模板中的 settings、mappings 和 aliases
+type TemplateBody struct {
+	Settings map[string]interface{} `json:"settings,omitempty"`
+	Mappings map[string]interface{} `json:"mappings,omitempty"`
+	Aliases  map[string]interface{} `json:"aliases,omitempty"`
+}
+
+// ComponentTemplate 组件模板，可以被多个索引模板组合使用
+type ComponentTemplate struct {
+	Name     string                 `json:"-"`
+	Template TemplateBody           `json:"template"`
+	Version  int64                  `json:"version,omitempty"`
+	Meta     map[string]interface{} `json:"_meta,omitempty"`
+}
+
+// IndexTemplate 可组合的索引模板，名称匹配 IndexPatterns 的新索引会自动使用
+type IndexTemplate struct {
+	Name          string   `json:"-"`
+	IndexPatterns []string `json:"index_patterns"`
+	// 按顺序合并的组件模板，后面的覆盖前面的，Template 最后合并
+	ComposedOf []string      `json:"composed_of,omitempty"`
+	Template   *TemplateBody `json:"template,omitempty"`
+	// 多个模板匹配同一个索引时使用优先级最高的
+	Priority int64                  `json:"priority,omitempty"`
+	Version  int64                  `json:"version,omitempty"`
+	Meta     map[string]interface{} `json:"_meta,omitempty"`
+}
+
+// PutComponentTemplate 创建或更新组件模板
+func PutComponentTemplate(ctx context.Context, client *elasticsearch.Client, template ComponentTemplate) error {
+	if template.Name == "" {
+		return fmt.Errorf("component template name can not be empty")
+	}
+	body, err := json.Marshal(template)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	res, err := client.Cluster.PutComponentTemplate(template.Name, bytes.NewReader(body),
+		client.Cluster.PutComponentTemplate.WithContext(ctx),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeResponse(res, nil)
+}
+
+// GetComponentTemplate 获取组件模板，不存在时返回的错误满足 IsNotFound
+func GetComponentTemplate(ctx context.Context, client *elasticsearch.Client, name string) (*ComponentTemplate, error) {
+	templates, err := getComponentTemplates(ctx, client, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, &ESError{Status: 404, Type: "resource_not_found_exception", Reason: fmt.Sprintf("component template [%s] not found", name)}
+	}
+	return &templates[0], nil
+}
+
+// ListComponentTemplates 列出所有组件模板
+func ListComponentTemplates(ctx context.Context, client *elasticsearch.Client) ([]ComponentTemplate, error) {
+	return getComponentTemplates(ctx, client, "")
+}
+
+func getComponentTemplates(ctx context.Context, client *elasticsearch.Client, name string) ([]ComponentTemplate, error) {
+	opts := []func(*esapi.ClusterGetComponentTemplateRequest){client.Cluster.GetComponentTemplate.WithContext(ctx)}
+	if name != "" {
+		opts = append(opts, client.Cluster.GetComponentTemplate.WithName(name))
+	}
+	res, err := client.Cluster.GetComponentTemplate(opts...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var r struct {
+		ComponentTemplates []struct {
+			Name              string            `json:"name"`
+			ComponentTemplate ComponentTemplate `json:"component_template"`
+		} `json:"component_templates"`
+	}
+	if err := decodeResponse(res, &r); err != nil {
+		return nil, err
+	}
+	templates := make([]ComponentTemplate, 0, len(r.ComponentTemplates))
+	for _, t := range r.ComponentTemplates {
+		t.ComponentTemplate.Name = t.Name
+		templates = append(templates, t.ComponentTemplate)
+	}
+	return templates, nil
+}
+
+// DeleteComponentTemplate 删除组件模板，被索引模板引用时会失败
+func DeleteComponentTemplate(ctx context.Context, client *elasticsearch.Client, name string) error {
+	res, err := client.Cluster.DeleteComponentTemplate(name,
+		client.Cluster.DeleteComponentTemplate.WithContext(ctx),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeResponse(res, nil)
+}
+
+// PutIndexTemplate 创建或更新索引模板，引用的组件模板必须已经存在
+func PutIndexTemplate(ctx context.Context, client *elasticsearch.Client, template IndexTemplate) error {
+	if template.Name == "" {
+		return fmt.Errorf("index template name can not be empty")
+	}
+	if len(template.IndexPatterns) == 0 {
+		return fmt.Errorf("index template %s requires at least one index pattern", template.Name)
+	}
+	body, err := json.Marshal(template)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	res, err := client.Indices.PutIndexTemplate(template.Name, bytes.NewReader(body),
+		client.Indices.PutIndexTemplate.WithContext(ctx),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeResponse(res, nil)
+}
+
+// GetIndexTemplate 获取索引模板，不存在时返回的错误满足 IsNotFound
+func GetIndexTemplate(ctx context.Context, client *elasticsearch.Client, name string) (*IndexTemplate, error) {
+	templates, err := getIndexTemplates(ctx, client, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, &ESError{Status: 404, Type: "resource_not_found_exception", Reason: fmt.Sprintf("index template [%s] not found", name)}
+	}
+	return &templates[0], nil
+}
+
+// ListIndexTemplates 列出所有索引模板
+func ListIndexTemplates(ctx context.Context, client *elasticsearch.Client) ([]IndexTemplate, error) {
+	return getIndexTemplates(ctx, client, "")
+}
+
+func getIndexTemplates(ctx context.Context, client *elasticsearch.Client, name string) ([]IndexTemplate, error) {
+	opts := []func(*esapi.IndicesGetIndexTemplateRequest){client.Indices.GetIndexTemplate.WithContext(ctx)}
+	if name != "" {
+		opts = append(opts, client.Indices.GetIndexTemplate.WithName(name))
+	}
+	res, err := client.Indices.GetIndexTemplate(opts...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var r struct {
+		IndexTemplates []struct {
+			Name          string        `json:"name"`
+			IndexTemplate IndexTemplate `json:"index_template"`
+		} `json:"index_templates"`
+	}
+	if err := decodeResponse(res, &r); err != nil {
+		return nil, err
+	}
+	templates := make([]IndexTemplate, 0, len(r.IndexTemplates))
+	for _, t := range r.IndexTemplates {
+		t.IndexTemplate.Name = t.Name
+		templates = append(templates, t.IndexTemplate)
+	}
+	return templates, nil
+}
+
+// DeleteIndexTemplate 删除索引模板，已经创建的索引不受影响
+func DeleteIndexTemplate(ctx context.Context, client *elasticsearch.Client, name string) error {
+	res, err := client.Indices.DeleteIndexTemplate(name,
+		client.Indices.DeleteIndexTemplate.WithContext(ctx),
+	)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return decodeResponse(res, nil)
+}
+
+// TemplateRegistry 按名称登记组件模板和索引模板，服务启动时统一 Apply 到集群
+type TemplateRegistry struct {
+	mu             sync.RWMutex
+	components     map[string]ComponentTemplate
+	indexTemplates map[string]IndexTemplate
+}
+
+// NewTemplateRegistry 创建空的模板登记表
+func NewTemplateRegistry() *TemplateRegistry {
+	return &TemplateRegistry{
+		components:     map[string]ComponentTemplate{},
+		indexTemplates: map[string]IndexTemplate{},
+	}
+}
+
+// RegisterComponentTemplate 登记组件模板，同名的会被覆盖
+func (r *TemplateRegistry) RegisterComponentTemplate(template ComponentTemplate) *TemplateRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.components[template.Name] = template
+	return r
+}
+
+// RegisterIndexTemplate 登记索引模板，同名的会被覆盖
+func (r *TemplateRegistry) RegisterIndexTemplate(template IndexTemplate) *TemplateRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.indexTemplates[template.Name] = template
+	return r
+}
+
+// ComponentTemplate 按名称取已登记的组件模板
+func (r *TemplateRegistry) ComponentTemplate(name string) (ComponentTemplate, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.components[name]
+	return t, ok
+}
+
+// IndexTemplate 按名称取已登记的索引模板
+func (r *TemplateRegistry) IndexTemplate(name string) (IndexTemplate, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.indexTemplates[name]
+	return t, ok
+}
+
+// Apply 把登记的模板写入集群，先写组件模板再写索引模板；
+// 集群中版本号更高的模板不会被覆盖，版本号相同的不会重复写入，没有设置版本号的模板每次都会写入
+func (r *TemplateRegistry) Apply(ctx context.Context, client *elasticsearch.Client) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, name := range sortedKeys(r.components) {
+		template := r.components[name]
+		existing, err := GetComponentTemplate(ctx, client, name)
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+		if existing != nil && installed(existing.Version, template.Version) {
+			continue
+		}
+		if err := PutComponentTemplate(ctx, client, template); err != nil {
+			return errors.Wrapf(err, "put component template %s", name)
+		}
+	}
+
+	for _, name := range sortedKeys(r.indexTemplates) {
+		template := r.indexTemplates[name]
+		for _, component := range template.ComposedOf {
+			if _, ok := r.components[component]; ok {
+				continue
+			}
+			if _, err := GetComponentTemplate(ctx, client, component); err != nil {
+				return errors.Wrapf(err, "index template %s is composed of unknown component template %s", name, component)
+			}
+		}
+		existing, err := GetIndexTemplate(ctx, client, name)
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+		if existing != nil && installed(existing.Version, template.Version) {
+			continue
+		}
+		if err := PutIndexTemplate(ctx, client, template); err != nil {
+			return errors.Wrapf(err, "put index template %s", name)
+		}
+	}
+	return nil
+}
+
+// installed 集群中的模板版本更高，或者和登记的版本相同时不需要写入
+func installed(existing, registered int64) bool {
+	return existing > registered || (registered != 0 && existing == registered)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
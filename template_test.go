@@ -0,0 +1,272 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// templateServer 模拟组件模板和索引模板接口，模板按名称保存请求体，requests 记录写入和删除请求
+type templateServer struct {
+	t          *testing.T
+	components map[string]json.RawMessage
+	indexes    map[string]json.RawMessage
+	requests   []string
+}
+
+func newTemplateServer(t *testing.T) *templateServer {
+	return &templateServer{t: t, components: map[string]json.RawMessage{}, indexes: map[string]json.RawMessage{}}
+}
+
+func (s *templateServer) transport() roundTripFunc {
+	return func(req *http.Request) (int, string) {
+		var (
+			templates      map[string]json.RawMessage
+			listKey, field string
+		)
+		path := strings.TrimPrefix(req.URL.Path, "/")
+		kind, name, _ := strings.Cut(path, "/")
+		switch kind {
+		case "_component_template":
+			templates, listKey, field = s.components, "component_templates", "component_template"
+		case "_index_template":
+			templates, listKey, field = s.indexes, "index_templates", "index_template"
+		default:
+			s.t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+			return http.StatusBadRequest, `{"error":"unexpected request","status":400}`
+		}
+		notFound := fmt.Sprintf(`{"error":{"type":"resource_not_found_exception","reason":"%s [%s] not found"},"status":404}`, field, name)
+
+		switch req.Method {
+		case http.MethodGet:
+			var items []string
+			for _, n := range sortedKeys(templates) {
+				if name == "" || n == name {
+					items = append(items, fmt.Sprintf(`{"name":%q,%q:%s}`, n, field, templates[n]))
+				}
+			}
+			if name != "" && len(items) == 0 {
+				return http.StatusNotFound, notFound
+			}
+			return http.StatusOK, fmt.Sprintf(`{%q:[%s]}`, listKey, strings.Join(items, ","))
+		case http.MethodPut:
+			s.requests = append(s.requests, "PUT "+req.URL.Path)
+			body, _ := io.ReadAll(req.Body)
+			templates[name] = body
+			return http.StatusOK, `{"acknowledged":true}`
+		case http.MethodDelete:
+			s.requests = append(s.requests, "DELETE "+req.URL.Path)
+			if _, ok := templates[name]; !ok {
+				return http.StatusNotFound, notFound
+			}
+			delete(templates, name)
+			return http.StatusOK, `{"acknowledged":true}`
+		}
+		return http.StatusMethodNotAllowed, `{"error":"method not allowed","status":405}`
+	}
+}
+
+func TestComponentTemplateCRUD(t *testing.T) {
+	server := newTemplateServer(t)
+	client := newTransportClient(t, server.transport())
+	ctx := context.Background()
+
+	template := ComponentTemplate{
+		Name:     "zeus-settings",
+		Version:  2,
+		Template: TemplateBody{Settings: map[string]interface{}{"number_of_shards": float64(3)}},
+		Meta:     map[string]interface{}{"owner": "search"},
+	}
+	if err := PutComponentTemplate(ctx, client, template); err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(server.components["zeus-settings"], &body); err != nil {
+		t.Fatal(err)
+	}
+	assertGoldenJSON(t, "component template body", body, nil,
+		`{"template":{"settings":{"number_of_shards":3}},"version":2,"_meta":{"owner":"search"}}`)
+
+	got, err := GetComponentTemplate(ctx, client, "zeus-settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "zeus-settings" || got.Version != 2 || got.Template.Settings["number_of_shards"] != float64(3) {
+		t.Fatalf("got %+v", got)
+	}
+	if err := PutComponentTemplate(ctx, client, ComponentTemplate{Name: "zeus-mappings"}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := ListComponentTemplates(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "zeus-mappings" || list[1].Name != "zeus-settings" {
+		t.Fatalf("list = %+v", list)
+	}
+
+	if err := DeleteComponentTemplate(ctx, client, "zeus-settings"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetComponentTemplate(ctx, client, "zeus-settings"); !IsNotFound(err) {
+		t.Fatalf("get deleted template err = %v", err)
+	}
+	if err := DeleteComponentTemplate(ctx, client, "zeus-settings"); !IsNotFound(err) {
+		t.Fatalf("delete missing template err = %v", err)
+	}
+
+	requests := len(server.requests)
+	if err := PutComponentTemplate(ctx, client, ComponentTemplate{}); err == nil {
+		t.Fatal("component template without name accepted")
+	}
+	if len(server.requests) != requests {
+		t.Fatal("invalid component template was sent")
+	}
+}
+
+func TestIndexTemplateCRUD(t *testing.T) {
+	server := newTemplateServer(t)
+	client := newTransportClient(t, server.transport())
+	ctx := context.Background()
+
+	template := IndexTemplate{
+		Name:          "zeus",
+		IndexPatterns: []string{"zeus-*"},
+		ComposedOf:    []string{"zeus-settings"},
+		Template:      &TemplateBody{Aliases: map[string]interface{}{"zeus": map[string]interface{}{}}},
+		Priority:      100,
+		Version:       3,
+	}
+	if err := PutIndexTemplate(ctx, client, template); err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(server.indexes["zeus"], &body); err != nil {
+		t.Fatal(err)
+	}
+	assertGoldenJSON(t, "index template body", body, nil,
+		`{"index_patterns":["zeus-*"],"composed_of":["zeus-settings"],"template":{"aliases":{"zeus":{}}},"priority":100,"version":3}`)
+
+	got, err := GetIndexTemplate(ctx, client, "zeus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "zeus" || got.Version != 3 || got.Priority != 100 || fmt.Sprint(got.IndexPatterns, got.ComposedOf) != "[zeus-*] [zeus-settings]" {
+		t.Fatalf("got %+v", got)
+	}
+	list, err := ListIndexTemplates(ctx, client)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("list = %+v, %v", list, err)
+	}
+
+	if err := DeleteIndexTemplate(ctx, client, "zeus"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetIndexTemplate(ctx, client, "zeus"); !IsNotFound(err) {
+		t.Fatalf("get deleted template err = %v", err)
+	}
+
+	requests := len(server.requests)
+	for _, invalid := range []IndexTemplate{{IndexPatterns: []string{"zeus-*"}}, {Name: "zeus"}} {
+		if err := PutIndexTemplate(ctx, client, invalid); err == nil {
+			t.Fatalf("invalid index template %+v accepted", invalid)
+		}
+	}
+	if len(server.requests) != requests {
+		t.Fatal("invalid index template was sent")
+	}
+}
+
+func TestTemplateRegistryApply(t *testing.T) {
+	server := newTemplateServer(t)
+	client := newTransportClient(t, server.transport())
+	ctx := context.Background()
+	registry := zeusTemplateRegistry("zeus-*")
+
+	// 第一次写入全部模板，组件模板在索引模板之前
+	if err := registry.Apply(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	want := "[PUT /_component_template/zeus-field-conventions PUT /_index_template/zeus]"
+	if fmt.Sprint(server.requests) != want {
+		t.Fatalf("requests = %v, want %s", server.requests, want)
+	}
+
+	// 版本号相同的模板已经写入过，不再重复写入
+	server.requests = nil
+	if err := registry.Apply(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.requests) != 0 {
+		t.Fatalf("requests = %v, want none", server.requests)
+	}
+
+	// 升级索引模板的版本号后只写入索引模板
+	index, _ := registry.IndexTemplate("zeus")
+	index.Version = 2
+	registry.RegisterIndexTemplate(index)
+	if err := registry.Apply(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(server.requests) != "[PUT /_index_template/zeus]" {
+		t.Fatalf("requests = %v", server.requests)
+	}
+
+	// 集群中版本号更高的模板不会被旧版本覆盖
+	server.requests = nil
+	server.components[zeusFieldConventionsTemplate] = json.RawMessage(`{"template":{},"version":5}`)
+	index.Version = 1
+	registry.RegisterIndexTemplate(index)
+	if err := registry.Apply(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.requests) != 0 {
+		t.Fatalf("requests = %v, want none", server.requests)
+	}
+}
+
+func TestTemplateRegistryApplyUnversioned(t *testing.T) {
+	server := newTemplateServer(t)
+	client := newTransportClient(t, server.transport())
+	registry := NewTemplateRegistry().RegisterComponentTemplate(ComponentTemplate{Name: "zeus-settings"})
+	for i := 0; i < 2; i++ {
+		if err := registry.Apply(context.Background(), client); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 没有版本号时无法判断是否已经写入，每次都写入
+	if fmt.Sprint(server.requests) != "[PUT /_component_template/zeus-settings PUT /_component_template/zeus-settings]" {
+		t.Fatalf("requests = %v", server.requests)
+	}
+}
+
+func TestTemplateRegistryApplyUnknownComponent(t *testing.T) {
+	server := newTemplateServer(t)
+	server.components["installed"] = json.RawMessage(`{"template":{}}`)
+	client := newTransportClient(t, server.transport())
+
+	registry := NewTemplateRegistry().RegisterIndexTemplate(IndexTemplate{
+		Name: "zeus", IndexPatterns: []string{"zeus-*"}, ComposedOf: []string{"installed", "missing"},
+	})
+	err := registry.Apply(context.Background(), client)
+	if err == nil || !strings.Contains(err.Error(), "unknown component template missing") || !IsNotFound(err) {
+		t.Fatalf("err = %v", err)
+	}
+	if len(server.requests) != 0 {
+		t.Fatalf("requests = %v, want none", server.requests)
+	}
+	// 集群中已经存在的组件模板可以直接引用
+	registry = NewTemplateRegistry().RegisterIndexTemplate(IndexTemplate{
+		Name: "zeus", IndexPatterns: []string{"zeus-*"}, ComposedOf: []string{"installed"},
+	})
+	if err := registry.Apply(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(server.requests) != "[PUT /_index_template/zeus]" {
+		t.Fatalf("requests = %v", server.requests)
+	}
+}